@@ -0,0 +1,621 @@
+// file: config/config.go
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// C 是启动时加载的全局配置，供无法通过参数注入的位置（如控制器）读取
+var C *Config
+
+// Config 是平台的全部运行配置，对应 YAML 配置文件的结构
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Redis     RedisConfig     `yaml:"redis"`
+	JWT       JWTConfig       `yaml:"jwt"`
+	CORS      CORSConfig      `yaml:"cors"`
+	Docker    DockerConfig    `yaml:"docker"`
+	Container ContainerConfig `yaml:"container"`
+	Gateway   GatewayConfig   `yaml:"gateway"`
+	TCPProxy  TCPProxyConfig  `yaml:"tcp_proxy"`
+	Contest   ContestConfig   `yaml:"contest"`
+	Flag      FlagConfig      `yaml:"flag"`
+	Submit    SubmitConfig    `yaml:"submit"`
+	Scoring   ScoringConfig   `yaml:"scoring"`
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr"`
+	Mode string `yaml:"mode"` // gin 运行模式: debug / release / test
+}
+
+type DatabaseConfig struct {
+	Driver          string        `yaml:"driver"` // mysql / postgres / sqlite
+	DSN             string        `yaml:"dsn"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	PoolSize int    `yaml:"pool_size"`
+}
+
+type JWTConfig struct {
+	Secret string        `yaml:"secret"`
+	Expire time.Duration `yaml:"expire"`
+}
+
+type CORSConfig struct {
+	AllowOrigins []string `yaml:"allow_origins"`
+}
+
+type DockerConfig struct {
+	// Backend 是动态容器的编排后端: swarm / docker（单机 docker run）/ fake（内存实现，无需 Docker）
+	Backend string `yaml:"backend"`
+	// PublicHost 是选手连接动态容器时使用的地址（Swarm 任一节点的公网或内网 IP）
+	PublicHost string `yaml:"public_host"`
+	// PublicHostLabel 是 Swarm 节点标签名，节点设置了该标签时优先使用标签值作为连接地址，留空则只使用 PublicHost
+	PublicHostLabel string `yaml:"public_host_label"`
+	// AttachContainer 是平台自身的容器名或 ID。禁止出网的题目和经网关、TCP 代理转发的端口不发布，
+	// 平台容器会被接入实例所在的队伍网络，使 HTTP 网关和 TCP 代理能直接访问实例
+	AttachContainer string `yaml:"attach_container"`
+}
+
+type ContainerConfig struct {
+	// ReaperInterval 是检查到期容器的间隔
+	ReaperInterval time.Duration `yaml:"reaper_interval"`
+	// ExpiryWarning 容器到期前多久向队伍发送提醒
+	ExpiryWarning time.Duration `yaml:"expiry_warning"`
+	// ReconcileInterval 是数据库与编排后端对账的间隔
+	ReconcileInterval time.Duration `yaml:"reconcile_interval"`
+	// PendingGrace 创建中的容器超过该时间仍未就绪即视为失败
+	PendingGrace time.Duration `yaml:"pending_grace"`
+	// FlagReadyTimeout 是注入 Flag 后等待就绪检查通过的最长时间
+	FlagReadyTimeout time.Duration `yaml:"flag_ready_timeout"`
+	// Defaults 是题目未单独设置时使用的资源限制与生命周期策略
+	Defaults InstancePolicy `yaml:"defaults"`
+}
+
+// InstancePolicy 描述动态容器的资源限制、生命周期和续期规则
+type InstancePolicy struct {
+	MemoryMB    int64         `yaml:"memory_mb"`    // 内存上限（MB）
+	CPUs        float64       `yaml:"cpus"`         // CPU 上限（核）
+	PidsLimit   int64         `yaml:"pids_limit"`   // 进程数上限，防止 fork 炸弹
+	Lifetime    time.Duration `yaml:"lifetime"`     // 创建后的存活时间
+	MaxRenewals uint          `yaml:"max_renewals"` // 最多续期次数，0 表示不允许续期
+	RenewalStep time.Duration `yaml:"renewal_step"` // 每次续期延长的时间
+	MaxPerTeam  int           `yaml:"max_per_team"` // 申请该题容器时队伍最多同时持有的容器数
+}
+
+type GatewayConfig struct {
+	// Enabled 开启后，HTTP 端口的动态容器通过 <token>.<Domain> 子域名访问。
+	// 这些端口不再发布，网关经队伍网络连接实例，因此 swarm / docker 后端需要配置 docker.attach_container
+	Enabled bool `yaml:"enabled"`
+	// Domain 是泛解析到本服务的域名，如 chal.example.com
+	Domain string `yaml:"domain"`
+	// Scheme 是选手访问子域名使用的协议（TLS 由前置的负载均衡终止时填 https）
+	Scheme string `yaml:"scheme"`
+	// UpstreamHost 是网关连接仍发布端口的实例（开启网关前创建）时使用的地址，留空则使用实例的对外地址
+	UpstreamHost string `yaml:"upstream_host"`
+	// TeamCookie 开启后只有持有本队访问凭证（Cookie）的请求才会被转发
+	TeamCookie bool `yaml:"team_cookie"`
+	// CookieTTL 是访问凭证的有效期
+	CookieTTL time.Duration `yaml:"cookie_ttl"`
+}
+
+type TCPProxyConfig struct {
+	// Enabled 开启后，TCP 端口的动态容器需要先发送票据再由平台转发。
+	// 这些端口不再发布，代理经队伍网络连接实例，因此 swarm / docker 后端需要配置 docker.attach_container
+	Enabled bool `yaml:"enabled"`
+	// Addr 是代理的监听地址
+	Addr string `yaml:"addr"`
+	// PublicAddr 是选手连接代理使用的地址，如 ctf.example.com:9000
+	PublicAddr string `yaml:"public_addr"`
+	// UpstreamHost 是代理连接仍发布端口的实例（开启代理前创建）时使用的地址，留空则使用实例的对外地址
+	UpstreamHost string `yaml:"upstream_host"`
+	// MaxConnsPerTeam 是每支队伍经本代理同时保持的最大连接数
+	MaxConnsPerTeam int `yaml:"max_conns_per_team"`
+	// HandshakeTimeout 是等待选手发送票据的时间
+	HandshakeTimeout time.Duration `yaml:"handshake_timeout"`
+}
+
+type ContestConfig struct {
+	// FreshmanYear 入学年份等于该值的用户注册后归入新生赛道
+	FreshmanYear int `yaml:"freshman_year"`
+	// Gating 为 true 时答题接口按比赛阶段放行，管理员不受限制
+	Gating bool `yaml:"gating"`
+	// Phases 是各阶段 (preparing/running/frozen/ended/practice) 允许选手进行的操作：
+	// view 查看题目和下载附件，submit 提交 Flag，container 创建和续期容器
+	Phases map[string][]string `yaml:"phases"`
+}
+
+// ContestPhases 和 ContestActions 是 contest.phases 可用的阶段和操作
+var (
+	ContestPhases  = []string{"preparing", "running", "frozen", "ended", "practice"}
+	ContestActions = []string{"view", "submit", "container"}
+)
+
+// Allows 返回比赛处于 phase 阶段时是否允许 action 操作
+func (c ContestConfig) Allows(phase, action string) bool {
+	return slices.Contains(c.Phases[phase], action)
+}
+
+// SubmitConfig 是 Flag 提交的频率限制，计数保存在 Redis 的滑动窗口中。
+// 任一限制超出后该维度进入冷却，冷却期内的提交直接拒绝；短时间内反复超限时冷却时间逐次翻倍
+type SubmitConfig struct {
+	RateLimit bool `yaml:"rate_limit"`
+	// Window 是滑动窗口长度
+	Window time.Duration `yaml:"window"`
+	// 窗口内允许的提交次数，0 表示该维度不限制
+	PerUser          int `yaml:"per_user"`
+	PerTeam          int `yaml:"per_team"`
+	PerTeamChallenge int `yaml:"per_team_challenge"`
+	// Cooldown 是第一次超限的冷却时间，之后每次超限翻倍，不超过 MaxCooldown
+	Cooldown    time.Duration `yaml:"cooldown"`
+	MaxCooldown time.Duration `yaml:"max_cooldown"`
+	// StrikeReset 内没有再超限时冷却时间恢复为 Cooldown
+	StrikeReset time.Duration `yaml:"strike_reset"`
+}
+
+// ScoringConfig 是新建题目未指定计分方式时使用的默认值
+type ScoringConfig struct {
+	// DefaultFormula 为 linear / logarithmic / parabolic / static
+	DefaultFormula string `yaml:"default_formula"`
+	// Decay 是 logarithmic / parabolic 公式中分值降到最低分所需的解题数
+	Decay int `yaml:"decay"`
+	// Retroactive 为 true 时所有解题队伍的得分随题目当前分值变化
+	Retroactive bool `yaml:"retroactive"`
+	// Blood 是题目未单独设置时的一二三血奖励
+	Blood BloodConfig `yaml:"blood"`
+}
+
+// BloodConfig 是一二三血奖励，奖励分与题目得分分开记录，重算分值时不受解题数影响
+type BloodConfig struct {
+	// Type 为 percent（题目初始分的百分比）或 fixed（固定分数）
+	Type string `yaml:"type"`
+	// Bonuses 依次为一二三血的奖励，可少于三项，未列出的名次没有奖励
+	Bonuses []uint `yaml:"bonuses"`
+}
+
+// FlagConfig 是动态 Flag 的生成规则
+type FlagConfig struct {
+	// Prefix 替换模板中的 {prefix}
+	Prefix string `yaml:"prefix"`
+	// DefaultTemplate 是题目未设置模板时使用的模板
+	DefaultTemplate string `yaml:"default_template"`
+	// Secret 是计算队伍水印 {team_hmac} 的密钥，必须配置，与 jwt.secret 无关。
+	// 修改后已签发的 Flag 无法再追溯到队伍
+	Secret string `yaml:"secret"`
+	// EncryptionKey 是加密存储静态 Flag 和 Flag 规则的 AES-256 密钥（base64 编码的 32 字节），必须配置，
+	// 与 jwt.secret 无关，轮换 JWT 密钥不影响已加密的 Flag。EncryptionKeyID 写入密文，用于轮换密钥后找到对应的解密密钥
+	EncryptionKey   string `yaml:"encryption_key"`
+	EncryptionKeyID string `yaml:"encryption_key_id"`
+	// RetiredKeys 是轮换前使用过的密钥（密钥 ID -> base64 密钥），只用于解密旧密文
+	RetiredKeys map[string]string `yaml:"retired_keys"`
+}
+
+// Default 返回开发环境下可直接使用的默认配置（JWT 密钥、Flag 水印密钥和加密密钥除外，必须显式配置）
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr: ":8080",
+			Mode: "debug",
+		},
+		Database: DatabaseConfig{
+			Driver:          "mysql",
+			DSN:             "root:123456@tcp(localhost:3306)/dali_isctf?charset=utf8mb4&parseTime=True&loc=Local",
+			MaxIdleConns:    10,
+			MaxOpenConns:    100,
+			ConnMaxLifetime: time.Hour,
+		},
+		Redis: RedisConfig{
+			Addr:     "localhost:6379",
+			PoolSize: 100,
+		},
+		JWT: JWTConfig{
+			Expire: 7 * 24 * time.Hour,
+		},
+		CORS: CORSConfig{
+			AllowOrigins: []string{"http://localhost:5173"},
+		},
+		Docker: DockerConfig{
+			Backend:         "swarm",
+			PublicHost:      "127.0.0.1",
+			PublicHostLabel: "dalictf.public_host",
+		},
+		Container: ContainerConfig{
+			ReaperInterval:    30 * time.Second,
+			ExpiryWarning:     5 * time.Minute,
+			ReconcileInterval: 5 * time.Minute,
+			PendingGrace:      2 * time.Minute,
+			FlagReadyTimeout:  20 * time.Second,
+			Defaults: InstancePolicy{
+				MemoryMB:    256,
+				CPUs:        0.5,
+				PidsLimit:   256,
+				Lifetime:    time.Hour,
+				MaxRenewals: 3,
+				RenewalStep: 30 * time.Minute,
+				MaxPerTeam:  2,
+			},
+		},
+		Gateway: GatewayConfig{
+			Scheme:    "http",
+			CookieTTL: 12 * time.Hour,
+		},
+		TCPProxy: TCPProxyConfig{
+			Addr:             ":9000",
+			PublicAddr:       "127.0.0.1:9000",
+			MaxConnsPerTeam:  8,
+			HandshakeTimeout: 10 * time.Second,
+		},
+		Contest: ContestConfig{
+			FreshmanYear: 2025,
+			Gating:       true,
+			Phases: map[string][]string{
+				"preparing": {},
+				"running":   {"view", "submit", "container"},
+				"frozen":    {"view", "submit", "container"},
+				"ended":     {"view"},
+				"practice":  {"view", "submit", "container"},
+			},
+		},
+		Submit: SubmitConfig{
+			RateLimit:        true,
+			Window:           time.Minute,
+			PerUser:          10,
+			PerTeam:          30,
+			PerTeamChallenge: 10,
+			Cooldown:         30 * time.Second,
+			MaxCooldown:      10 * time.Minute,
+			StrikeReset:      time.Hour,
+		},
+		Scoring: ScoringConfig{
+			DefaultFormula: "linear",
+			Decay:          30,
+			Blood:          BloodConfig{Type: "percent"},
+		},
+		Flag: FlagConfig{
+			Prefix:          "ISCTF",
+			DefaultTemplate: "{prefix}{{team_hmac}}",
+			EncryptionKeyID: "default",
+		},
+	}
+}
+
+// Load 依次应用默认值、YAML 文件和环境变量，校验通过后写入全局 C。
+// path 为空或文件不存在时只使用默认值和环境变量。
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := yaml.Unmarshal(data, cfg); err != nil {
+				return nil, fmt.Errorf("parse config %q: %w", path, err)
+			}
+		case errors.Is(err, os.ErrNotExist):
+			// 允许只通过环境变量配置
+		default:
+			return nil, fmt.Errorf("read config %q: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	C = cfg
+	return cfg, nil
+}
+
+// applyEnv 用 DALICTF_ 前缀的环境变量覆盖配置
+func applyEnv(cfg *Config) error {
+	strVars := map[string]*string{
+		"DALICTF_SERVER_ADDR":              &cfg.Server.Addr,
+		"DALICTF_SERVER_MODE":              &cfg.Server.Mode,
+		"DALICTF_DATABASE_DRIVER":          &cfg.Database.Driver,
+		"DALICTF_DATABASE_DSN":             &cfg.Database.DSN,
+		"DALICTF_REDIS_ADDR":               &cfg.Redis.Addr,
+		"DALICTF_REDIS_PASSWORD":           &cfg.Redis.Password,
+		"DALICTF_JWT_SECRET":               &cfg.JWT.Secret,
+		"DALICTF_DOCKER_BACKEND":           &cfg.Docker.Backend,
+		"DALICTF_DOCKER_PUBLIC_HOST":       &cfg.Docker.PublicHost,
+		"DALICTF_DOCKER_PUBLIC_HOST_LABEL": &cfg.Docker.PublicHostLabel,
+		"DALICTF_DOCKER_ATTACH_CONTAINER":  &cfg.Docker.AttachContainer,
+		"DALICTF_GATEWAY_DOMAIN":           &cfg.Gateway.Domain,
+		"DALICTF_GATEWAY_SCHEME":           &cfg.Gateway.Scheme,
+		"DALICTF_GATEWAY_UPSTREAM_HOST":    &cfg.Gateway.UpstreamHost,
+		"DALICTF_TCP_PROXY_ADDR":           &cfg.TCPProxy.Addr,
+		"DALICTF_TCP_PROXY_PUBLIC_ADDR":    &cfg.TCPProxy.PublicAddr,
+		"DALICTF_TCP_PROXY_UPSTREAM_HOST":  &cfg.TCPProxy.UpstreamHost,
+		"DALICTF_FLAG_PREFIX":              &cfg.Flag.Prefix,
+		"DALICTF_FLAG_DEFAULT_TEMPLATE":    &cfg.Flag.DefaultTemplate,
+		"DALICTF_FLAG_SECRET":              &cfg.Flag.Secret,
+		"DALICTF_FLAG_ENCRYPTION_KEY":      &cfg.Flag.EncryptionKey,
+		"DALICTF_FLAG_ENCRYPTION_KEY_ID":   &cfg.Flag.EncryptionKeyID,
+		"DALICTF_SCORING_DEFAULT_FORMULA":  &cfg.Scoring.DefaultFormula,
+		"DALICTF_SCORING_BLOOD_TYPE":       &cfg.Scoring.Blood.Type,
+	}
+	for name, dst := range strVars {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+
+	intVars := map[string]*int{
+		"DALICTF_REDIS_DB":                     &cfg.Redis.DB,
+		"DALICTF_CONTEST_FRESHMAN_YEAR":        &cfg.Contest.FreshmanYear,
+		"DALICTF_TCP_PROXY_MAX_CONNS_PER_TEAM": &cfg.TCPProxy.MaxConnsPerTeam,
+		"DALICTF_SUBMIT_PER_USER":              &cfg.Submit.PerUser,
+		"DALICTF_SUBMIT_PER_TEAM":              &cfg.Submit.PerTeam,
+		"DALICTF_SUBMIT_PER_TEAM_CHALLENGE":    &cfg.Submit.PerTeamChallenge,
+		"DALICTF_SCORING_DECAY":                &cfg.Scoring.Decay,
+	}
+	for name, dst := range intVars {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("env %s: %w", name, err)
+			}
+			*dst = n
+		}
+	}
+
+	boolVars := map[string]*bool{
+		"DALICTF_GATEWAY_ENABLED":     &cfg.Gateway.Enabled,
+		"DALICTF_GATEWAY_TEAM_COOKIE": &cfg.Gateway.TeamCookie,
+		"DALICTF_TCP_PROXY_ENABLED":   &cfg.TCPProxy.Enabled,
+		"DALICTF_SUBMIT_RATE_LIMIT":   &cfg.Submit.RateLimit,
+		"DALICTF_CONTEST_GATING":      &cfg.Contest.Gating,
+		"DALICTF_SCORING_RETROACTIVE": &cfg.Scoring.Retroactive,
+	}
+	for name, dst := range boolVars {
+		if v, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("env %s: %w", name, err)
+			}
+			*dst = b
+		}
+	}
+
+	durationVars := map[string]*time.Duration{
+		"DALICTF_JWT_EXPIRE":                   &cfg.JWT.Expire,
+		"DALICTF_CONTAINER_REAPER_INTERVAL":    &cfg.Container.ReaperInterval,
+		"DALICTF_CONTAINER_EXPIRY_WARNING":     &cfg.Container.ExpiryWarning,
+		"DALICTF_CONTAINER_RECONCILE_INTERVAL": &cfg.Container.ReconcileInterval,
+		"DALICTF_CONTAINER_PENDING_GRACE":      &cfg.Container.PendingGrace,
+		"DALICTF_CONTAINER_FLAG_READY_TIMEOUT": &cfg.Container.FlagReadyTimeout,
+		"DALICTF_GATEWAY_COOKIE_TTL":           &cfg.Gateway.CookieTTL,
+		"DALICTF_SUBMIT_WINDOW":                &cfg.Submit.Window,
+		"DALICTF_SUBMIT_COOLDOWN":              &cfg.Submit.Cooldown,
+		"DALICTF_SUBMIT_MAX_COOLDOWN":          &cfg.Submit.MaxCooldown,
+	}
+	for name, dst := range durationVars {
+		if v, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("env %s: %w", name, err)
+			}
+			*dst = d
+		}
+	}
+
+	if v, ok := os.LookupEnv("DALICTF_CORS_ALLOW_ORIGINS"); ok {
+		cfg.CORS.AllowOrigins = splitList(v)
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// Validate 检查配置是否完整可用，返回的错误会列出所有问题
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	switch c.Server.Mode {
+	case "debug", "release", "test":
+	default:
+		errs = append(errs, fmt.Errorf("server.mode %q is invalid (debug/release/test)", c.Server.Mode))
+	}
+	switch c.Database.Driver {
+	case "mysql", "postgres", "sqlite":
+	default:
+		errs = append(errs, fmt.Errorf("database.driver %q is invalid (mysql/postgres/sqlite)", c.Database.Driver))
+	}
+	if c.Database.DSN == "" {
+		errs = append(errs, errors.New("database.dsn is required"))
+	}
+	if c.Redis.Addr == "" {
+		errs = append(errs, errors.New("redis.addr is required"))
+	}
+	if len(c.JWT.Secret) < 32 {
+		errs = append(errs, errors.New("jwt.secret must be at least 32 characters"))
+	}
+	if c.JWT.Expire <= 0 {
+		errs = append(errs, errors.New("jwt.expire must be positive"))
+	}
+	if len(c.CORS.AllowOrigins) == 0 {
+		errs = append(errs, errors.New("cors.allow_origins must not be empty"))
+	}
+	switch c.Docker.Backend {
+	case "swarm", "docker", "fake":
+	default:
+		errs = append(errs, fmt.Errorf("docker.backend %q is invalid (swarm/docker/fake)", c.Docker.Backend))
+	}
+	if c.Docker.PublicHost == "" {
+		errs = append(errs, errors.New("docker.public_host is required"))
+	}
+	if c.Container.ReaperInterval < time.Second {
+		errs = append(errs, errors.New("container.reaper_interval must be at least 1s"))
+	}
+	if c.Container.ExpiryWarning < 0 {
+		errs = append(errs, errors.New("container.expiry_warning must not be negative"))
+	}
+	if c.Container.ReconcileInterval < time.Second {
+		errs = append(errs, errors.New("container.reconcile_interval must be at least 1s"))
+	}
+	if c.Container.PendingGrace < time.Second {
+		errs = append(errs, errors.New("container.pending_grace must be at least 1s"))
+	}
+	if c.Container.FlagReadyTimeout < time.Second {
+		errs = append(errs, errors.New("container.flag_ready_timeout must be at least 1s"))
+	}
+	errs = append(errs, c.Container.Defaults.validate("container.defaults")...)
+	if c.Gateway.Enabled {
+		if c.Gateway.Domain == "" || strings.Contains(c.Gateway.Domain, "/") {
+			errs = append(errs, errors.New("gateway.domain must be a bare domain such as chal.example.com"))
+		}
+		if c.Gateway.Scheme != "http" && c.Gateway.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("gateway.scheme %q is invalid (http/https)", c.Gateway.Scheme))
+		}
+		if c.Gateway.TeamCookie && c.Gateway.CookieTTL < time.Minute {
+			errs = append(errs, errors.New("gateway.cookie_ttl must be at least 1m"))
+		}
+		if c.Docker.Backend != "fake" && c.Docker.AttachContainer == "" {
+			errs = append(errs, errors.New("gateway.enabled requires docker.attach_container"))
+		}
+	}
+	if c.TCPProxy.Enabled {
+		if c.TCPProxy.Addr == "" || c.TCPProxy.PublicAddr == "" {
+			errs = append(errs, errors.New("tcp_proxy.addr and tcp_proxy.public_addr are required"))
+		}
+		if c.TCPProxy.MaxConnsPerTeam < 1 {
+			errs = append(errs, errors.New("tcp_proxy.max_conns_per_team must be at least 1"))
+		}
+		if c.TCPProxy.HandshakeTimeout < time.Second {
+			errs = append(errs, errors.New("tcp_proxy.handshake_timeout must be at least 1s"))
+		}
+		if c.Docker.Backend != "fake" && c.Docker.AttachContainer == "" {
+			errs = append(errs, errors.New("tcp_proxy.enabled requires docker.attach_container"))
+		}
+	}
+	if c.Submit.RateLimit {
+		if c.Submit.Window < time.Second {
+			errs = append(errs, errors.New("submit.window must be at least 1s"))
+		}
+		if c.Submit.PerUser < 0 || c.Submit.PerTeam < 0 || c.Submit.PerTeamChallenge < 0 {
+			errs = append(errs, errors.New("submit.per_user, per_team and per_team_challenge must not be negative"))
+		}
+		if c.Submit.Cooldown < time.Second || c.Submit.MaxCooldown < c.Submit.Cooldown {
+			errs = append(errs, errors.New("submit.cooldown must be at least 1s and not exceed submit.max_cooldown"))
+		}
+		if c.Submit.StrikeReset < c.Submit.MaxCooldown {
+			errs = append(errs, errors.New("submit.strike_reset must not be shorter than submit.max_cooldown"))
+		}
+	}
+	if c.Contest.FreshmanYear < 2000 || c.Contest.FreshmanYear > 2100 {
+		errs = append(errs, fmt.Errorf("contest.freshman_year %d is out of range", c.Contest.FreshmanYear))
+	}
+	switch c.Scoring.DefaultFormula {
+	case "linear", "logarithmic", "parabolic", "static":
+	default:
+		errs = append(errs, fmt.Errorf("scoring.default_formula %q is invalid (linear/logarithmic/parabolic/static)", c.Scoring.DefaultFormula))
+	}
+	if c.Scoring.Decay < 1 {
+		errs = append(errs, errors.New("scoring.decay must be at least 1"))
+	}
+	switch c.Scoring.Blood.Type {
+	case "percent":
+		for _, bonus := range c.Scoring.Blood.Bonuses {
+			if bonus > 100 {
+				errs = append(errs, fmt.Errorf("scoring.blood.bonuses: %d%% exceeds 100%%", bonus))
+			}
+		}
+	case "fixed":
+	default:
+		errs = append(errs, fmt.Errorf("scoring.blood.type %q is invalid (percent/fixed)", c.Scoring.Blood.Type))
+	}
+	if len(c.Scoring.Blood.Bonuses) > 3 {
+		errs = append(errs, errors.New("scoring.blood.bonuses allows at most 3 entries (first/second/third blood)"))
+	}
+	for phase, actions := range c.Contest.Phases {
+		if !slices.Contains(ContestPhases, phase) {
+			errs = append(errs, fmt.Errorf("contest.phases: unknown phase %q", phase))
+		}
+		for _, action := range actions {
+			if !slices.Contains(ContestActions, action) {
+				errs = append(errs, fmt.Errorf("contest.phases.%s: unknown action %q", phase, action))
+			}
+		}
+	}
+	if !strings.Contains(c.Flag.DefaultTemplate, "{team_hmac}") && !strings.Contains(c.Flag.DefaultTemplate, "{random}") {
+		errs = append(errs, errors.New("flag.default_template must contain {team_hmac} or {random}"))
+	}
+	if len(c.Flag.Secret) < 32 {
+		errs = append(errs, errors.New("flag.secret is required and must be at least 32 characters (openssl rand -hex 32)"))
+	}
+	if c.Flag.EncryptionKeyID == "" || strings.Contains(c.Flag.EncryptionKeyID, ":") {
+		errs = append(errs, errors.New("flag.encryption_key_id must be non-empty and must not contain ':'"))
+	}
+	if c.Flag.EncryptionKey == "" {
+		errs = append(errs, errors.New("flag.encryption_key is required (openssl rand -base64 32)"))
+	} else if key, err := base64.StdEncoding.DecodeString(c.Flag.EncryptionKey); err != nil || len(key) != 32 {
+		errs = append(errs, errors.New("flag.encryption_key must be 32 bytes encoded in base64"))
+	}
+	for id, k := range c.Flag.RetiredKeys {
+		if key, err := base64.StdEncoding.DecodeString(k); err != nil || len(key) != 32 {
+			errs = append(errs, fmt.Errorf("flag.retired_keys.%s must be 32 bytes encoded in base64", id))
+		}
+		if id == c.Flag.EncryptionKeyID {
+			errs = append(errs, fmt.Errorf("flag.retired_keys.%s reuses the active encryption_key_id", id))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// validate 检查策略取值，prefix 用于错误信息中的字段路径
+func (p InstancePolicy) validate(prefix string) []error {
+	var errs []error
+	if p.MemoryMB < 16 {
+		errs = append(errs, fmt.Errorf("%s.memory_mb must be at least 16", prefix))
+	}
+	if p.CPUs <= 0 {
+		errs = append(errs, fmt.Errorf("%s.cpus must be positive", prefix))
+	}
+	if p.PidsLimit <= 0 {
+		errs = append(errs, fmt.Errorf("%s.pids_limit must be positive", prefix))
+	}
+	if p.Lifetime < time.Minute {
+		errs = append(errs, fmt.Errorf("%s.lifetime must be at least 1m", prefix))
+	}
+	if p.RenewalStep < time.Minute {
+		errs = append(errs, fmt.Errorf("%s.renewal_step must be at least 1m", prefix))
+	}
+	if p.MaxPerTeam < 1 {
+		errs = append(errs, fmt.Errorf("%s.max_per_team must be at least 1", prefix))
+	}
+	return errs
+}
@@ -109,7 +109,7 @@ func DownloadAttachment(c *gin.Context) {
 	attachmentID, _ := strconv.Atoi(c.Param("attachment_id"))
 
 	var attachment models.Attachment
-	if err := database.DB.First(&attachment, attachmentID).Error; err != nil {
+	if err := database.DB.First(&attachment, attachmentID).Error; err != nil || !challengeInContest(c, attachment.ChallengeID) {
 		utils.Error(c, 4004, "附件不存在")
 		return
 	}
@@ -134,6 +134,10 @@ func ListAttachments(c *gin.Context) {
 		utils.Error(c, 1002, "无效的题目ID")
 		return
 	}
+	if !challengeInContest(c, uint32(challengeID)) {
+		utils.Error(c, 4004, "题目不存在")
+		return
+	}
 
 	var attachments []models.Attachment
 	db := database.DB.Where("challenge_id = ?", challengeID)
@@ -152,6 +156,13 @@ func ListAttachments(c *gin.Context) {
 	utils.Success(c, "success", attachments)
 }
 
+// challengeInContest 判断题目是否属于请求所属的比赛
+func challengeInContest(c *gin.Context, challengeID uint32) bool {
+	var count int64
+	database.DB.Model(&models.Challenge{}).Where("id = ? AND contest_id = ?", challengeID, requestContestID(c)).Count(&count)
+	return count > 0
+}
+
 // UpdateAttachmentStatus —— 管理员更新附件状态
 func UpdateAttachmentStatus(c *gin.Context) {
 	attachmentID, err := strconv.Atoi(c.Param("attachment_id"))
@@ -2,18 +2,22 @@
 package controllers
 
 import (
+	"ISCTF/config"
 	"ISCTF/database"
 	"ISCTF/dto"
 	"ISCTF/models"
 	"ISCTF/services"
 	"ISCTF/utils"
+	"context"
 	"encoding/json"
-	"errors"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"log"
-	"math"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -29,22 +33,28 @@ func CreateChallenge(c *gin.Context) {
 	req.Normalize()
 
 	if req.ChallengeName == "" || req.ChallengeTypeID == 0 || req.Author == "" ||
-		req.Description == "" || req.Mode == "" || req.InitialScore == 0 {
+		req.Description == "" || req.Mode == "" || (req.InitialScore == 0 && len(req.Parts) == 0) {
 		utils.Error(c, 1001, "缺少必填字段")
 		return
 	}
-	if req.Mode != "static" && req.Mode != "dynamic" {
-		utils.Error(c, 1001, "mode 取值无效（static/dynamic）")
+	if req.Mode != "static" && req.Mode != "dynamic" && req.Mode != "team" {
+		utils.Error(c, 1001, "mode 取值无效（static/dynamic/team）")
 		return
 	}
-	if req.Mode == "static" && strings.TrimSpace(req.StaticFlag) == "" {
+	if req.Mode == "static" && strings.TrimSpace(req.StaticFlag) == "" && len(req.FlagRules) == 0 && len(req.Parts) == 0 {
 		utils.Error(c, 1002, "静态题目必须提供 Flag")
 		return
 	}
-	if req.Mode == "dynamic" && strings.TrimSpace(req.DockerImage) == "" {
+	if req.Mode == "dynamic" && strings.TrimSpace(req.DockerImage) == "" && strings.TrimSpace(req.ServiceSpec) == "" {
 		utils.Error(c, 1002, "动态题目必须提供 Docker 镜像")
 		return
 	}
+	if strings.TrimSpace(req.ServiceSpec) != "" {
+		if _, err := services.ParseServiceSpec(req.ServiceSpec); err != nil {
+			utils.Error(c, 1002, "service_spec 无效: "+err.Error())
+			return
+		}
+	}
 	if req.MinScore > req.InitialScore {
 		utils.Error(c, 1001, "min_score 不能大于 initial_score")
 		return
@@ -53,6 +63,81 @@ func CreateChallenge(c *gin.Context) {
 		utils.Error(c, 1001, "difficulty 取值无效（easy/medium/hard）")
 		return
 	}
+	if err := req.InstancePolicyReq.Validate(); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
+	if err := req.FlagInjectionReq.Validate("", "", ""); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
+	if req.FlagTemplate != "" {
+		if err := services.ValidateFlagTemplate(req.FlagTemplate); err != nil {
+			utils.Error(c, 1001, err.Error())
+			return
+		}
+	}
+	if len(req.FlagRules) > 0 && req.Mode != "static" {
+		utils.Error(c, 1001, "只有静态题目可以设置 flag_rules")
+		return
+	}
+	for _, r := range req.FlagRules {
+		if err := services.ValidateFlagRule(models.FlagRuleKind(r.Kind), r.Pattern); err != nil {
+			utils.Error(c, 1001, err.Error())
+			return
+		}
+	}
+	if len(req.Parts) > 0 {
+		if req.Mode != "static" || req.StaticFlag != "" || len(req.FlagRules) > 0 {
+			utils.Error(c, 1001, "parts 只能用于静态题目，且不能与 static_flag / flag_rules 同时使用")
+			return
+		}
+		for i := range req.Parts {
+			req.Parts[i].Normalize()
+			if err := req.Parts[i].Validate(); err != nil {
+				utils.Error(c, 1001, err.Error())
+				return
+			}
+			if err := services.ValidateFlagRule(models.FlagRuleKind(req.Parts[i].Kind), req.Parts[i].Flag); err != nil {
+				utils.Error(c, 1001, err.Error())
+				return
+			}
+		}
+	}
+	if req.Mode == "team" {
+		if err := services.ValidateTeamFlagTemplate(services.FlagTemplateFor(models.Challenge{FlagTemplate: req.FlagTemplate})); err != nil {
+			utils.Error(c, 1001, err.Error())
+			return
+		}
+	}
+
+	// 未指定的计分字段取配置 scoring 中的默认值
+	scoring := models.Challenge{
+		ScoreFormula: models.ScoreFormula(config.C.Scoring.DefaultFormula),
+		ScoreDecay:   uint(config.C.Scoring.Decay),
+		Retroactive:  config.C.Scoring.Retroactive,
+	}
+	if req.ScoreFormula != nil {
+		scoring.ScoreFormula = models.ScoreFormula(*req.ScoreFormula)
+	}
+	if req.ScoreDecay != nil {
+		scoring.ScoreDecay = *req.ScoreDecay
+	}
+	if req.Retroactive != nil {
+		scoring.Retroactive = *req.Retroactive
+	}
+	if req.BloodBonusType != nil {
+		scoring.BloodBonusType = models.BloodBonusType(*req.BloodBonusType)
+	}
+	scoring.BloodBonuses = req.BloodBonuses
+	if err := services.ValidateScoring(scoring.ScoreFormula, scoring.ScoreDecay); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
+	if err := services.ValidateBloodBonus(scoring.BloodBonusType, scoring.BloodBonuses); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
 
 	var qt models.QuestionType
 	if err := database.DB.First(&qt, req.ChallengeTypeID).Error; err != nil {
@@ -60,6 +145,11 @@ func CreateChallenge(c *gin.Context) {
 		return
 	}
 
+	contestID, ok := challengeContestID(c, req.ContestID)
+	if !ok {
+		return
+	}
+
 	chal := models.Challenge{
 		ChallengeName:   req.ChallengeName,
 		ChallengeTypeID: req.ChallengeTypeID,
@@ -67,28 +157,117 @@ func CreateChallenge(c *gin.Context) {
 		Description:     req.Description,
 		Hint:            req.Hint,
 		Mode:            models.ChallengeMode(req.Mode),
-		StaticFlag:      req.StaticFlag,
 		DockerImage:     req.DockerImage,
 		DockerPorts:     req.DockerPorts,
+		ServiceSpec:     req.ServiceSpec,
+		FlagTemplate:    req.FlagTemplate,
+		TeamFlagFile:    strings.TrimSpace(req.TeamFlagFile),
+		TeamFlagContent: req.TeamFlagContent,
 		Difficulty:      models.ChallengeDifficulty(req.Difficulty),
 		InitialScore:    req.InitialScore,
 		MinScore:        req.MinScore,
 		CurrentScore:    req.InitialScore,
 		DecayRatio:      req.DecayRatio,
+
+		MemoryLimitMB:     req.MemoryLimitMB,
+		CPULimit:          req.CPULimit,
+		PidsLimit:         req.PidsLimit,
+		LifetimeMinutes:   req.LifetimeMinutes,
+		MaxRenewals:       req.MaxRenewals,
+		RenewalMinutes:    req.RenewalMinutes,
+		MaxTeamContainers: req.MaxTeamContainers,
+
+		ContestID:      contestID,
+		ScoreFormula:   scoring.ScoreFormula,
+		ScoreDecay:     scoring.ScoreDecay,
+		Retroactive:    scoring.Retroactive,
+		BloodBonusType: scoring.BloodBonusType,
+		BloodBonuses:   scoring.BloodBonuses,
 	}
+	if req.NetworkIsolation != nil {
+		chal.NetworkIsolation = *req.NetworkIsolation
+	}
+	if req.BlockEgress != nil {
+		chal.BlockEgress = *req.BlockEgress
+	}
+	if req.FlagInjection != nil {
+		chal.FlagInjection = models.FlagInjection(*req.FlagInjection)
+	}
+	if req.FlagEnvName != nil {
+		chal.FlagEnvName = *req.FlagEnvName
+	}
+	if req.FlagPath != nil {
+		chal.FlagPath = *req.FlagPath
+	}
+	if req.FlagCommand != nil {
+		chal.FlagCommand = *req.FlagCommand
+	}
+	if req.FlagReadyCheck != nil {
+		chal.FlagReadyCheck = *req.FlagReadyCheck
+	}
+
+	encryptedFlag, err := utils.EncryptFlag(req.StaticFlag)
+	if err != nil {
+		utils.Error(c, 5000, "加密 Flag 失败: "+err.Error())
+		return
+	}
+	chal.StaticFlag = encryptedFlag
 
-	if err := database.DB.Create(&chal).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&chal).Error; err != nil {
+			return err
+		}
+		for _, r := range req.FlagRules {
+			pattern, err := utils.EncryptFlag(r.Pattern)
+			if err != nil {
+				return err
+			}
+			rule := models.FlagRule{ChallengeID: chal.ID, Kind: models.FlagRuleKind(r.Kind), Pattern: pattern, SortOrder: r.SortOrder}
+			if err := tx.Create(&rule).Error; err != nil {
+				return err
+			}
+		}
+		for i, p := range req.Parts {
+			part, err := newChallengePart(chal.ID, uint(i+1), p)
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&part).Error; err != nil {
+				return err
+			}
+		}
+		return services.SyncPartScores(tx, chal.ID)
+	})
+	if err != nil {
 		utils.Error(c, 5000, "创建题目失败: "+err.Error())
 		return
 	}
-	utils.Success(c, "Challenge created successfully", gin.H{"id": chal.ID})
+	utils.Success(c, "Challenge created successfully", gin.H{"id": chal.ID, "contest_id": chal.ContestID})
+}
+
+// challengeContestID 返回新题目所属的比赛：未指定时归入当前比赛，没有当前比赛时为 0。
+// 指定的比赛不存在时已写入响应
+func challengeContestID(c *gin.Context, contestID *uint) (uint, bool) {
+	if contestID == nil {
+		contest, err := services.CurrentContest()
+		if err != nil {
+			return 0, true
+		}
+		return contest.ID, true
+	}
+	var contest models.Contest
+	if err := database.DB.First(&contest, *contestID).Error; err != nil {
+		utils.Error(c, 4004, "比赛不存在")
+		return 0, false
+	}
+	return contest.ID, true
 }
 
-// ListChallenges —— 用户可见的题目列表
+// ListChallenges —— 用户可见的题目列表，只包含请求所属比赛的题目
 func ListChallenges(c *gin.Context) {
 	var challenges []models.Challenge
 	db := database.DB.Model(&models.Challenge{}).
-		Where("state = ?", models.ChallengeStateVisible).
+		Where("state = ? AND contest_id = ?", models.ChallengeStateVisible, requestContestID(c)).
 		Preload("QuestionType")
 
 	if err := db.Find(&challenges).Error; err != nil {
@@ -96,9 +275,14 @@ func ListChallenges(c *gin.Context) {
 		return
 	}
 
+	frozen, ok := frozenChallengeStats(c)
+	if !ok {
+		return
+	}
+
 	items := make([]dto.ChallengeItemResp, 0, len(challenges))
 	for _, ch := range challenges {
-		items = append(items, dto.ChallengeItemResp{
+		item := dto.ChallengeItemResp{
 			ID:            ch.ID,
 			ChallengeName: ch.ChallengeName,
 			Type:          ch.QuestionType.Alias,
@@ -106,7 +290,12 @@ func ListChallenges(c *gin.Context) {
 			Mode:          string(ch.Mode),
 			CurrentScore:  ch.CurrentScore,
 			SolvedCount:   ch.SolvedCount,
-		})
+		}
+		if frozen != nil {
+			item.CurrentScore = frozen[ch.ID].CurrentScore
+			item.SolvedCount = frozen[ch.ID].SolvedCount
+		}
+		items = append(items, item)
 	}
 
 	utils.Success(c, "success", gin.H{
@@ -125,13 +314,23 @@ func GetChallengeDetail(c *gin.Context) {
 	if err == nil {
 		var resp dto.ChallengeDetailResp
 		if json.Unmarshal([]byte(val), &resp) == nil {
+			if resp.ContestID != requestContestID(c) {
+				utils.Error(c, 4004, "题目不存在")
+				return
+			}
+			if !fillFrozenStats(c, &resp) {
+				return
+			}
+			fillTeamFlag(c, &resp)
+			fillPartProgress(c, &resp)
+			fillBloods(c, &resp)
 			utils.Success(c, "success (from cache)", resp)
 			return
 		}
 	}
 
 	var challenge models.Challenge
-	if err := database.DB.Preload("QuestionType").First(&challenge, id).Error; err != nil {
+	if err := database.DB.Preload("QuestionType").First(&challenge, id).Error; err != nil || challenge.ContestID != requestContestID(c) {
 		utils.Error(c, 4004, "题目不存在")
 		return
 	}
@@ -159,6 +358,22 @@ func GetChallengeDetail(c *gin.Context) {
 		})
 	}
 
+	var parts []models.ChallengePart
+	if err := database.DB.Where("challenge_id = ?", id).Order("position ASC, id ASC").Find(&parts).Error; err != nil {
+		utils.Error(c, 5000, "题目部分查询失败")
+		return
+	}
+	partMini := make([]dto.PartMini, 0, len(parts))
+	for _, p := range parts {
+		partMini = append(partMini, dto.PartMini{
+			ID:           p.ID,
+			Position:     p.Position,
+			Name:         p.Name,
+			CurrentScore: p.CurrentScore,
+			SolvedCount:  p.SolvedCount,
+		})
+	}
+
 	resp := dto.ChallengeDetailResp{
 		ID:            challenge.ID,
 		ChallengeName: challenge.ChallengeName,
@@ -170,6 +385,8 @@ func GetChallengeDetail(c *gin.Context) {
 		Attachments:   mini,
 		CurrentScore:  challenge.CurrentScore,
 		SolvedCount:   challenge.SolvedCount,
+		Parts:         partMini,
+		ContestID:     challenge.ContestID,
 	}
 
 	// 2. 查询结果存入 Redis，缓存5分钟
@@ -178,9 +395,161 @@ func GetChallengeDetail(c *gin.Context) {
 		database.RDB.Set(database.Ctx, cacheKey, jsonData, 5*time.Minute)
 	}
 
+	if !fillFrozenStats(c, &resp) {
+		return
+	}
+	fillTeamFlag(c, &resp)
+	fillPartProgress(c, &resp)
+	fillBloods(c, &resp)
 	utils.Success(c, "success", resp)
 }
 
+// frozenChallengeStats 封榜期间对非管理员返回按封榜前解题记录计算的题目分值和解题数，
+// 不在封榜期间时返回 nil。查询失败时已写入响应
+func frozenChallengeStats(c *gin.Context) (map[uint32]services.ChallengeStats, bool) {
+	v, ok := c.Get("contest")
+	if !ok {
+		return nil, true
+	}
+	contest := v.(*models.Contest)
+	if !contest.ScoreboardFrozen(time.Now()) || isAdminRequest(c) {
+		return nil, true
+	}
+	stats, err := services.ChallengeStatsAt(contest.ID, *contest.FreezeTime)
+	if err != nil {
+		utils.Error(c, 5000, "查询失败")
+		return nil, false
+	}
+	return stats, true
+}
+
+// fillFrozenStats 封榜期间把详情中的分值和解题数（含各部分）换成封榜时的数据，缓存中保留实时数据。
+// 查询失败时已写入响应
+func fillFrozenStats(c *gin.Context, resp *dto.ChallengeDetailResp) bool {
+	frozen, ok := frozenChallengeStats(c)
+	if !ok || frozen == nil {
+		return ok
+	}
+	stat := frozen[resp.ID]
+	resp.CurrentScore = stat.CurrentScore
+	resp.SolvedCount = stat.SolvedCount
+	for i := range resp.Parts {
+		resp.Parts[i].CurrentScore = stat.Parts[resp.Parts[i].ID].CurrentScore
+		resp.Parts[i].SolvedCount = stat.Parts[resp.Parts[i].ID].SolvedCount
+	}
+	return true
+}
+
+// fillTeamFlag 为 team 模式题目填入当前队伍的 Flag 或个人化附件，未加入队伍时不填
+func fillTeamFlag(c *gin.Context, resp *dto.ChallengeDetailResp) {
+	if resp.Mode != string(models.ChallengeModeTeam) {
+		return
+	}
+	userIDAny, _ := c.Get("user_id")
+	userID := userIDAny.(uint32)
+	var userTeam models.TeamMember
+	if err := database.DB.Where("user_id = ?", userID).First(&userTeam).Error; err != nil {
+		return
+	}
+	var challenge models.Challenge
+	if err := database.DB.First(&challenge, resp.ID).Error; err != nil {
+		return
+	}
+	if challenge.TeamFlagFile != "" {
+		resp.TeamAttachment = challenge.TeamFlagFile
+		return
+	}
+	resp.TeamFlag = services.GenerateTeamFlag(challenge, userTeam.TeamID)
+}
+
+// fillBloods 填入题目的一二三血，封榜期间非管理员只看到封榜前的血和自己队伍的血
+func fillBloods(c *gin.Context, resp *dto.ChallengeDetailResp) {
+	query := services.BloodQuery{ContestID: resp.ContestID, ChallengeID: resp.ID}
+	if v, ok := c.Get("contest"); ok {
+		contest := v.(*models.Contest)
+		if contest.ScoreboardFrozen(time.Now()) && !isAdminRequest(c) {
+			query.Until = contest.FreezeTime
+			userIDAny, _ := c.Get("user_id")
+			var userTeam models.TeamMember
+			if database.DB.Where("user_id = ?", userIDAny.(uint32)).First(&userTeam).Error == nil {
+				query.TeamID = userTeam.TeamID
+			}
+		}
+	}
+	bloods, err := services.ListBloods(query)
+	if err != nil {
+		log.Printf("Failed to load bloods of challenge %d: %v", resp.ID, err)
+	}
+	resp.Bloods = make([]dto.BloodMini, 0, len(bloods))
+	for _, b := range bloods {
+		resp.Bloods = append(resp.Bloods, dto.BloodMini{
+			Blood:       b.Blood,
+			TeamID:      b.TeamID,
+			TeamName:    b.TeamName,
+			BonusScore:  b.BonusScore,
+			SolvingTime: b.SolvingTime.Format("2006-01-02 15:04:05"),
+		})
+	}
+}
+
+func partMiniIDs(parts []dto.PartMini) []uint32 {
+	ids := make([]uint32, 0, len(parts))
+	for _, p := range parts {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+// fillPartProgress 标出多阶段题目中当前队伍已解出的部分
+func fillPartProgress(c *gin.Context, resp *dto.ChallengeDetailResp) {
+	if len(resp.Parts) == 0 {
+		return
+	}
+	userIDAny, _ := c.Get("user_id")
+	userID := userIDAny.(uint32)
+	var userTeam models.TeamMember
+	if err := database.DB.Where("user_id = ?", userID).First(&userTeam).Error; err != nil {
+		return
+	}
+	var solved []uint32
+	database.DB.Model(&models.Submission{}).
+		Where("challenge_id = ? AND team_id = ? AND part_id IN ?", resp.ID, userTeam.TeamID, partMiniIDs(resp.Parts)).
+		Pluck("part_id", &solved)
+	for i := range resp.Parts {
+		resp.Parts[i].Solved = slices.Contains(solved, resp.Parts[i].ID)
+	}
+}
+
+// DownloadTeamAttachment —— 下载 team 模式题目的个人化附件，内容含当前队伍的 Flag
+func DownloadTeamAttachment(c *gin.Context) {
+	challengeID, _ := strconv.Atoi(c.Param("id"))
+	userIDAny, _ := c.Get("user_id")
+	userID := userIDAny.(uint32)
+
+	var userTeam models.TeamMember
+	if err := database.DB.Where("user_id = ?", userID).First(&userTeam).Error; err != nil {
+		utils.Error(c, 3005, "你尚未加入任何队伍")
+		return
+	}
+
+	var challenge models.Challenge
+	if err := database.DB.First(&challenge, challengeID).Error; err != nil || challenge.ContestID != requestContestID(c) {
+		utils.Error(c, 4004, "题目不存在")
+		return
+	}
+	if challenge.State != models.ChallengeStateVisible {
+		utils.Error(c, 4003, "题目不可见")
+		return
+	}
+	if challenge.Mode != models.ChallengeModeTeam || challenge.TeamFlagFile == "" {
+		utils.Error(c, 4004, "该题目没有个人化附件")
+		return
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": challenge.TeamFlagFile}))
+	c.Data(http.StatusOK, "application/octet-stream", services.TeamFlagAttachment(challenge, userTeam.TeamID))
+}
+
 // SubmitFlag -- 包含完整日志、计分、销毁容器和自动标记逻辑
 func SubmitFlag(c *gin.Context) {
 	challengeID, _ := strconv.Atoi(c.Param("id"))
@@ -209,7 +578,7 @@ func SubmitFlag(c *gin.Context) {
 	}
 
 	var challenge models.Challenge
-	if err := database.DB.First(&challenge, challengeID).Error; err != nil {
+	if err := database.DB.First(&challenge, challengeID).Error; err != nil || challenge.ContestID != requestContestID(c) {
 		utils.Error(c, 4004, "题目不存在")
 		return
 	}
@@ -220,116 +589,282 @@ func SubmitFlag(c *gin.Context) {
 		UserID:        userID,
 		SubmittedFlag: req.Flag,
 		IPAddress:     c.ClientIP(),
+		ContestID:     challenge.ContestID,
+	}
+
+	// 频率限制在比对之前检查，被拒绝的提交同样写入日志供审计
+	throttle, err := services.CheckSubmitLimit(c.Request.Context(), userID, userTeam.TeamID, challenge.ID)
+	if err != nil {
+		log.Printf("SubmitFlag: %v", err)
+	}
+	if throttle != nil {
+		logEntry.FlagResult = models.FlagResultThrottled
+		if err := database.DB.Create(&logEntry).Error; err != nil {
+			log.Printf("SubmitFlag: log throttled submission: %v", err)
+		}
+		retryAfter := int((throttle.RetryAfter + time.Second - 1) / time.Second)
+		code, msg := 6004, "Too many submissions, please retry later"
+		if throttle.Cooling {
+			code, msg = 6005, "Submissions are cooling down, please retry later"
+		}
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, utils.Response{Code: code, Msg: msg, Data: gin.H{
+			"scope":       throttle.Scope,
+			"retry_after": retryAfter,
+		}})
+		return
 	}
 
 	isCorrect := false
 	var dynamicContainer models.Container
-	if challenge.Mode == models.ChallengeModeStatic {
-		isCorrect = (challenge.StaticFlag == req.Flag)
-	} else {
-		err := database.DB.Where("challenge_id = ? AND team_id = ?", challengeID, userTeam.TeamID).First(&dynamicContainer).Error
+	// 多阶段题目的各部分及本次命中的部分
+	var parts []models.ChallengePart
+	var part *models.ChallengePart
+	switch challenge.Mode {
+	case models.ChallengeModeStatic:
+		var err error
+		if parts, err = services.LoadChallengeParts(challenge.ID); err == nil && len(parts) > 0 {
+			if part = services.MatchPart(parts, req.Flag); part != nil {
+				isCorrect = true
+				logEntry.MatchedPartID = &part.ID
+			}
+		} else if err == nil {
+			var rule *models.FlagRule
+			isCorrect, rule, err = services.MatchStaticFlag(challenge, req.Flag)
+			if rule != nil {
+				logEntry.MatchedRuleID = &rule.ID
+			}
+		}
+		if err != nil {
+			log.Printf("SubmitFlag: challenge %d: %v", challenge.ID, err)
+			utils.Error(c, 5000, "提交失败，请稍后重试")
+			return
+		}
+	case models.ChallengeModeTeam:
+		// 每队 Flag 不落库，按队伍重新计算后比对
+		isCorrect = services.VerifyTeamFlag(challenge, userTeam.TeamID, req.Flag)
+	default:
+		err := database.DB.Where("challenge_id = ? AND team_id = ?", challengeID, userTeam.TeamID).Order("id desc").First(&dynamicContainer).Error
 		if err == nil && dynamicContainer.ContainerFlag == req.Flag {
 			isCorrect = true
 		}
 	}
 
-	err := database.DB.Transaction(func(tx *gorm.DB) error {
-		var existingSolve models.Submission
-		if err := tx.Where("challenge_id = ? AND team_id = ?", challengeID, userTeam.TeamID).First(&existingSolve).Error; err == nil {
-			logEntry.FlagResult = models.FlagResultDuplicate
-			tx.Create(&logEntry)
-			utils.Error(c, 6001, "Already solved by your team")
-			return errors.New("duplicate solve")
+	// 错误的 Flag 若带有其他队伍的水印，说明 Flag 来自其他队伍
+	if !isCorrect && challenge.Mode != models.ChallengeModeStatic {
+		if owner, ok := services.TraceFlag(challenge.ID, req.Flag); ok && owner != userTeam.TeamID {
+			logEntry.Suspected = true
+			log.Printf("Suspicious activity detected: team %d submitted the flag issued to team %d for challenge %d.", userTeam.TeamID, owner, challenge.ID)
 		}
+	}
 
+	// 赛后练习阶段只判定对错，不写入解题记录、不计分
+	if phase, _ := c.Get("contest_phase"); phase == models.ContestStatusPractice {
+		logEntry.FlagResult = models.FlagResultWrong
+		if isCorrect {
+			logEntry.FlagResult = models.FlagResultPractice
+		}
+		if err := database.DB.Create(&logEntry).Error; err != nil {
+			log.Printf("SubmitFlag: log practice submission: %v", err)
+		}
 		if !isCorrect {
-			logEntry.FlagResult = models.FlagResultWrong
-			tx.Create(&logEntry)
 			utils.Error(c, 6002, "Incorrect flag")
-			return errors.New("incorrect flag")
+			return
 		}
+		utils.Success(c, "Correct! Practice mode, not scored.", gin.H{
+			"challenge_id": challenge.ID,
+			"practice":     true,
+		})
+		return
+	}
 
-		logEntry.FlagResult = models.FlagResultCorrect
-		if err := tx.Create(&logEntry).Error; err != nil {
-			return err
+	// 事务只负责写库，结果通过以下变量带出，提交之后再响应并触发后续的异步任务
+	var (
+		rejectCode   int // 非 0 表示提交被拒绝（重复、未解锁或错误），rejectMsg 为提示
+		rejectMsg    string
+		solvedParts  []uint32
+		newSolve     models.Submission
+		scoreToAward uint
+	)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 重复和错误提交只写日志，事务正常提交，日志不会被回滚
+		if len(parts) > 0 {
+			// 多阶段题目：全部解出后的任何提交、或命中已解出的部分，都视为重复提交
+			var err error
+			if solvedParts, err = services.SolvedPartIDs(tx, challenge.ID, userTeam.TeamID, parts); err != nil {
+				return err
+			}
+			if len(solvedParts) >= len(parts) || (part != nil && slices.Contains(solvedParts, part.ID)) {
+				logEntry.FlagResult = models.FlagResultDuplicate
+				rejectCode, rejectMsg = 6001, "Already solved by your team"
+				return tx.Create(&logEntry).Error
+			}
+			if part != nil && !services.PartUnlocked(parts, solvedParts, part) {
+				logEntry.FlagResult = models.FlagResultLocked
+				rejectCode, rejectMsg = 6003, "Solve the previous parts first"
+				return tx.Create(&logEntry).Error
+			}
+		} else {
+			var existingSolve models.Submission
+			if err := tx.Where("challenge_id = ? AND team_id = ?", challengeID, userTeam.TeamID).First(&existingSolve).Error; err == nil {
+				logEntry.FlagResult = models.FlagResultDuplicate
+				rejectCode, rejectMsg = 6001, "Already solved by your team"
+				return tx.Create(&logEntry).Error
+			}
 		}
 
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&challenge, challengeID).Error; err != nil {
-			return err
+		if !isCorrect {
+			logEntry.FlagResult = models.FlagResultWrong
+			rejectCode, rejectMsg = 6002, "Incorrect flag"
+			return tx.Create(&logEntry).Error
 		}
 
-		scoreToAward := challenge.CurrentScore
-		newSolve := models.Submission{
-			ChallengeID: uint32(challengeID),
-			TeamID:      userTeam.TeamID,
-			UserID:      userID,
-			Score:       scoreToAward,
-		}
-		if err := tx.Create(&newSolve).Error; err != nil {
+		logEntry.FlagResult = models.FlagResultCorrect
+		if err := tx.Create(&logEntry).Error; err != nil {
 			return err
 		}
 
-		challenge.SolvedCount++
-		decay := uint(math.Round(float64(challenge.InitialScore) * float64(challenge.DecayRatio)))
-		if decay == 0 && challenge.DecayRatio > 0 {
-			decay = 1
-		}
-		newScore := int(challenge.CurrentScore) - int(decay)
-		if newScore < int(challenge.MinScore) {
-			newScore = int(challenge.MinScore)
+		if part != nil {
+			// 多阶段题目按部分计分和衰减，题目的汇总分值随后重新计算
+			var locked models.ChallengePart
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, part.ID).Error; err != nil {
+				return err
+			}
+			params := services.PartScoreParams(challenge, locked)
+			scoreToAward = services.SolveScore(params, locked.SolvedCount, challenge.Retroactive)
+			newSolve = models.Submission{
+				ChallengeID: uint32(challengeID),
+				PartID:      locked.ID,
+				TeamID:      userTeam.TeamID,
+				UserID:      userID,
+				Score:       scoreToAward,
+				ContestID:   challenge.ContestID,
+			}
+			if err := tx.Create(&newSolve).Error; err != nil {
+				return err
+			}
+			locked.SolvedCount++
+			locked.CurrentScore = services.ScoreAt(params, locked.SolvedCount)
+			if err := tx.Save(&locked).Error; err != nil {
+				return err
+			}
+			if challenge.Retroactive {
+				if err := services.ApplyRetroactiveScore(tx, challenge.ID, locked.ID, scoreToAward); err != nil {
+					return err
+				}
+			}
+			if err := services.SyncPartScores(tx, challenge.ID); err != nil {
+				return err
+			}
+		} else {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&challenge, challengeID).Error; err != nil {
+				return err
+			}
+
+			params := services.ChallengeScoreParams(challenge)
+			scoreToAward = services.SolveScore(params, challenge.SolvedCount, challenge.Retroactive)
+			newSolve = models.Submission{
+				ChallengeID: uint32(challengeID),
+				TeamID:      userTeam.TeamID,
+				UserID:      userID,
+				Score:       scoreToAward,
+				ContestID:   challenge.ContestID,
+			}
+			if err := tx.Create(&newSolve).Error; err != nil {
+				return err
+			}
+
+			challenge.SolvedCount++
+			challenge.CurrentScore = services.ScoreAt(params, challenge.SolvedCount)
+
+			if err := tx.Save(&challenge).Error; err != nil {
+				return err
+			}
+			if challenge.Retroactive {
+				if err := services.ApplyRetroactiveScore(tx, challenge.ID, 0, scoreToAward); err != nil {
+					return err
+				}
+			}
 		}
-		challenge.CurrentScore = uint(newScore)
 
-		if err := tx.Save(&challenge).Error; err != nil {
-			return err
+		// 解出整道题目（多阶段题目为现有部分中的最后一个）时记录一二三血，solvedParts 不含已删除部分
+		if part == nil || len(solvedParts)+1 == len(parts) {
+			if err := services.AssignBlood(tx, challenge, &newSolve); err != nil {
+				return err
+			}
 		}
 
-		if isCorrect && challenge.Mode == models.ChallengeModeDynamic && dynamicContainer.ID != 0 {
-			go func() {
-				err := services.DestroyService(dynamicContainer.DockerID) // 使用 DestroyService
-				if err != nil {
-					log.Printf("Error destroying container %s after solve: %v", dynamicContainer.DockerID, err)
-					return
-				}
-				dynamicContainer.State = models.ContainerStateDestroyed
-				database.DB.Save(&dynamicContainer)
+		return nil
+	})
+
+	if err != nil {
+		log.Printf("SubmitFlag: challenge %d team %d: %v", challengeID, userTeam.TeamID, err)
+		utils.Error(c, 5000, "提交失败，请稍后重试")
+		return
+	}
+
+	// 提交Flag后（无论成功失败），清理该题目的详情缓存，以保证分数和解题数能及时刷新
+	cacheKey := "challenge_detail:" + strconv.Itoa(challengeID)
+	database.RDB.Del(database.Ctx, cacheKey)
+
+	if rejectCode != 0 {
+		utils.Error(c, rejectCode, rejectMsg)
+		return
+	}
+
+	if isCorrect && challenge.Mode == models.ChallengeModeDynamic && dynamicContainer.ID != 0 {
+		go func() {
+			released, err := services.ReleaseContainer(context.Background(), &dynamicContainer)
+			if err != nil {
+				log.Printf("Error destroying container %s after solve: %v", dynamicContainer.DockerID, err)
+				return
+			}
+			if released {
 				log.Printf("Container %s destroyed successfully after correct submission.", dynamicContainer.DockerID)
-			}()
-		}
+			}
+		}()
+	}
 
-		if challenge.Mode == models.ChallengeModeDynamic {
-			go func(flag string, currentTeamID uint32) {
-				var otherSubmissions []models.SubmissionLog
-				database.DB.Where("submitted_flag = ? AND team_id != ? AND flag_result = ?", flag, currentTeamID, models.FlagResultCorrect).Find(&otherSubmissions)
-				if len(otherSubmissions) > 0 {
-					database.DB.Model(&models.SubmissionLog{}).Where("submitted_flag = ? AND flag_result = ?", flag, models.FlagResultCorrect).Update("suspected", true)
-					log.Printf("Suspicious activity detected: Dynamic flag '%s' submitted by multiple teams. All related submissions have been marked.", flag)
-				}
-			}(req.Flag, team.ID)
-		}
+	if challenge.Mode != models.ChallengeModeStatic {
+		go func(flag string, currentTeamID uint32) {
+			var otherSubmissions []models.SubmissionLog
+			database.DB.Where("submitted_flag = ? AND team_id != ? AND flag_result = ?", flag, currentTeamID, models.FlagResultCorrect).Find(&otherSubmissions)
+			if len(otherSubmissions) > 0 {
+				database.DB.Model(&models.SubmissionLog{}).Where("submitted_flag = ? AND flag_result = ?", flag, models.FlagResultCorrect).Update("suspected", true)
+				log.Printf("Suspicious activity detected: Dynamic flag '%s' submitted by multiple teams. All related submissions have been marked.", flag)
+			}
+		}(req.Flag, team.ID)
+	}
 
-		// 新增：触发大屏缓存更新
-		go func(solve models.Submission, chal models.Challenge, t models.Team) {
-			services.AddSolveToFeed(solve, chal, t)
-			services.UpdateScoreboardCache() // 每次解题都完全刷新排行榜
-		}(newSolve, challenge, team)
+	// 新增：触发大屏缓存更新
+	go func(solve models.Submission, chal models.Challenge, t models.Team) {
+		services.AddSolveToFeed(solve, chal, t)
+		services.UpdateScoreboardCache(chal.ContestID) // 每次解题都完全刷新该比赛的排行榜
+	}(newSolve, challenge, team)
 
-		utils.Success(c, "Correct! First solve for your team.", gin.H{
+	if part != nil {
+		utils.Success(c, "Correct! Part solved.", gin.H{
 			"challenge_id": challenge.ID,
+			"part_id":      part.ID,
+			"part_name":    part.Name,
+			"solved_parts": len(solvedParts) + 1,
+			"total_parts":  len(parts),
 			"score":        scoreToAward,
+			"blood":        newSolve.Blood,
+			"bonus_score":  newSolve.BonusScore,
 			"team_id":      team.ID,
 			"solving_time": newSolve.SolvingTime,
 		})
-		return nil
-	})
-
-	if err != nil && (err.Error() == "duplicate solve" || err.Error() == "incorrect flag") {
 		return
 	}
-
-	// 提交Flag后（无论成功失败），清理该题目的详情缓存，以保证分数和解题数能及时刷新
-	cacheKey := "challenge_detail:" + strconv.Itoa(challengeID)
-	database.RDB.Del(database.Ctx, cacheKey)
+	utils.Success(c, "Correct! First solve for your team.", gin.H{
+		"challenge_id": challenge.ID,
+		"score":        scoreToAward,
+		"blood":        newSolve.Blood,
+		"bonus_score":  newSolve.BonusScore,
+		"team_id":      team.ID,
+		"solving_time": newSolve.SolvingTime,
+	})
 }
 
 // UpdateChallenge —— 管理员修改题目
@@ -349,6 +884,10 @@ func UpdateChallenge(c *gin.Context) {
 		utils.Error(c, 1001, "参数无效: "+err.Error())
 		return
 	}
+	if err := req.InstancePolicyReq.Validate(); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
 
 	var challenge models.Challenge
 	if err := database.DB.First(&challenge, id).Error; err != nil {
@@ -356,7 +895,13 @@ func UpdateChallenge(c *gin.Context) {
 		return
 	}
 
-	updates := make(map[string]interface{})
+	if err := req.FlagInjectionReq.Validate(string(challenge.FlagInjection), challenge.FlagPath, challenge.FlagCommand); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
+
+	updates := req.InstancePolicyReq.Updates()
+	maps.Copy(updates, req.FlagInjectionReq.Updates())
 	if req.State != nil {
 		updates["state"] = models.ChallengeState(*req.State)
 	}
@@ -370,7 +915,16 @@ func UpdateChallenge(c *gin.Context) {
 		updates["mode"] = models.ChallengeMode(*req.Mode)
 	}
 	if req.StaticFlag != nil {
-		updates["static_flag"] = *req.StaticFlag
+		if *req.StaticFlag != "" && hasChallengeParts(challenge.ID) {
+			utils.Error(c, 1001, "多阶段题目不能设置 static_flag")
+			return
+		}
+		encrypted, err := utils.EncryptFlag(*req.StaticFlag)
+		if err != nil {
+			utils.Error(c, 5000, "加密 Flag 失败: "+err.Error())
+			return
+		}
+		updates["static_flag"] = encrypted
 	}
 	if req.DockerImage != nil {
 		updates["docker_image"] = *req.DockerImage
@@ -378,16 +932,135 @@ func UpdateChallenge(c *gin.Context) {
 	if req.DockerPorts != nil {
 		updates["docker_ports"] = *req.DockerPorts
 	}
+	if req.ServiceSpec != nil {
+		if strings.TrimSpace(*req.ServiceSpec) != "" {
+			if _, err := services.ParseServiceSpec(*req.ServiceSpec); err != nil {
+				utils.Error(c, 1002, "service_spec 无效: "+err.Error())
+				return
+			}
+		}
+		updates["service_spec"] = *req.ServiceSpec
+	}
+	if req.FlagTemplate != nil {
+		if *req.FlagTemplate != "" {
+			if err := services.ValidateFlagTemplate(*req.FlagTemplate); err != nil {
+				utils.Error(c, 1001, err.Error())
+				return
+			}
+		}
+		updates["flag_template"] = *req.FlagTemplate
+	}
+	if req.TeamFlagFile != nil {
+		updates["team_flag_file"] = strings.TrimSpace(*req.TeamFlagFile)
+	}
+	if req.TeamFlagContent != nil {
+		updates["team_flag_content"] = *req.TeamFlagContent
+	}
+	if req.ContestID != nil && *req.ContestID != challenge.ContestID {
+		// 解题记录和排行榜按比赛统计，已有人解出的题目不能再移动
+		if challenge.SolvedCount > 0 {
+			utils.Error(c, 1001, "已有解题记录的题目不能移到其他比赛")
+			return
+		}
+		contestID, ok := challengeContestID(c, req.ContestID)
+		if !ok {
+			return
+		}
+		updates["contest_id"] = contestID
+	}
+
+	// 分值参数或计分方式变化后需要重算全部解题得分
+	scoringUpdates := req.ScoringReq.Updates()
+	if req.InitialScore != nil || req.MinScore != nil || req.DecayRatio != nil {
+		if hasChallengeParts(challenge.ID) {
+			utils.Error(c, 1001, "多阶段题目的分值在各部分上修改")
+			return
+		}
+		if req.InitialScore != nil {
+			scoringUpdates["initial_score"] = *req.InitialScore
+		}
+		if req.MinScore != nil {
+			scoringUpdates["min_score"] = *req.MinScore
+		}
+		if req.DecayRatio != nil {
+			scoringUpdates["decay_ratio"] = *req.DecayRatio
+		}
+	}
+	maps.Copy(updates, scoringUpdates)
+
+	// 改为 team 模式或修改 team 模式题目的模板时，模板必须能按队伍重新计算出同一个 Flag
+	effective := challenge
+	if req.Mode != nil {
+		effective.Mode = models.ChallengeMode(*req.Mode)
+	}
+	if req.FlagTemplate != nil {
+		effective.FlagTemplate = *req.FlagTemplate
+	}
+	if effective.Mode == models.ChallengeModeTeam {
+		if err := services.ValidateTeamFlagTemplate(services.FlagTemplateFor(effective)); err != nil {
+			utils.Error(c, 1001, err.Error())
+			return
+		}
+	}
+	if req.ScoreFormula != nil {
+		effective.ScoreFormula = models.ScoreFormula(*req.ScoreFormula)
+	}
+	if req.ScoreDecay != nil {
+		effective.ScoreDecay = *req.ScoreDecay
+	}
+	if err := services.ValidateScoring(effective.ScoreFormula, effective.ScoreDecay); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
+	if req.BloodBonusType != nil {
+		effective.BloodBonusType = models.BloodBonusType(*req.BloodBonusType)
+	}
+	if req.BloodBonuses != nil {
+		effective.BloodBonuses = req.BloodBonuses
+	}
+	if err := services.ValidateBloodBonus(effective.BloodBonusType, effective.BloodBonuses); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
+	if req.InitialScore != nil || req.MinScore != nil {
+		if req.InitialScore != nil {
+			effective.InitialScore = *req.InitialScore
+		}
+		if req.MinScore != nil {
+			effective.MinScore = *req.MinScore
+		}
+		if effective.InitialScore == 0 || effective.MinScore > effective.InitialScore {
+			utils.Error(c, 1001, "initial_score 必须为正数且不小于 min_score")
+			return
+		}
+	}
+	if req.DecayRatio != nil && (*req.DecayRatio < 0 || *req.DecayRatio > 1) {
+		utils.Error(c, 1001, "decay_ratio 必须在 0 到 1 之间")
+		return
+	}
 
 	if len(updates) == 0 {
 		utils.Success(c, "没有需要更新的字段", nil)
 		return
 	}
 
-	if err := database.DB.Model(&challenge).Updates(updates).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&challenge).Updates(updates).Error; err != nil {
+			return err
+		}
+		if len(scoringUpdates) > 0 {
+			return services.RescoreChallenge(tx, challenge.ID)
+		}
+		return nil
+	})
+	if err != nil {
 		utils.Error(c, 5000, "更新题目失败: "+err.Error())
 		return
 	}
+	if len(scoringUpdates) > 0 {
+		clearChallengeDetailCache(challenge.ID)
+		go services.UpdateScoreboardCache(challenge.ContestID)
+	}
 
 	utils.Success(c, "Challenge updated successfully", nil)
 }
@@ -408,6 +1081,31 @@ func DeleteChallenge(c *gin.Context) {
 	utils.Success(c, "Challenge deleted successfully", nil)
 }
 
+// RescoreChallenge —— 管理员按题目当前的计分方式重算全部解题得分
+func RescoreChallenge(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.Error(c, 1002, "无效的题目ID")
+		return
+	}
+
+	var challenge models.Challenge
+	if err := database.DB.First(&challenge, id).Error; err != nil {
+		utils.Error(c, 4004, "题目不存在")
+		return
+	}
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return services.RescoreChallenge(tx, challenge.ID)
+	}); err != nil {
+		utils.Error(c, 5000, "重算分值失败: "+err.Error())
+		return
+	}
+	clearChallengeDetailCache(challenge.ID)
+	go services.UpdateScoreboardCache(challenge.ContestID)
+
+	utils.Success(c, "Challenge rescored", nil)
+}
+
 // AdminListChallenges —— 管理员查询题目列表
 func AdminListChallenges(c *gin.Context) {
 	typeIDStr := c.Query("type_id")
@@ -430,6 +1128,9 @@ func AdminListChallenges(c *gin.Context) {
 
 	db := database.DB.Model(&models.Challenge{}).Preload("QuestionType")
 
+	if contestID := c.Query("contest_id"); contestID != "" {
+		db = db.Where("contest_id = ?", contestID)
+	}
 	if typeIDStr != "" {
 		if tid, err := strconv.Atoi(typeIDStr); err == nil && tid > 0 {
 			db = db.Where("challenge_type_id = ?", tid)
@@ -473,6 +1174,7 @@ func AdminListChallenges(c *gin.Context) {
 			CurrentScore:  ch.CurrentScore,
 			SolvedCount:   ch.SolvedCount,
 			UpdatedAt:     ch.UpdatedAt.Format("2006-01-02 15:04:05"),
+			ContestID:     ch.ContestID,
 		})
 	}
 
@@ -515,27 +1217,79 @@ func AdminGetChallengeDetail(c *gin.Context) {
 		})
 	}
 
+	var rules []models.FlagRule
+	if err := database.DB.Where("challenge_id = ?", id).Order("sort_order ASC, id ASC").Find(&rules).Error; err != nil {
+		utils.Error(c, 5000, "Flag 规则查询失败")
+		return
+	}
+	var parts []models.ChallengePart
+	if err := database.DB.Where("challenge_id = ?", id).Order("position ASC, id ASC").Find(&parts).Error; err != nil {
+		utils.Error(c, 5000, "题目部分查询失败")
+		return
+	}
+
 	resp := dto.AdminChallengeDetailResp{
-		ID:            ch.ID,
-		ChallengeName: ch.ChallengeName,
-		Type:          ch.QuestionType.Alias,
-		Author:        ch.Author,
-		Description:   ch.Description,
-		Hint:          ch.Hint,
-		Mode:          string(ch.Mode),
-		Difficulty:    string(ch.Difficulty),
-		State:         string(ch.State),
-		StaticFlag:    ch.StaticFlag,
-		DockerImage:   ch.DockerImage,
-		DockerPorts:   ch.DockerPorts,
-		CurrentScore:  ch.CurrentScore,
-		InitialScore:  ch.InitialScore,
-		MinScore:      ch.MinScore,
-		DecayRatio:    ch.DecayRatio,
-		SolvedCount:   ch.SolvedCount,
-		Attachments:   mini,
-		CreatedAt:     ch.CreatedAt.Format("2006-01-02 15:04:05"),
-		UpdatedAt:     ch.UpdatedAt.Format("2006-01-02 15:04:05"),
+		ID:              ch.ID,
+		ChallengeName:   ch.ChallengeName,
+		Type:            ch.QuestionType.Alias,
+		Author:          ch.Author,
+		Description:     ch.Description,
+		Hint:            ch.Hint,
+		Mode:            string(ch.Mode),
+		Difficulty:      string(ch.Difficulty),
+		State:           string(ch.State),
+		HasStaticFlag:   ch.StaticFlag != "",
+		DockerImage:     ch.DockerImage,
+		DockerPorts:     ch.DockerPorts,
+		ServiceSpec:     ch.ServiceSpec,
+		FlagTemplate:    ch.FlagTemplate,
+		TeamFlagFile:    ch.TeamFlagFile,
+		TeamFlagContent: ch.TeamFlagContent,
+		CurrentScore:    ch.CurrentScore,
+		InitialScore:    ch.InitialScore,
+		MinScore:        ch.MinScore,
+		DecayRatio:      ch.DecayRatio,
+		SolvedCount:     ch.SolvedCount,
+		Attachments:     mini,
+		FlagRules:       flagRuleResps(rules),
+		Parts:           challengePartResps(parts),
+		ContestID:       ch.ContestID,
+		ScoreFormula:    string(ch.ScoreFormula),
+		ScoreDecay:      ch.ScoreDecay,
+		Retroactive:     ch.Retroactive,
+		BloodBonusType:  string(ch.BloodBonusType),
+		BloodBonuses:    ch.BloodBonuses,
+		CreatedAt:       ch.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:       ch.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if ch.Mode == models.ChallengeModeDynamic {
+		policy := services.InstancePolicyFor(ch)
+		resp.InstancePolicy = &dto.InstancePolicyResp{
+			MemoryLimitMB:     policy.MemoryMB,
+			CPULimit:          policy.CPUs,
+			PidsLimit:         policy.PidsLimit,
+			LifetimeMinutes:   uint(policy.Lifetime / time.Minute),
+			MaxRenewals:       policy.MaxRenewals,
+			RenewalMinutes:    uint(policy.RenewalStep / time.Minute),
+			MaxTeamContainers: policy.MaxPerTeam,
+			NetworkIsolation:  ch.NetworkIsolation,
+			BlockEgress:       ch.BlockEgress,
+		}
+		resp.FlagInjection = &dto.FlagInjectionResp{
+			Mode:       string(ch.FlagInjection),
+			Path:       ch.FlagPath,
+			Command:    ch.FlagCommand,
+			ReadyCheck: ch.FlagReadyCheck,
+		}
+		if resp.FlagInjection.Mode == "" {
+			resp.FlagInjection.Mode = string(models.FlagInjectionEnv)
+		}
+		if resp.FlagInjection.Mode == string(models.FlagInjectionEnv) {
+			resp.FlagInjection.EnvName = ch.FlagEnvName
+			if resp.FlagInjection.EnvName == "" {
+				resp.FlagInjection.EnvName = models.DefaultFlagEnvName
+			}
+		}
 	}
 
 	utils.Success(c, "success", resp)
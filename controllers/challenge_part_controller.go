@@ -0,0 +1,267 @@
+// file: controllers/challenge_part_controller.go
+package controllers
+
+import (
+	"ISCTF/database"
+	"ISCTF/dto"
+	"ISCTF/models"
+	"ISCTF/services"
+	"ISCTF/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+// ListChallengeParts —— 管理员查看多阶段题目的各部分
+func ListChallengeParts(c *gin.Context) {
+	challengeID, _ := strconv.Atoi(c.Param("id"))
+
+	var parts []models.ChallengePart
+	if err := database.DB.Where("challenge_id = ?", challengeID).Order("position ASC, id ASC").Find(&parts).Error; err != nil {
+		utils.Error(c, 5000, "查询失败")
+		return
+	}
+	utils.Success(c, "success", challengePartResps(parts))
+}
+
+// AddChallengePart —— 管理员为静态题目追加一个部分，排在已有部分之后
+func AddChallengePart(c *gin.Context) {
+	challengeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.Error(c, 1002, "无效的题目ID")
+		return
+	}
+
+	var req dto.ChallengePartReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 1001, "参数无效: "+err.Error())
+		return
+	}
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
+	if err := services.ValidateFlagRule(models.FlagRuleKind(req.Kind), req.Flag); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
+
+	var challenge models.Challenge
+	if err := database.DB.First(&challenge, challengeID).Error; err != nil {
+		utils.Error(c, 4004, "题目不存在")
+		return
+	}
+	if challenge.Mode != models.ChallengeModeStatic {
+		utils.Error(c, 1001, "只有静态题目可以设置多个部分")
+		return
+	}
+	var ruleCount int64
+	database.DB.Model(&models.FlagRule{}).Where("challenge_id = ?", challenge.ID).Count(&ruleCount)
+	if challenge.StaticFlag != "" || ruleCount > 0 {
+		utils.Error(c, 1001, "请先清除题目的 static_flag 和 Flag 规则")
+		return
+	}
+
+	var part models.ChallengePart
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var maxPosition uint
+		if err := tx.Model(&models.ChallengePart{}).Where("challenge_id = ?", challenge.ID).
+			Select("COALESCE(MAX(position), 0)").Scan(&maxPosition).Error; err != nil {
+			return err
+		}
+		var err error
+		if part, err = newChallengePart(challenge.ID, maxPosition+1, req); err != nil {
+			return err
+		}
+		if err := tx.Create(&part).Error; err != nil {
+			return err
+		}
+		return services.SyncPartScores(tx, challenge.ID)
+	})
+	if err != nil {
+		utils.Error(c, 5000, "添加部分失败: "+err.Error())
+		return
+	}
+	clearChallengeDetailCache(challenge.ID)
+	utils.Success(c, "Challenge part created successfully", gin.H{"part_id": part.ID, "position": part.Position})
+}
+
+// UpdateChallengePart —— 管理员修改部分；修改分值设置后当前分值限制在新的最低分和初始分之间
+func UpdateChallengePart(c *gin.Context) {
+	partID, err := strconv.Atoi(c.Param("part_id"))
+	if err != nil {
+		utils.Error(c, 1002, "无效的部分ID")
+		return
+	}
+
+	var req dto.UpdateChallengePartReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 1001, "参数无效: "+err.Error())
+		return
+	}
+
+	var part models.ChallengePart
+	if err := database.DB.First(&part, partID).Error; err != nil {
+		utils.Error(c, 4004, "部分不存在")
+		return
+	}
+	flag, err := utils.DecryptFlag(part.Flag)
+	if err != nil {
+		utils.Error(c, 5000, "解密 Flag 失败: "+err.Error())
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Position != nil {
+		updates["position"] = *req.Position
+	}
+	if req.Kind != nil {
+		part.Kind = models.FlagRuleKind(*req.Kind)
+		updates["kind"] = part.Kind
+	}
+	if req.Flag != nil {
+		flag = *req.Flag
+		encrypted, err := utils.EncryptFlag(flag)
+		if err != nil {
+			utils.Error(c, 5000, "加密 Flag 失败: "+err.Error())
+			return
+		}
+		updates["flag"] = encrypted
+	}
+	if req.InitialScore != nil {
+		part.InitialScore = *req.InitialScore
+		updates["initial_score"] = part.InitialScore
+	}
+	if req.MinScore != nil {
+		part.MinScore = *req.MinScore
+		updates["min_score"] = part.MinScore
+	}
+	if req.DecayRatio != nil {
+		part.DecayRatio = *req.DecayRatio
+		updates["decay_ratio"] = part.DecayRatio
+	}
+	if len(updates) == 0 {
+		utils.Success(c, "没有需要更新的字段", nil)
+		return
+	}
+	// 分值参数变化后按题目的计分方式重算该部分已有的解题得分
+	rescore := req.InitialScore != nil || req.MinScore != nil || req.DecayRatio != nil
+
+	check := dto.ChallengePartReq{Name: part.Name, InitialScore: part.InitialScore, MinScore: part.MinScore, DecayRatio: part.DecayRatio}
+	if req.Name != nil {
+		check.Name = *req.Name
+	}
+	if err := check.Validate(); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
+	if err := services.ValidateFlagRule(part.Kind, flag); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&part).Updates(updates).Error; err != nil {
+			return err
+		}
+		if rescore {
+			return services.RescoreChallenge(tx, part.ChallengeID)
+		}
+		return services.SyncPartScores(tx, part.ChallengeID)
+	})
+	if err != nil {
+		utils.Error(c, 5000, "更新部分失败: "+err.Error())
+		return
+	}
+	clearChallengeDetailCache(part.ChallengeID)
+	if rescore {
+		var challenge models.Challenge
+		if err := database.DB.Select("contest_id").First(&challenge, part.ChallengeID).Error; err == nil {
+			go services.UpdateScoreboardCache(challenge.ContestID)
+		}
+	}
+	utils.Success(c, "Challenge part updated successfully", nil)
+}
+
+// DeleteChallengePart —— 管理员删除部分，该部分的解题记录保留但不再计入进度和总分，
+// 剩余部分按计分方式重算后刷新排行榜
+func DeleteChallengePart(c *gin.Context) {
+	partID, err := strconv.Atoi(c.Param("part_id"))
+	if err != nil {
+		utils.Error(c, 1002, "无效的部分ID")
+		return
+	}
+
+	var part models.ChallengePart
+	if err := database.DB.First(&part, partID).Error; err != nil {
+		utils.Success(c, "Challenge part deleted successfully", nil)
+		return
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&part).Error; err != nil {
+			return err
+		}
+		return services.RescoreChallenge(tx, part.ChallengeID)
+	})
+	if err != nil {
+		utils.Error(c, 5000, "删除部分失败: "+err.Error())
+		return
+	}
+	clearChallengeDetailCache(part.ChallengeID)
+	var challenge models.Challenge
+	if err := database.DB.Select("contest_id").First(&challenge, part.ChallengeID).Error; err == nil {
+		go services.UpdateScoreboardCache(challenge.ContestID)
+	}
+	utils.Success(c, "Challenge part deleted successfully", nil)
+}
+
+// newChallengePart 由请求构造部分，Flag 加密存储
+func newChallengePart(challengeID uint32, position uint, req dto.ChallengePartReq) (models.ChallengePart, error) {
+	flag, err := utils.EncryptFlag(req.Flag)
+	if err != nil {
+		return models.ChallengePart{}, err
+	}
+	return models.ChallengePart{
+		ChallengeID:  challengeID,
+		Position:     position,
+		Name:         req.Name,
+		Kind:         models.FlagRuleKind(req.Kind),
+		Flag:         flag,
+		InitialScore: req.InitialScore,
+		MinScore:     req.MinScore,
+		CurrentScore: req.InitialScore,
+		DecayRatio:   req.DecayRatio,
+	}, nil
+}
+
+func hasChallengeParts(challengeID uint32) bool {
+	var count int64
+	database.DB.Model(&models.ChallengePart{}).Where("challenge_id = ?", challengeID).Count(&count)
+	return count > 0
+}
+
+func clearChallengeDetailCache(challengeID uint32) {
+	database.RDB.Del(database.Ctx, "challenge_detail:"+strconv.FormatUint(uint64(challengeID), 10))
+}
+
+func challengePartResps(parts []models.ChallengePart) []dto.ChallengePartResp {
+	items := make([]dto.ChallengePartResp, 0, len(parts))
+	for _, p := range parts {
+		items = append(items, dto.ChallengePartResp{
+			ID:           p.ID,
+			Position:     p.Position,
+			Name:         p.Name,
+			Kind:         string(p.Kind),
+			InitialScore: p.InitialScore,
+			MinScore:     p.MinScore,
+			CurrentScore: p.CurrentScore,
+			DecayRatio:   p.DecayRatio,
+			SolvedCount:  p.SolvedCount,
+		})
+	}
+	return items
+}
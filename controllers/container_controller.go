@@ -2,14 +2,17 @@
 package controllers
 
 import (
+	"ISCTF/config"
 	"ISCTF/database"
 	"ISCTF/models"
 	"ISCTF/services"
 	"ISCTF/utils"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
-	"log"
+	"slices"
 	"strconv"
 	"time"
 )
@@ -40,7 +43,7 @@ func CreateContainer(c *gin.Context) {
 	}
 
 	var challenge models.Challenge
-	if err := database.DB.First(&challenge, req.ChallengeID).Error; err != nil {
+	if err := database.DB.First(&challenge, req.ChallengeID).Error; err != nil || challenge.ContestID != requestContestID(c) {
 		utils.Error(c, 4004, "题目不存在")
 		return
 	}
@@ -49,77 +52,103 @@ func CreateContainer(c *gin.Context) {
 		return
 	}
 
-	// 修正：检查是否已为该题目申请了正在运行的容器
+	// 修正：检查是否已为该题目申请了正在运行（或正在创建、等待重启）的容器
 	var existingContainer models.Container
-	err := database.DB.Where("team_id = ? AND challenge_id = ? AND state = ?", team.ID, challenge.ID, models.ContainerStateRunning).First(&existingContainer).Error
+	err := database.DB.Where("team_id = ? AND challenge_id = ? AND state IN ?", team.ID, challenge.ID, models.ActiveStates).First(&existingContainer).Error
 	if err == nil {
 		utils.Error(c, 7004, "You already have a running container for this challenge")
 		return
 	}
 
-	var runningCount int64
-	database.DB.Model(&models.Container{}).Where("team_id = ? AND state = ?", team.ID, models.ContainerStateRunning).Count(&runningCount)
-	if runningCount >= 2 {
-		utils.Error(c, 7001, fmt.Sprintf("Team already has %d running containers", runningCount))
+	// 单镜像题目视为只有一个服务，多服务题目的全部服务作为一个整体部署
+	unit, err := services.ChallengeServices(challenge)
+	if err != nil {
+		utils.Error(c, 7007, "Invalid challenge service spec: "+err.Error())
 		return
 	}
 
-	var dynamicFlag string
-	for {
-		dynamicFlag = utils.GenerateDynamicFlag()
-		var count int64
-		database.DB.Model(&models.Container{}).Where("container_flag = ?", dynamicFlag).Count(&count)
-		if count == 0 {
-			break
-		}
+	// 禁止出网的题目依赖网关或代理转发，配置不满足时拒绝创建
+	if err := services.CheckNetworkRequirements(challenge, unit); err != nil {
+		utils.Error(c, 7006, "Challenge network policy is not supported by the current deployment: "+err.Error())
+		return
 	}
 
-	// 调用新的 CreateService 函数，它会返回 Service ID
-	serviceID, err := services.CreateService(challenge, team, dynamicFlag)
-	if err != nil {
-		utils.Error(c, 5000, "Docker API Error: "+err.Error())
+	// 资源限制、存活时间、并发数等取题目设置，未设置的项使用全局默认值
+	policy := services.InstancePolicyFor(challenge)
+
+	var runningCount int64
+	database.DB.Model(&models.Container{}).Where("team_id = ? AND state IN ?", team.ID, models.ActiveStates).Count(&runningCount)
+	if runningCount >= int64(policy.MaxPerTeam) {
+		utils.Error(c, 7001, fmt.Sprintf("Team already has %d running containers", runningCount))
 		return
 	}
 
+	// Flag 按题目模板生成，带有队伍水印，无需查库去重
+	dynamicFlag := services.GenerateTeamFlag(challenge, team.ID)
+
+	// 先以 pending 状态落库拿到容器 ID，实例标签中需要记录它以便对账
 	now := time.Now()
 	newContainer := models.Container{
-		DockerID:      serviceID, // 数据库中保存 Service ID
 		ChallengeID:   challenge.ID,
 		TeamID:        team.ID,
 		ContainerName: fmt.Sprintf("ctf-service-%d-%d", team.ID, challenge.ID),
-		DockerImage:   challenge.DockerImage,
+		DockerImage:   unit.Services[0].Image,
 		DockerPorts:   challenge.DockerPorts,
 		ContainerFlag: dynamicFlag,
-		State:         models.ContainerStateRunning,
+		State:         models.ContainerStatePending,
+		GatewayToken:  utils.GenerateGatewayToken(),
+		ProxyTicket:   utils.GenerateProxyTicket(),
 		StartTime:     now,
-		EndTime:       now.Add(1 * time.Hour),
+		EndTime:       now.Add(policy.Lifetime),
+		ContestID:     challenge.ContestID,
+	}
+	if unit.MultiService() {
+		newContainer.DockerPorts = unit.ExposedPorts()
 	}
 	if err := database.DB.Create(&newContainer).Error; err != nil {
-		_ = services.DestroyService(serviceID) // 如果数据库保存失败，则销毁服务
 		utils.Error(c, 5000, "Failed to save container record: "+err.Error())
 		return
 	}
 
-	// 获取 Swarm 服务的端口信息
-	serviceInfo, _, err := services.GetServiceInfo(serviceID)
+	// 通过编排后端启动全部服务，主服务（第一个服务）的实例 ID 保存在 DockerID 字段
+	deployed, err := services.LaunchChallengeUnit(c.Request.Context(), challenge, unit, team, newContainer)
+	if err != nil {
+		database.DB.Model(&newContainer).Update("state", models.ContainerStateDestroyed)
+		if errors.Is(err, services.ErrFlagNotReady) {
+			utils.Error(c, 7008, "Flag injection could not be verified: "+err.Error())
+			return
+		}
+		utils.Error(c, 5000, "Docker API Error: "+err.Error())
+		return
+	}
+	primary := deployed[0].Instance
+
+	// 连接地址在创建时落库，之后的列表和详情接口直接返回
+	endpoints := services.BuildEndpoints(challenge, newContainer, deployed)
+	err = database.DB.Model(&newContainer).Updates(models.Container{
+		DockerID:      primary.ID,
+		ContainerName: primary.Name,
+		State:         models.ContainerStateRunning,
+		Endpoints:     endpoints,
+	}).Error
+	if err == nil {
+		err = services.SaveUnitInstances(newContainer.ID, deployed)
+	}
 	if err != nil {
-		log.Printf("Warning: failed to inspect service %s to get port mapping: %v", serviceID, err)
-		utils.Error(c, 5000, "Container started but failed to get connection info.")
+		services.DestroyDeployed(context.Background(), newContainer.ID, deployed) // 如果数据库保存失败，则销毁全部实例
+		utils.Error(c, 5000, "Failed to save container record: "+err.Error())
 		return
 	}
 
 	connectionInfo := make(map[string]string)
-	// =================================================================================
-	// [重要] 请将这里的 IP 地址替换为您的 Docker Swarm 集群任一节点的公网或内网 IP
-	// =================================================================================
-	swarmNodeIP := "127.0.0.1"
-	for _, port := range serviceInfo.Endpoint.Ports {
-		connectionInfo[strconv.Itoa(int(port.TargetPort))] = fmt.Sprintf("%s:%d", swarmNodeIP, port.PublishedPort)
+	for _, ep := range endpoints {
+		connectionInfo[strconv.Itoa(int(ep.TargetPort))] = ep.Address
 	}
 
 	utils.Success(c, "Container created successfully", gin.H{
 		"container_id":    newContainer.ID,
 		"connection_info": connectionInfo,
+		"endpoints":       endpoints,
 		"end_time":        newContainer.EndTime.Format("2006-01-02 15:04:05"),
 	})
 }
@@ -158,19 +187,112 @@ func DestroyContainer(c *gin.Context) {
 		return
 	}
 
-	// 即使容器已停止或销毁，也尝试清理，并更新数据库状态
-	if container.State == models.ContainerStateRunning {
-		if err := services.DestroyService(container.DockerID); err != nil {
+	// 实例仍存在的容器走统一的释放流程，其余状态只更新数据库
+	if container.State == models.ContainerStateRunning || container.State == models.ContainerStateStopped {
+		if _, err := services.ReleaseContainer(c.Request.Context(), &container); err != nil {
 			fmt.Printf("Warning: failed to destroy docker service %s: %v\n", container.DockerID, err)
 		}
+	} else {
+		container.State = models.ContainerStateDestroyed
+		database.DB.Save(&container)
 	}
 
-	container.State = models.ContainerStateDestroyed
-	database.DB.Save(&container)
-
 	utils.Success(c, "Container destroyed successfully", nil)
 }
 
+// ContainerInfo 是选手侧容器列表和详情的返回结构
+type ContainerInfo struct {
+	ContainerID   uint32                     `json:"container_id"`
+	ChallengeID   uint32                     `json:"challenge_id"`
+	ChallengeName string                     `json:"challenge_name"`
+	State         string                     `json:"state"`
+	DockerPorts   string                     `json:"docker_ports"`
+	Endpoints     []models.ContainerEndpoint `json:"endpoints"`
+	EndTime       string                     `json:"end_time"`
+	RestartCount  uint                       `json:"restart_count"`
+}
+
+// activeEndpoints 只为实例仍存在的容器返回连接地址
+func activeEndpoints(container models.Container) []models.ContainerEndpoint {
+	if container.State != models.ContainerStateRunning && container.State != models.ContainerStateStopped {
+		return []models.ContainerEndpoint{}
+	}
+	if container.Endpoints == nil {
+		return []models.ContainerEndpoint{}
+	}
+	return container.Endpoints
+}
+
+// loadViewableContainer 读取路径中的容器，非管理员只能访问本队容器；失败时已写入响应
+func loadViewableContainer(c *gin.Context) (models.Container, bool) {
+	containerID, _ := strconv.Atoi(c.Param("id"))
+
+	userIDAny, _ := c.Get("user_id")
+	userID := userIDAny.(uint32)
+	roleAny, _ := c.Get("user_role")
+	userRole := roleAny.(models.UserRole)
+
+	var container models.Container
+	if err := database.DB.First(&container, containerID).Error; err != nil {
+		utils.Error(c, 4004, "容器不存在")
+		return container, false
+	}
+
+	if userRole != models.RoleAdmin && userRole != models.RoleRootAdmin {
+		var userTeam models.TeamMember
+		if err := database.DB.Where("user_id = ?", userID).First(&userTeam).Error; err != nil || userTeam.TeamID != container.TeamID {
+			utils.Error(c, 403, "Permission denied: you can only view your own team's containers")
+			return container, false
+		}
+	}
+	return container, true
+}
+
+// GetContainer 查询本队单个容器的详情和连接地址
+func GetContainer(c *gin.Context) {
+	container, ok := loadViewableContainer(c)
+	if !ok {
+		return
+	}
+
+	var chal models.Challenge
+	database.DB.Select("challenge_name").First(&chal, container.ChallengeID)
+	utils.Success(c, "success", ContainerInfo{
+		ContainerID:   container.ID,
+		ChallengeID:   container.ChallengeID,
+		ChallengeName: chal.ChallengeName,
+		State:         string(container.State),
+		DockerPorts:   container.DockerPorts,
+		Endpoints:     activeEndpoints(container),
+		EndTime:       container.EndTime.Format("2006-01-02 15:04:05"),
+		RestartCount:  container.RestartCount,
+	})
+}
+
+// GetContainerAccess 返回通过 HTTP 网关访问容器的链接。
+// 开启队伍 Cookie 时链接中带有一分钟内有效的凭证，打开后由网关换成只对该子域名有效的 Cookie
+func GetContainerAccess(c *gin.Context) {
+	container, ok := loadViewableContainer(c)
+	if !ok {
+		return
+	}
+	if container.State != models.ContainerStateRunning {
+		utils.Error(c, 7003, "Container is not running")
+		return
+	}
+
+	accessURL, err := services.GatewayAccessURL(container)
+	if err != nil {
+		if errors.Is(err, services.ErrGatewayTargetNotFound) {
+			utils.Error(c, 7005, "This container is not served through the HTTP gateway")
+			return
+		}
+		utils.Error(c, 5000, "Failed to issue access link: "+err.Error())
+		return
+	}
+	utils.Success(c, "success", gin.H{"url": accessURL})
+}
+
 // ListContainers 查询队伍容器列表
 func ListContainers(c *gin.Context) {
 	teamIDStr := c.Query("team_id")
@@ -180,27 +302,23 @@ func ListContainers(c *gin.Context) {
 	}
 	teamID, _ := strconv.Atoi(teamIDStr)
 
+	// 连接地址中含有代理票据，非管理员只能查询本队容器
+	userIDAny, _ := c.Get("user_id")
+	roleAny, _ := c.Get("user_role")
+	if userRole := roleAny.(models.UserRole); userRole != models.RoleAdmin && userRole != models.RoleRootAdmin {
+		var userTeam models.TeamMember
+		if err := database.DB.Where("user_id = ?", userIDAny.(uint32)).First(&userTeam).Error; err != nil || int(userTeam.TeamID) != teamID {
+			utils.Error(c, 403, "Permission denied: you can only view your own team's containers")
+			return
+		}
+	}
+
 	var containers []models.Container
 	database.DB.Where("team_id = ?", teamID).Find(&containers)
 
-	type ContainerInfo struct {
-		ContainerID   uint32 `json:"container_id"`
-		ChallengeID   uint32 `json:"challenge_id"`
-		ChallengeName string `json:"challenge_name"`
-		State         string `json:"state"`
-		DockerPorts   string `json:"docker_ports"`
-		EndTime       string `json:"end_time"`
-	}
-
+	// 容器状态由事件监听和对账任务维护，这里只读数据库
 	var result []ContainerInfo
 	for i := range containers {
-		if containers[i].State == models.ContainerStateRunning {
-			if !services.IsServiceRunning(containers[i].DockerID) {
-				containers[i].State = models.ContainerStateDestroyed
-				database.DB.Save(&containers[i])
-			}
-		}
-
 		var chal models.Challenge
 		database.DB.Select("challenge_name").First(&chal, containers[i].ChallengeID)
 		result = append(result, ContainerInfo{
@@ -209,7 +327,9 @@ func ListContainers(c *gin.Context) {
 			ChallengeName: chal.ChallengeName,
 			State:         string(containers[i].State),
 			DockerPorts:   containers[i].DockerPorts,
+			Endpoints:     activeEndpoints(containers[i]),
 			EndTime:       containers[i].EndTime.Format("2006-01-02 15:04:05"),
+			RestartCount:  containers[i].RestartCount,
 		})
 	}
 
@@ -218,43 +338,79 @@ func ListContainers(c *gin.Context) {
 
 // RenewContainer 续期容器
 func RenewContainer(c *gin.Context) {
-	containerID, _ := strconv.Atoi(c.Param("id"))
-
-	var container models.Container
-	if err := database.DB.First(&container, containerID).Error; err != nil {
+	// 只能续期本队的容器，管理员不受限制
+	container, ok := loadViewableContainer(c)
+	if !ok {
+		return
+	}
+	if container.ContestID != requestContestID(c) {
 		utils.Error(c, 4004, "容器不存在")
 		return
 	}
 
-	if container.ExtendedCount >= 3 {
+	var challenge models.Challenge
+	if err := database.DB.First(&challenge, container.ChallengeID).Error; err != nil {
+		utils.Error(c, 4004, "题目不存在")
+		return
+	}
+	// 续期次数和每次延长的时间由题目策略决定，不再由客户端指定
+	policy := services.InstancePolicyFor(challenge)
+
+	if container.ExtendedCount >= policy.MaxRenewals {
 		utils.Error(c, 7002, "Renewal limit reached")
 		return
 	}
-	if container.State != models.ContainerStateRunning {
+	renewable := []models.ContainerState{models.ContainerStateRunning, models.ContainerStateStopped}
+	if !slices.Contains(renewable, container.State) {
 		utils.Error(c, 7003, "Container is not running")
 		return
 	}
 
-	var req struct {
-		ExtraMinutes uint `json:"extra_minutes"`
+	// 条件更新：回收器可能已在读取之后销毁容器，并发的续期请求也只有一个能基于同一续期次数生效
+	endTime := container.EndTime.Add(policy.RenewalStep)
+	result := database.DB.Model(&models.Container{}).
+		Where("id = ? AND state IN ? AND extended_count = ?", container.ID, renewable, container.ExtendedCount).
+		Updates(map[string]interface{}{
+			"end_time":         endTime,
+			"extended_count":   gorm.Expr("extended_count + 1"),
+			"expiry_warned_at": nil, // 续期后重新提醒
+		})
+	if result.Error != nil {
+		utils.Error(c, 5000, "续期失败: "+result.Error.Error())
+		return
 	}
-	_ = c.ShouldBindJSON(&req)
-	if req.ExtraMinutes == 0 {
-		req.ExtraMinutes = 30
+	if result.RowsAffected == 0 {
+		utils.Error(c, 7003, "Container is not running or was renewed concurrently")
+		return
 	}
 
-	container.EndTime = container.EndTime.Add(time.Duration(req.ExtraMinutes) * time.Minute)
-	container.ExtendedCount++
-
-	database.DB.Save(&container)
-
 	utils.Success(c, "Container renewed successfully", gin.H{
 		"container_id":   container.ID,
-		"end_time":       container.EndTime.Format("2006-01-02 15:04:05"),
-		"extended_count": container.ExtendedCount,
+		"end_time":       endTime.Format("2006-01-02 15:04:05"),
+		"extended_count": container.ExtendedCount + 1,
+		"max_renewals":   policy.MaxRenewals,
 	})
 }
 
+// ListContainerNotices 查询并清空本队的容器提醒（到期提醒、已过期销毁等）
+func ListContainerNotices(c *gin.Context) {
+	userIDAny, _ := c.Get("user_id")
+	userID := userIDAny.(uint32)
+
+	var userTeam models.TeamMember
+	if err := database.DB.Where("user_id = ?", userID).First(&userTeam).Error; err != nil {
+		utils.Error(c, 3005, "你尚未加入任何队伍")
+		return
+	}
+
+	notices, err := services.PopTeamNotices(userTeam.TeamID)
+	if err != nil {
+		utils.Error(c, 5000, "Failed to load notices: "+err.Error())
+		return
+	}
+	utils.Success(c, "success", notices)
+}
+
 // GetPcapLog 管理员查询抓包日志
 func GetPcapLog(c *gin.Context) {
 	containerID, _ := strconv.Atoi(c.Param("id"))
@@ -272,6 +428,93 @@ func GetPcapLog(c *gin.Context) {
 	})
 }
 
+// AdminGetContainer 管理员查询容器详情，包括最近的编排事件、退出码和失败原因
+func AdminGetContainer(c *gin.Context) {
+	containerID, _ := strconv.Atoi(c.Param("id"))
+
+	var container models.Container
+	if err := database.DB.First(&container, containerID).Error; err != nil {
+		utils.Error(c, 4004, "容器不存在")
+		return
+	}
+
+	// 多服务题目的各服务实例
+	var instances []models.ContainerInstance
+	database.DB.Where("container_id = ?", container.ID).Order("id").Find(&instances)
+	type ServiceInstanceInfo struct {
+		Service      string `json:"service"`
+		InstanceID   string `json:"instance_id"`
+		InstanceName string `json:"instance_name"`
+	}
+	serviceList := make([]ServiceInstanceInfo, 0, len(instances))
+	for _, inst := range instances {
+		serviceList = append(serviceList, ServiceInstanceInfo{Service: inst.Service, InstanceID: inst.InstanceID, InstanceName: inst.InstanceName})
+	}
+
+	var lastEventAt *string
+	if container.LastEventAt != nil {
+		formatted := container.LastEventAt.Format("2006-01-02 15:04:05")
+		lastEventAt = &formatted
+	}
+	utils.Success(c, "success", gin.H{
+		"container_id":   container.ID,
+		"team_id":        container.TeamID,
+		"challenge_id":   container.ChallengeID,
+		"instance_id":    container.DockerID,
+		"container_name": container.ContainerName,
+		"docker_image":   container.DockerImage,
+		"state":          container.State,
+		"endpoints":      container.Endpoints,
+		"services":       serviceList,
+		"start_time":     container.StartTime.Format("2006-01-02 15:04:05"),
+		"end_time":       container.EndTime.Format("2006-01-02 15:04:05"),
+		"extended_count": container.ExtendedCount,
+		"restart_count":  container.RestartCount,
+		"last_event":     container.LastEvent,
+		"last_event_at":  lastEventAt,
+		"last_exit_code": container.LastExitCode,
+		"failure_reason": container.FailureReason,
+	})
+}
+
+// AdminListContainerConnections 管理员查询经 TCP 代理建立的连接记录
+func AdminListContainerConnections(c *gin.Context) {
+	containerID, _ := strconv.Atoi(c.Param("id"))
+
+	var connections []models.ContainerConnection
+	if err := database.DB.Where("container_id = ?", containerID).Order("id desc").Limit(500).Find(&connections).Error; err != nil {
+		utils.Error(c, 5000, "Database error while fetching connections")
+		return
+	}
+
+	type ConnectionInfo struct {
+		RemoteAddr string  `json:"remote_addr"`
+		TeamID     uint32  `json:"team_id"`
+		TargetPort uint32  `json:"target_port"`
+		StartedAt  string  `json:"started_at"`
+		EndedAt    *string `json:"ended_at"`
+		BytesIn    int64   `json:"bytes_in"`
+		BytesOut   int64   `json:"bytes_out"`
+	}
+	result := make([]ConnectionInfo, 0, len(connections))
+	for _, conn := range connections {
+		info := ConnectionInfo{
+			RemoteAddr: conn.RemoteAddr,
+			TeamID:     conn.TeamID,
+			TargetPort: conn.TargetPort,
+			StartedAt:  conn.StartedAt.Format("2006-01-02 15:04:05"),
+			BytesIn:    conn.BytesIn,
+			BytesOut:   conn.BytesOut,
+		}
+		if conn.EndedAt != nil {
+			ended := conn.EndedAt.Format("2006-01-02 15:04:05")
+			info.EndedAt = &ended
+		}
+		result = append(result, info)
+	}
+	utils.Success(c, "success", result)
+}
+
 // AdminDestroyContainer 管理员强制销毁容器
 func AdminDestroyContainer(c *gin.Context) {
 	containerID, _ := strconv.Atoi(c.Param("id"))
@@ -292,16 +535,40 @@ func AdminDestroyContainer(c *gin.Context) {
 		return
 	}
 
-	if container.State == models.ContainerStateRunning {
-		if err := services.DestroyService(container.DockerID); err != nil {
+	if container.State == models.ContainerStateRunning || container.State == models.ContainerStateStopped {
+		if _, err := services.ReleaseContainer(c.Request.Context(), &container); err != nil {
 			// 记录警告，但不阻塞流程，因为容器可能已被手动删除
 			fmt.Printf("Warning: failed to destroy docker service %s by admin: %v\n", container.DockerID, err)
 		}
+	} else {
+		// 更新数据库状态
+		container.State = models.ContainerStateDestroyed
+		database.DB.Save(&container)
 	}
 
-	// 更新数据库状态
-	container.State = models.ContainerStateDestroyed
-	database.DB.Save(&container)
-
 	utils.Success(c, "Container destroyed successfully by admin", nil)
 }
+
+// GetContainerDrift 管理员查询最近一次容器对账结果，run=1 时立即执行一次对账
+func GetContainerDrift(c *gin.Context) {
+	if c.Query("run") == "1" {
+		report, err := services.ReconcileContainers(c.Request.Context(), config.C.Container.PendingGrace)
+		if err != nil {
+			utils.Error(c, 5000, "Reconcile failed: "+err.Error())
+			return
+		}
+		utils.Success(c, "success", report)
+		return
+	}
+
+	report, err := services.LastDriftReport()
+	if err != nil {
+		utils.Error(c, 5000, "Failed to load drift report: "+err.Error())
+		return
+	}
+	if report == nil {
+		utils.Error(c, 404, "No reconciliation has run yet")
+		return
+	}
+	utils.Success(c, "success", report)
+}
@@ -4,22 +4,68 @@ package controllers
 import (
 	"ISCTF/database"
 	"ISCTF/models"
+	"ISCTF/services"
 	"ISCTF/utils"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"log"
 	"strconv"
 	"time"
 )
 
+// contestUpdateColumns 是管理员可以修改的比赛字段
+var contestUpdateColumns = []string{"contest_name", "cover_image", "description", "start_time", "end_time", "organizer_url", "freeze_time", "practice_mode"}
+
 // GetCurrentContest 查询当前比赛基本信息
 func GetCurrentContest(c *gin.Context) {
-	var contest models.Contest
-	// 假设我们总是查询 ID 为 1 的比赛作为当前比赛
-	if err := database.DB.First(&contest, 1).Error; err != nil {
+	contest, err := services.CurrentContest()
+	if err != nil {
 		utils.Error(c, 404, "No active contest found")
 		return
 	}
+	contestDetail(c, contest)
+}
+
+// GetContest 查询指定比赛的基本信息，往届比赛同样可以查看
+func GetContest(c *gin.Context) {
+	contest, ok := loadContestParam(c)
+	if !ok {
+		return
+	}
+	contestDetail(c, contest)
+}
+
+// ListContests 查询全部比赛，按开始时间倒序
+func ListContests(c *gin.Context) {
+	var contests []models.Contest
+	if err := database.DB.Order("start_time DESC").Find(&contests).Error; err != nil {
+		utils.Error(c, 5000, "查询失败")
+		return
+	}
 
+	now := time.Now()
+	items := make([]gin.H, 0, len(contests))
+	for _, contest := range contests {
+		items = append(items, gin.H{
+			"contest_id":   contest.ID,
+			"contest_name": contest.ContestName,
+			"cover_image":  contest.CoverImage,
+			"start_time":   contest.StartTime.Format("2006-01-02 15:04:05"),
+			"end_time":     contest.EndTime.Format("2006-01-02 15:04:05"),
+			"status":       contest.Phase(now),
+			"is_current":   contest.IsCurrent,
+		})
+	}
+	utils.Success(c, "success", gin.H{
+		"total":    len(items),
+		"contests": items,
+	})
+}
+
+// contestDetail 返回比赛基本信息及其参赛学校和赞助商
+func contestDetail(c *gin.Context, contest *models.Contest) {
 	// 查询关联的学校
 	type SchoolInfo struct {
 		SchoolName string `json:"school_name"`
@@ -36,16 +82,8 @@ func GetCurrentContest(c *gin.Context) {
 	var sponsors []models.ContestSponsor
 	database.DB.Where("contest_id = ?", contest.ID).Find(&sponsors)
 
-	// 自动计算并更新比赛状态
-	now := time.Now()
-	var currentStatus models.ContestStatus
-	if now.Before(contest.StartTime) {
-		currentStatus = models.ContestStatusPreparing
-	} else if now.After(contest.EndTime) {
-		currentStatus = models.ContestStatusEnded
-	} else {
-		currentStatus = models.ContestStatusRunning
-	}
+	// 比赛状态按时间实时计算
+	currentStatus := contest.Phase(time.Now())
 
 	utils.Success(c, "success", gin.H{
 		"contest_id":    contest.ID,
@@ -54,6 +92,10 @@ func GetCurrentContest(c *gin.Context) {
 		"description":   contest.Description,
 		"start_time":    contest.StartTime.Format("2006-01-02 15:04:05"),
 		"end_time":      contest.EndTime.Format("2006-01-02 15:04:05"),
+		"freeze_time":   formatOptionalTime(contest.FreezeTime),
+		"practice_mode": contest.PracticeMode,
+		"revealed_at":   formatOptionalTime(contest.RevealedAt),
+		"is_current":    contest.IsCurrent,
 		"organizer_url": contest.OrganizerURL,
 		"status":        currentStatus,
 		"schools":       schools,
@@ -61,57 +103,390 @@ func GetCurrentContest(c *gin.Context) {
 	})
 }
 
-// GetContestStatus 查询比赛状态和剩余时间
+// GetContestStatus 查询当前比赛状态和剩余时间
 func GetContestStatus(c *gin.Context) {
-	var contest models.Contest
-	if err := database.DB.First(&contest, 1).Error; err != nil {
+	contest, err := services.CurrentContest()
+	if err != nil {
 		utils.Error(c, 404, "No active contest found")
 		return
 	}
 
 	now := time.Now()
-	var status models.ContestStatus
+	status := contest.Phase(now)
 	var remainingTime string
-
-	if now.Before(contest.StartTime) {
-		status = models.ContestStatusPreparing
+	switch status {
+	case models.ContestStatusPreparing:
 		remainingTime = contest.StartTime.Sub(now).Round(time.Second).String()
-	} else if now.After(contest.EndTime) {
-		status = models.ContestStatusEnded
-		remainingTime = "0s"
-	} else {
-		status = models.ContestStatusRunning
+	case models.ContestStatusRunning, models.ContestStatusFrozen:
 		remainingTime = contest.EndTime.Sub(now).Round(time.Second).String()
+	default:
+		remainingTime = "0s"
 	}
 
 	utils.Success(c, "success", gin.H{
+		"contest_id":     contest.ID,
 		"status":         status,
 		"now":            now.Format("2006-01-02 15:04:05"),
 		"remaining_time": remainingTime,
 	})
 }
 
+// RegisterContest 队长为队伍报名比赛，比赛结束前均可报名
+func RegisterContest(c *gin.Context) {
+	contest, ok := loadContestParam(c)
+	if !ok {
+		return
+	}
+	team, ok := loadLeaderTeam(c)
+	if !ok {
+		return
+	}
+	if team.TeamStatus == models.TeamStatusBanned {
+		utils.Error(c, 4003, "队伍已被封禁，无法报名")
+		return
+	}
+	if !time.Now().Before(contest.EndTime) {
+		utils.Error(c, 8002, "比赛已结束")
+		return
+	}
+
+	reg := models.ContestTeam{ContestID: contest.ID, TeamID: team.ID}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&reg).Error; err != nil {
+		utils.Error(c, 5000, "报名失败: "+err.Error())
+		return
+	}
+	utils.Success(c, "Registered successfully", gin.H{"contest_id": contest.ID, "team_id": team.ID})
+}
+
+// WithdrawContest 队长在比赛开始前取消报名
+func WithdrawContest(c *gin.Context) {
+	contest, ok := loadContestParam(c)
+	if !ok {
+		return
+	}
+	team, ok := loadLeaderTeam(c)
+	if !ok {
+		return
+	}
+	if !time.Now().Before(contest.StartTime) {
+		utils.Error(c, 8003, "比赛开始后不能取消报名")
+		return
+	}
+
+	if err := database.DB.Where("contest_id = ? AND team_id = ?", contest.ID, team.ID).Delete(&models.ContestTeam{}).Error; err != nil {
+		utils.Error(c, 5000, "取消报名失败: "+err.Error())
+		return
+	}
+	utils.Success(c, "Registration withdrawn", nil)
+}
+
+// loadContestParam 按路径参数 id 读取比赛，失败时已写入响应
+func loadContestParam(c *gin.Context) (*models.Contest, bool) {
+	var contest models.Contest
+	if err := database.DB.First(&contest, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.Error(c, 4004, "比赛不存在")
+		} else {
+			utils.Error(c, 5000, "查询失败")
+		}
+		return nil, false
+	}
+	return &contest, true
+}
+
+// loadLeaderTeam 读取当前用户担任队长的队伍，失败时已写入响应
+func loadLeaderTeam(c *gin.Context) (*models.Team, bool) {
+	userIDAny, _ := c.Get("user_id")
+	userID := userIDAny.(uint32)
+
+	var userTeam models.TeamMember
+	if err := database.DB.Where("user_id = ?", userID).First(&userTeam).Error; err != nil {
+		utils.Error(c, 3005, "你尚未加入任何队伍")
+		return nil, false
+	}
+	var team models.Team
+	if err := database.DB.First(&team, userTeam.TeamID).Error; err != nil {
+		utils.Error(c, 5000, "查询队伍失败")
+		return nil, false
+	}
+	if team.LeaderID != userID {
+		utils.Error(c, 4003, "权限不足，只有队长可以为队伍报名")
+		return nil, false
+	}
+	return &team, true
+}
+
+// requestContestID 返回 ContestGate 解析出的比赛 ID，平台未启用比赛时为 0
+func requestContestID(c *gin.Context) uint {
+	if v, ok := c.Get("contest"); ok {
+		return v.(*models.Contest).ID
+	}
+	return 0
+}
+
+// formatOptionalTime 格式化可为空的时间，为空时返回 nil
+func formatOptionalTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// validateContest 检查比赛的时间设置，返回空字符串表示通过
+func validateContest(contest *models.Contest) string {
+	if !contest.EndTime.After(contest.StartTime) {
+		return "结束时间必须晚于开始时间"
+	}
+	if contest.FreezeTime != nil && (contest.FreezeTime.Before(contest.StartTime) || contest.FreezeTime.After(contest.EndTime)) {
+		return "封榜时间必须在比赛时间范围内"
+	}
+	return ""
+}
+
 // --- 管理员接口 ---
 
-// UpsertContest 创建或修改比赛信息
+// CreateContest 创建比赛，平台还没有当前比赛时新比赛成为当前比赛
+func CreateContest(c *gin.Context) {
+	var req models.Contest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 1001, "参数无效: "+err.Error())
+		return
+	}
+	if msg := validateContest(&req); msg != "" {
+		utils.Error(c, 1001, msg)
+		return
+	}
+
+	req.ID = 0
+	req.RevealedAt = nil
+	req.IsCurrent = false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&req).Error; err != nil {
+			return err
+		}
+		var current int64
+		if err := tx.Model(&models.Contest{}).Where("is_current = ?", true).Count(&current).Error; err != nil {
+			return err
+		}
+		if current == 0 {
+			req.IsCurrent = true
+			return services.SwitchCurrentContest(tx, req.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		utils.Error(c, 5000, "Failed to create contest: "+err.Error())
+		return
+	}
+	utils.Success(c, "Contest created successfully", gin.H{"id": req.ID, "is_current": req.IsCurrent})
+}
+
+// UpdateContest 修改指定比赛的信息
+func UpdateContest(c *gin.Context) {
+	contest, ok := loadContestParam(c)
+	if !ok {
+		return
+	}
+	var req models.Contest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 1001, "参数无效: "+err.Error())
+		return
+	}
+	if msg := validateContest(&req); msg != "" {
+		utils.Error(c, 1001, msg)
+		return
+	}
+
+	if err := database.DB.Model(contest).Select(contestUpdateColumns).Updates(&req).Error; err != nil {
+		utils.Error(c, 5000, "Failed to update contest: "+err.Error())
+		return
+	}
+
+	// 封榜时间可能变化，重新生成封榜排行榜
+	go services.UpdateScoreboardCache(contest.ID)
+
+	utils.Success(c, "Contest updated successfully", nil)
+}
+
+// SwitchContest 切换当前比赛，未指定比赛的接口随之作用于新的当前比赛
+func SwitchContest(c *gin.Context) {
+	contest, ok := loadContestParam(c)
+	if !ok {
+		return
+	}
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return services.SwitchCurrentContest(tx, contest.ID)
+	}); err != nil {
+		utils.Error(c, 5000, "切换比赛失败: "+err.Error())
+		return
+	}
+	services.ClearScoreboardCache()
+
+	log.Printf("Current contest switched to %d (%s)", contest.ID, contest.ContestName)
+	utils.Success(c, "Current contest switched", gin.H{"contest_id": contest.ID})
+}
+
+// UpsertContest 创建或修改当前比赛的信息，没有当前比赛时创建一场并设为当前比赛
 func UpsertContest(c *gin.Context) {
 	var req models.Contest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.Error(c, 1001, "参数无效: "+err.Error())
 		return
 	}
+	if msg := validateContest(&req); msg != "" {
+		utils.Error(c, 1001, msg)
+		return
+	}
 
-	// 使用 GORM 的 Upsert 功能，存在则更新，不存在则创建 (ID=1)
-	req.ID = 1
-	if err := database.DB.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "id"}},
-		DoUpdates: clause.AssignmentColumns([]string{"contest_name", "cover_image", "description", "start_time", "end_time", "organizer_url"}),
-	}).Create(&req).Error; err != nil {
+	req.RevealedAt = nil
+	current, err := services.CurrentContest()
+	switch {
+	case err == nil:
+		err = database.DB.Model(current).Select(contestUpdateColumns).Updates(&req).Error
+		req.ID = current.ID
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		req.ID = 0
+		req.IsCurrent = true
+		err = database.DB.Create(&req).Error
+	}
+	if err != nil {
 		utils.Error(c, 5000, "Failed to create/update contest: "+err.Error())
 		return
 	}
 
-	utils.Success(c, "Contest created/updated successfully", nil)
+	// 封榜时间可能变化，重新生成封榜排行榜
+	go services.UpdateScoreboardCache(req.ID)
+
+	utils.Success(c, "Contest created/updated successfully", gin.H{"id": req.ID})
+}
+
+// RevealScoreboard 比赛结束后揭晓排行榜，公众从此看到实时排名；未指定比赛时揭晓当前比赛
+func RevealScoreboard(c *gin.Context) {
+	var contest *models.Contest
+	if c.Param("id") != "" {
+		var ok bool
+		if contest, ok = loadContestParam(c); !ok {
+			return
+		}
+	} else {
+		var err error
+		if contest, err = services.CurrentContest(); err != nil {
+			utils.Error(c, 404, "No active contest found")
+			return
+		}
+	}
+	if contest.FreezeTime == nil {
+		utils.Error(c, 1001, "比赛未设置封榜")
+		return
+	}
+	now := time.Now()
+	if now.Before(contest.EndTime) {
+		utils.Error(c, 8004, "比赛结束后才能揭晓排行榜")
+		return
+	}
+	if contest.RevealedAt != nil {
+		utils.Error(c, 8006, "排行榜已揭晓")
+		return
+	}
+
+	if err := database.DB.Model(contest).Update("revealed_at", now).Error; err != nil {
+		utils.Error(c, 5000, "揭晓排行榜失败: "+err.Error())
+		return
+	}
+	services.ClearScoreboardCache()
+
+	utils.Success(c, "Scoreboard revealed", gin.H{"revealed_at": now.Format("2006-01-02 15:04:05")})
+}
+
+// RescoreContest 按各题当前的计分方式重算比赛全部题目的解题得分并刷新排行榜
+func RescoreContest(c *gin.Context) {
+	contest, ok := loadContestParam(c)
+	if !ok {
+		return
+	}
+	var ids []uint32
+	if err := database.DB.Model(&models.Challenge{}).Where("contest_id = ?", contest.ID).Pluck("id", &ids).Error; err != nil {
+		utils.Error(c, 5000, "查询题目失败: "+err.Error())
+		return
+	}
+	for _, id := range ids {
+		if err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return services.RescoreChallenge(tx, id)
+		}); err != nil {
+			utils.Error(c, 5000, "重算分值失败: "+err.Error())
+			return
+		}
+		clearChallengeDetailCache(id)
+	}
+	services.UpdateScoreboardCache(contest.ID)
+
+	utils.Success(c, "Contest rescored", gin.H{"challenges": len(ids)})
+}
+
+// ListContestTeams 查询报名比赛的队伍
+func ListContestTeams(c *gin.Context) {
+	contest, ok := loadContestParam(c)
+	if !ok {
+		return
+	}
+	type TeamInfo struct {
+		TeamID       uint32    `json:"team_id"`
+		TeamName     string    `json:"team_name"`
+		Track        string    `json:"track"`
+		TeamStatus   string    `json:"team_status"`
+		RegisteredAt time.Time `json:"registered_at"`
+	}
+	var teams []TeamInfo
+	if err := database.DB.Table("dalictf_contest_teams ct").
+		Select("ct.team_id, t.team_name, t.track, t.team_status, ct.created_at AS registered_at").
+		Joins("JOIN dalictf_team t ON ct.team_id = t.id").
+		Where("ct.contest_id = ?", contest.ID).
+		Order("ct.id").
+		Scan(&teams).Error; err != nil {
+		utils.Error(c, 5000, "查询失败: "+err.Error())
+		return
+	}
+	utils.Success(c, "success", gin.H{"total": len(teams), "teams": teams})
+}
+
+// AddContestTeam 管理员为队伍报名比赛
+func AddContestTeam(c *gin.Context) {
+	contest, ok := loadContestParam(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		TeamID uint32 `json:"team_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 1001, "参数无效: "+err.Error())
+		return
+	}
+	var team models.Team
+	if err := database.DB.First(&team, req.TeamID).Error; err != nil {
+		utils.Error(c, 4004, "队伍不存在")
+		return
+	}
+
+	reg := models.ContestTeam{ContestID: contest.ID, TeamID: team.ID}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&reg).Error; err != nil {
+		utils.Error(c, 5000, "报名失败: "+err.Error())
+		return
+	}
+	utils.Success(c, "Team registered successfully", nil)
+}
+
+// RemoveContestTeam 管理员取消队伍的报名，已有的解题记录保留
+func RemoveContestTeam(c *gin.Context) {
+	contest, ok := loadContestParam(c)
+	if !ok {
+		return
+	}
+	if err := database.DB.Where("contest_id = ? AND team_id = ?", contest.ID, c.Param("team_id")).Delete(&models.ContestTeam{}).Error; err != nil {
+		utils.Error(c, 5000, "取消报名失败: "+err.Error())
+		return
+	}
+	utils.Success(c, "Team registration removed", nil)
 }
 
 // AddContestSchool 为比赛添加参赛学校
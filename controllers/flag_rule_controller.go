@@ -0,0 +1,259 @@
+// file: controllers/flag_rule_controller.go
+package controllers
+
+import (
+	"ISCTF/database"
+	"ISCTF/dto"
+	"ISCTF/models"
+	"ISCTF/services"
+	"ISCTF/utils"
+	"github.com/gin-gonic/gin"
+	"log"
+	"strconv"
+	"time"
+)
+
+// ListFlagRules —— 管理员查看题目的 Flag 规则
+func ListFlagRules(c *gin.Context) {
+	challengeID, _ := strconv.Atoi(c.Param("id"))
+
+	var rules []models.FlagRule
+	if err := database.DB.Where("challenge_id = ?", challengeID).Order("sort_order ASC, id ASC").Find(&rules).Error; err != nil {
+		utils.Error(c, 5000, "查询失败")
+		return
+	}
+	utils.Success(c, "success", flagRuleResps(rules))
+}
+
+// AddFlagRule —— 管理员为静态题目添加 Flag 规则
+func AddFlagRule(c *gin.Context) {
+	challengeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.Error(c, 1002, "无效的题目ID")
+		return
+	}
+
+	var req dto.FlagRuleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 1001, "参数无效: "+err.Error())
+		return
+	}
+	if err := services.ValidateFlagRule(models.FlagRuleKind(req.Kind), req.Pattern); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
+
+	var challenge models.Challenge
+	if err := database.DB.First(&challenge, challengeID).Error; err != nil {
+		utils.Error(c, 4004, "题目不存在")
+		return
+	}
+	if challenge.Mode != models.ChallengeModeStatic {
+		utils.Error(c, 1001, "只有静态题目可以设置 Flag 规则")
+		return
+	}
+	if hasChallengeParts(challenge.ID) {
+		utils.Error(c, 1001, "多阶段题目请在各部分中设置 Flag")
+		return
+	}
+
+	pattern, err := utils.EncryptFlag(req.Pattern)
+	if err != nil {
+		utils.Error(c, 5000, "加密 Flag 规则失败: "+err.Error())
+		return
+	}
+	rule := models.FlagRule{
+		ChallengeID: challenge.ID,
+		Kind:        models.FlagRuleKind(req.Kind),
+		Pattern:     pattern,
+		SortOrder:   req.SortOrder,
+	}
+	if err := database.DB.Create(&rule).Error; err != nil {
+		utils.Error(c, 5000, "添加 Flag 规则失败: "+err.Error())
+		return
+	}
+	utils.Success(c, "Flag rule created successfully", gin.H{"rule_id": rule.ID})
+}
+
+// UpdateFlagRule —— 管理员修改 Flag 规则
+func UpdateFlagRule(c *gin.Context) {
+	ruleID, err := strconv.Atoi(c.Param("rule_id"))
+	if err != nil {
+		utils.Error(c, 1002, "无效的规则ID")
+		return
+	}
+
+	var req dto.UpdateFlagRuleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 1001, "参数无效: "+err.Error())
+		return
+	}
+
+	var rule models.FlagRule
+	if err := database.DB.First(&rule, ruleID).Error; err != nil {
+		utils.Error(c, 4004, "Flag 规则不存在")
+		return
+	}
+
+	pattern, err := utils.DecryptFlag(rule.Pattern)
+	if err != nil {
+		utils.Error(c, 5000, "解密 Flag 规则失败: "+err.Error())
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Kind != nil {
+		rule.Kind = models.FlagRuleKind(*req.Kind)
+		updates["kind"] = rule.Kind
+	}
+	if req.Pattern != nil {
+		pattern = *req.Pattern
+		encrypted, err := utils.EncryptFlag(pattern)
+		if err != nil {
+			utils.Error(c, 5000, "加密 Flag 规则失败: "+err.Error())
+			return
+		}
+		updates["pattern"] = encrypted
+	}
+	if req.SortOrder != nil {
+		updates["sort_order"] = *req.SortOrder
+	}
+	if len(updates) == 0 {
+		utils.Success(c, "没有需要更新的字段", nil)
+		return
+	}
+	// 类型和内容需一起校验，例如把 exact 规则改为 regex 时原内容可能不是合法正则
+	if err := services.ValidateFlagRule(rule.Kind, pattern); err != nil {
+		utils.Error(c, 1001, err.Error())
+		return
+	}
+
+	if err := database.DB.Model(&rule).Updates(updates).Error; err != nil {
+		utils.Error(c, 5000, "更新 Flag 规则失败: "+err.Error())
+		return
+	}
+	utils.Success(c, "Flag rule updated successfully", nil)
+}
+
+// DeleteFlagRule —— 管理员删除 Flag 规则
+func DeleteFlagRule(c *gin.Context) {
+	ruleID, err := strconv.Atoi(c.Param("rule_id"))
+	if err != nil {
+		utils.Error(c, 1002, "无效的规则ID")
+		return
+	}
+
+	if err := database.DB.Delete(&models.FlagRule{}, ruleID).Error; err != nil {
+		utils.Error(c, 5000, "删除 Flag 规则失败: "+err.Error())
+		return
+	}
+	utils.Success(c, "Flag rule deleted successfully", nil)
+}
+
+// RevealChallengeFlags —— root_admin 查看题目的明文静态 Flag 和 Flag 规则，每次查看都写入审计日志
+func RevealChallengeFlags(c *gin.Context) {
+	challengeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.Error(c, 1002, "无效的题目ID")
+		return
+	}
+
+	var req dto.RevealFlagsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.Error(c, 1001, "参数无效: "+err.Error())
+		return
+	}
+
+	var challenge models.Challenge
+	if err := database.DB.First(&challenge, challengeID).Error; err != nil {
+		utils.Error(c, 4004, "题目不存在")
+		return
+	}
+
+	userIDAny, _ := c.Get("user_id")
+	userID := userIDAny.(uint32)
+	// 先写审计日志，写入失败则不返回明文
+	entry := models.FlagRevealLog{
+		ChallengeID: challenge.ID,
+		UserID:      userID,
+		Reason:      req.Reason,
+		IPAddress:   c.ClientIP(),
+	}
+	if err := database.DB.Create(&entry).Error; err != nil {
+		utils.Error(c, 5000, "写入审计日志失败: "+err.Error())
+		return
+	}
+	log.Printf("Flag reveal: user %d revealed flags of challenge %d from %s, reason: %s", userID, challenge.ID, entry.IPAddress, req.Reason)
+
+	staticFlag, err := utils.DecryptFlag(challenge.StaticFlag)
+	if err != nil {
+		utils.Error(c, 5000, "解密 Flag 失败: "+err.Error())
+		return
+	}
+	rules, err := services.LoadFlagRules(challenge.ID)
+	if err != nil {
+		utils.Error(c, 5000, "解密 Flag 规则失败: "+err.Error())
+		return
+	}
+	revealed := make([]dto.RevealedFlagRule, 0, len(rules))
+	for _, r := range rules {
+		revealed = append(revealed, dto.RevealedFlagRule{ID: r.ID, Kind: string(r.Kind), Pattern: r.Pattern, SortOrder: r.SortOrder})
+	}
+	parts, err := services.LoadChallengeParts(challenge.ID)
+	if err != nil {
+		utils.Error(c, 5000, "解密部分 Flag 失败: "+err.Error())
+		return
+	}
+	revealedParts := make([]gin.H, 0, len(parts))
+	for _, p := range parts {
+		revealedParts = append(revealedParts, gin.H{"id": p.ID, "position": p.Position, "name": p.Name, "kind": p.Kind, "flag": p.Flag})
+	}
+
+	utils.Success(c, "success", gin.H{
+		"challenge_id": challenge.ID,
+		"static_flag":  staticFlag,
+		"flag_rules":   revealed,
+		"parts":        revealedParts,
+	})
+}
+
+// ListFlagReveals —— root_admin 查询明文 Flag 查看记录
+func ListFlagReveals(c *gin.Context) {
+	type RevealDetail struct {
+		ID            uint64    `json:"id"`
+		ChallengeID   uint32    `json:"challenge_id"`
+		ChallengeName string    `json:"challenge_name"`
+		UserID        uint32    `json:"user_id"`
+		Username      string    `json:"username"`
+		Reason        string    `json:"reason"`
+		IPAddress     string    `json:"ip_address"`
+		CreatedAt     time.Time `json:"created_at"`
+	}
+
+	db := database.DB.Table("dalictf_flag_reveal_log l").
+		Select("l.id, l.challenge_id, c.challenge_name, l.user_id, u.username, l.reason, l.ip_address, l.created_at").
+		Joins("LEFT JOIN dalictf_challenge c ON l.challenge_id = c.id").
+		Joins("LEFT JOIN dalictf_user u ON l.user_id = u.id")
+	if challengeID := c.Query("challenge_id"); challengeID != "" {
+		db = db.Where("l.challenge_id = ?", challengeID)
+	}
+
+	var results []RevealDetail
+	if err := db.Order("l.id desc").Limit(500).Find(&results).Error; err != nil {
+		utils.Error(c, 5000, "查询失败")
+		return
+	}
+	utils.Success(c, "success", results)
+}
+
+func flagRuleResps(rules []models.FlagRule) []dto.FlagRuleResp {
+	items := make([]dto.FlagRuleResp, 0, len(rules))
+	for _, r := range rules {
+		items = append(items, dto.FlagRuleResp{
+			ID:        r.ID,
+			Kind:      string(r.Kind),
+			SortOrder: r.SortOrder,
+		})
+	}
+	return items
+}
@@ -4,6 +4,7 @@ package controllers
 import (
 	"ISCTF/database"
 	"ISCTF/models"
+	"ISCTF/services"
 	"ISCTF/utils"
 	"errors" // <-- 新增：导入标准库 errors
 	"github.com/gin-gonic/gin"
@@ -12,27 +13,54 @@ import (
 	"time"
 )
 
-// GetTeamSolves 查询队伍解题记录
+// GetTeamSolves 查询队伍解题记录。封榜期间其他队伍只能看到该队在封榜前的解题（含血和奖励分），
+// 队伍自己和管理员看到全部记录
 func GetTeamSolves(c *gin.Context) {
 	teamID, _ := strconv.Atoi(c.Param("id"))
 
+	view, ok := resolveScoreboardView(c)
+	if !ok {
+		return
+	}
+
 	var solves []models.Submission
-	database.DB.Where("team_id = ?", teamID).Order("solving_time asc").Find(&solves)
+	db := database.DB.Where("team_id = ?", teamID)
+	if contestID := c.Query("contest_id"); contestID != "" {
+		db = db.Where("contest_id = ?", contestID)
+	}
+	if view.Frozen && view.TeamID != uint32(teamID) {
+		db = db.Where("contest_id <> ? OR solving_time < ?", view.ContestID, *view.FreezeTime)
+	}
+	db.Order("solving_time asc").Find(&solves)
 
 	type SolveInfo struct {
 		ChallengeID   uint32 `json:"challenge_id"`
 		ChallengeName string `json:"challenge_name"`
+		ContestID     uint   `json:"contest_id"`
+		PartID        uint32 `json:"part_id,omitempty"`
+		PartName      string `json:"part_name,omitempty"`
 		Score         uint   `json:"score"`
+		Blood         uint8  `json:"blood,omitempty"`
+		BonusScore    uint   `json:"bonus_score"`
 		SolvingTime   string `json:"solving_time"`
 	}
 	var result []SolveInfo
 	for _, solve := range solves {
 		var chal models.Challenge
 		database.DB.Select("challenge_name").First(&chal, solve.ChallengeID)
+		var part models.ChallengePart
+		if solve.PartID != 0 {
+			database.DB.Select("name").First(&part, solve.PartID)
+		}
 		result = append(result, SolveInfo{
 			ChallengeID:   solve.ChallengeID,
 			ChallengeName: chal.ChallengeName,
+			ContestID:     solve.ContestID,
+			PartID:        solve.PartID,
+			PartName:      part.Name,
 			Score:         solve.Score,
+			Blood:         solve.Blood,
+			BonusScore:    solve.BonusScore,
 			SolvingTime:   solve.SolvingTime.Format("2006-01-02 15:04:05"),
 		})
 	}
@@ -55,10 +83,11 @@ func GetFlagLogs(c *gin.Context) {
 		SubmissionTime time.Time `json:"submission_time"`
 		IPAddress      string    `json:"ip_address"`
 		Suspected      bool      `json:"suspected"`
+		MatchedRuleID  *uint64   `json:"matched_rule_id"`
 	}
 
 	db := database.DB.Table("dalictf_flag_information l").
-		Select("l.id, l.challenge_id, c.challenge_name, l.team_id, t.team_name, l.user_id, u.username, l.submitted_flag, l.flag_result, l.submission_time, l.ip_address, l.suspected").
+		Select("l.id, l.challenge_id, c.challenge_name, l.team_id, t.team_name, l.user_id, u.username, l.submitted_flag, l.flag_result, l.submission_time, l.ip_address, l.suspected, l.matched_rule_id").
 		Joins("LEFT JOIN dalictf_challenge c ON l.challenge_id = c.id").
 		Joins("LEFT JOIN dalictf_team t ON l.team_id = t.id").
 		Joins("LEFT JOIN dalictf_user u ON l.user_id = u.id")
@@ -69,6 +98,9 @@ func GetFlagLogs(c *gin.Context) {
 	if challengeID := c.Query("challenge_id"); challengeID != "" {
 		db = db.Where("l.challenge_id = ?", challengeID)
 	}
+	if contestID := c.Query("contest_id"); contestID != "" {
+		db = db.Where("l.contest_id = ?", contestID)
+	}
 	if userID := c.Query("user_id"); userID != "" {
 		db = db.Where("l.user_id = ?", userID)
 	}
@@ -131,8 +163,8 @@ func CompareFlagSubmissions(c *gin.Context) {
 
 	var challenge models.Challenge
 	database.DB.First(&challenge, firstSubmission.ChallengeID)
-	if challenge.Mode != models.ChallengeModeDynamic {
-		utils.Error(c, 400, "Comparison is only applicable for dynamic challenges")
+	if challenge.Mode == models.ChallengeModeStatic {
+		utils.Error(c, 400, "Comparison is only applicable for per-team flag challenges")
 		return
 	}
 
@@ -155,8 +187,42 @@ func CompareFlagSubmissions(c *gin.Context) {
 		Order("l.submission_time asc").
 		Find(&results)
 
+	// 带队伍水印的 Flag 可直接还原出它签发给的队伍
+	var issuedTo *uint32
+	if teamID, ok := services.TraceFlag(challenge.ID, flag); ok {
+		issuedTo = &teamID
+	}
+
+	utils.Success(c, "success", gin.H{
+		"flag_value":        flag,
+		"issued_to_team_id": issuedTo,
+		"submissions":       results,
+	})
+}
+
+// TraceFlag 根据 Flag 中的队伍水印找出它签发给的队伍，用于追查泄露的 Flag
+func TraceFlag(c *gin.Context) {
+	flag := c.Query("flag")
+	challengeID, _ := strconv.Atoi(c.Query("challenge_id"))
+	if flag == "" || challengeID <= 0 {
+		utils.Error(c, 1001, "Missing 'flag' or 'challenge_id' query parameter")
+		return
+	}
+
+	teamID, ok := services.TraceFlag(uint32(challengeID), flag)
+	if !ok {
+		utils.Error(c, 404, "No team watermark found in this flag")
+		return
+	}
+
+	var team models.Team
+	teamName := ""
+	if err := database.DB.First(&team, teamID).Error; err == nil {
+		teamName = team.TeamName
+	}
 	utils.Success(c, "success", gin.H{
-		"flag_value":  flag,
-		"submissions": results,
+		"challenge_id": challengeID,
+		"team_id":      teamID,
+		"team_name":    teamName,
 	})
 }
@@ -4,15 +4,18 @@ package controllers
 import (
 	"ISCTF/database"
 	"ISCTF/models"
+	"ISCTF/services"
 	"ISCTF/utils"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
 	"strconv"
 	"time"
 )
 
-// GetScoreboard 查询排行榜
+// GetScoreboard 查询排行榜，contest_id 缺省为当前比赛。封榜期间公众看到封榜时的排名，
+// 管理员看到实时排名，队伍自己的那一行保持实时分数（不在前 limit 名时追加在末尾）
 func GetScoreboard(c *gin.Context) {
 	track := c.DefaultQuery("track", "overall")
 	limitStr := c.DefaultQuery("limit", "10")
@@ -21,32 +24,65 @@ func GetScoreboard(c *gin.Context) {
 		limit = 10
 	}
 
+	view, ok := resolveScoreboardView(c)
+	if !ok {
+		return
+	}
+	cacheKey := fmt.Sprintf("scoreboard:%d:%s:%d", view.ContestID, track, limit)
+	if view.Frozen {
+		cacheKey = fmt.Sprintf("scoreboard:%d:frozen:%s:%d", view.ContestID, track, limit)
+	}
+
 	// 1. 尝试从 Redis 获取缓存
-	cacheKey := fmt.Sprintf("scoreboard:%s:%d", track, limit)
+	var results []models.Scoreboard
+	msg := "success"
 	val, err := database.RDB.Get(database.Ctx, cacheKey).Result()
-	if err == nil {
-		var results []models.Scoreboard
-		if json.Unmarshal([]byte(val), &results) == nil {
-			utils.Success(c, "success (from cache)", results)
-			return
+	if err == nil && json.Unmarshal([]byte(val), &results) == nil {
+		msg = "success (from cache)"
+	} else {
+		results = nil
+		// rank 是保留字，交给 GORM 按当前方言加引号（MySQL 反引号 / PostgreSQL、SQLite 双引号）
+		database.DB.Where("contest_id = ? AND track = ? AND frozen = ?", view.ContestID, track, view.Frozen).
+			Order(clause.OrderByColumn{Column: clause.Column{Name: "rank"}}).
+			Limit(limit).Find(&results)
+
+		// 2. 如果缓存未命中，则将数据库查询结果存入 Redis
+		jsonData, err := json.Marshal(results)
+		if err == nil {
+			// 将缓存有效期设置为较短的15秒，以保证排行榜的准实时性
+			database.RDB.Set(database.Ctx, cacheKey, jsonData, 15*time.Second)
 		}
 	}
 
-	var results []models.Scoreboard
-	// 修正：为保留字 rank 加上反引号
-	database.DB.Where("track = ?", track).Order("`rank` asc").Limit(limit).Find(&results)
-
-	// 2. 如果缓存未命中，则将数据库查询结果存入 Redis
-	jsonData, err := json.Marshal(results)
-	if err == nil {
-		// 将缓存有效期设置为较短的15秒，以保证排行榜的准实时性
-		database.RDB.Set(database.Ctx, cacheKey, jsonData, 15*time.Second)
+	// 封榜期间队伍看到自己的实时分数，名次仍按封榜排行榜显示；缓存为各队共用，因此在读取缓存之后处理
+	if view.Frozen && view.TeamID != 0 {
+		var live models.Scoreboard
+		if err := database.DB.Where("contest_id = ? AND track = ? AND frozen = ? AND team_id = ?", view.ContestID, track, false, view.TeamID).First(&live).Error; err == nil {
+			found := false
+			for i := range results {
+				if results[i].TeamID == view.TeamID {
+					live.Rank = results[i].Rank
+					results[i] = live
+					found = true
+					break
+				}
+			}
+			if !found {
+				// 不在前 limit 名时单独查询封榜名次，封榜后才首次得分的队伍没有封榜名次，Rank 为 0
+				var frozen models.Scoreboard
+				live.Rank = 0
+				if database.DB.Where("contest_id = ? AND track = ? AND frozen = ? AND team_id = ?", view.ContestID, track, true, view.TeamID).First(&frozen).Error == nil {
+					live.Rank = frozen.Rank
+				}
+				results = append(results, live)
+			}
+		}
 	}
 
-	utils.Success(c, "success", results)
+	utils.Success(c, msg, results)
 }
 
-// GetSolveFeed 查询实时解题动态
+// GetSolveFeed 查询实时解题动态，封榜期间公众只能看到封榜前的动态和自己队伍的动态
 func GetSolveFeed(c *gin.Context) {
 	limitStr := c.DefaultQuery("limit", "20")
 	limit, _ := strconv.Atoi(limitStr)
@@ -54,8 +90,110 @@ func GetSolveFeed(c *gin.Context) {
 		limit = 20
 	}
 
+	view, ok := resolveScoreboardView(c)
+	if !ok {
+		return
+	}
+	query := database.DB.Where("contest_id = ?", view.ContestID).Order("solving_time desc").Limit(limit)
+	if view.Frozen {
+		query = query.Where("solving_time < ? OR team_id = ?", *view.FreezeTime, view.TeamID)
+	}
 	var results []models.SolveFeed
-	database.DB.Order("solving_time desc").Limit(limit).Find(&results)
+	query.Find(&results)
 
 	utils.Success(c, "success", results)
 }
+
+// GetBloods 查询比赛各题的一二三血，challenge_id 指定时只查询该题。
+// 封榜期间公众只能看到封榜前的血和自己队伍的血
+func GetBloods(c *gin.Context) {
+	view, ok := resolveScoreboardView(c)
+	if !ok {
+		return
+	}
+	query := services.BloodQuery{ContestID: view.ContestID, VisibleOnly: !isAdminRequest(c)}
+	if challengeID, err := strconv.ParseUint(c.Query("challenge_id"), 10, 32); err == nil {
+		query.ChallengeID = uint32(challengeID)
+	}
+	if view.Frozen {
+		query.Until = view.FreezeTime
+		query.TeamID = view.TeamID
+	}
+	bloods, err := services.ListBloods(query)
+	if err != nil {
+		utils.Error(c, 5000, "查询一二三血失败: "+err.Error())
+		return
+	}
+	utils.Success(c, "success", bloods)
+}
+
+// GetScoreboardReplay 返回揭晓排行榜用的回放数据：封榜时的排名和封榜后按时间排列的解题记录。
+// 揭晓前只有管理员可以查看
+func GetScoreboardReplay(c *gin.Context) {
+	track := c.DefaultQuery("track", "overall")
+
+	contest, err := services.ResolveContest(c.Query("contest_id"))
+	if err != nil || contest == nil {
+		utils.Error(c, 404, "No active contest found")
+		return
+	}
+	if contest.FreezeTime == nil {
+		utils.Error(c, 4004, "比赛未设置封榜")
+		return
+	}
+	if contest.RevealedAt == nil && !isAdminRequest(c) {
+		utils.Error(c, 8005, "排行榜尚未揭晓")
+		return
+	}
+
+	initial, events, err := services.ScoreboardReplay(contest.ID, *contest.FreezeTime, track)
+	if err != nil {
+		utils.Error(c, 5000, "查询回放数据失败: "+err.Error())
+		return
+	}
+	utils.Success(c, "success", gin.H{
+		"freeze_time": contest.FreezeTime.Format("2006-01-02 15:04:05"),
+		"revealed_at": formatOptionalTime(contest.RevealedAt),
+		"frozen":      initial,
+		"events":      events,
+	})
+}
+
+// scoreboardView 描述本次请求看到的排行榜：所属比赛、是否封榜，以及请求者所在的队伍
+type scoreboardView struct {
+	ContestID  uint
+	Frozen     bool
+	FreezeTime *time.Time
+	TeamID     uint32
+}
+
+// resolveScoreboardView 按 contest_id（缺省为当前比赛）的封榜状态和请求者身份决定展示哪份排行榜，
+// 管理员总是看到实时数据。比赛不存在时已写入响应
+func resolveScoreboardView(c *gin.Context) (scoreboardView, bool) {
+	contest, err := services.ResolveContest(c.Query("contest_id"))
+	if err != nil {
+		utils.Error(c, 4004, "比赛不存在")
+		return scoreboardView{}, false
+	}
+	if contest == nil {
+		return scoreboardView{}, true
+	}
+	if !contest.ScoreboardFrozen(time.Now()) || isAdminRequest(c) {
+		return scoreboardView{ContestID: contest.ID}, true
+	}
+	view := scoreboardView{ContestID: contest.ID, Frozen: true, FreezeTime: contest.FreezeTime}
+	if userIDAny, ok := c.Get("user_id"); ok {
+		var member models.TeamMember
+		if database.DB.Where("user_id = ?", userIDAny.(uint32)).First(&member).Error == nil {
+			view.TeamID = member.TeamID
+		}
+	}
+	return view, true
+}
+
+// isAdminRequest 判断请求者是否为管理员，未登录时返回 false
+func isAdminRequest(c *gin.Context) bool {
+	roleAny, _ := c.Get("user_role")
+	role, _ := roleAny.(models.UserRole)
+	return role == models.RoleAdmin || role == models.RoleRootAdmin
+}
@@ -2,6 +2,7 @@
 package controllers
 
 import (
+	"ISCTF/config"
 	"ISCTF/database"
 	"ISCTF/models"
 	"ISCTF/utils"
@@ -57,7 +58,7 @@ func Register(c *gin.Context) {
 		newUser.SchoolID = &school.ID
 	}
 
-	contestStartTimeYear := 2025 // 假设比赛在2025年开始
+	contestStartTimeYear := config.C.Contest.FreshmanYear // 入学年份等于该值的视为新生
 	if newUser.SchoolID == nil {
 		newUser.Track = models.TrackSociety
 	} else if req.GradeYear != nil {
@@ -2,19 +2,24 @@
 package database
 
 import (
-	"ISCTF/models"
+	"ISCTF/config"
+	"fmt"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"log"
-	"time"
 )
 
 var DB *gorm.DB
 
-func Connect() {
+func Connect(cfg config.DatabaseConfig) {
 	var err error
-	dsn := "root:123456@tcp(localhost:3306)/dali_isctf?charset=utf8mb4&parseTime=True&loc=Local"
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	dialector, err := openDialector(cfg.Driver, cfg.DSN)
+	if err != nil {
+		log.Fatal("Failed to select database driver:", err)
+	}
+	DB, err = gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -28,40 +33,36 @@ func Connect() {
 	}
 
 	// SetMaxIdleConns 用于设置连接池中空闲连接的最大数量。
-	sqlDB.SetMaxIdleConns(10)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
 
 	// SetMaxOpenConns 设置打开数据库连接的最大数量。
-	sqlDB.SetMaxOpenConns(100)
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
 
 	// SetConnMaxLifetime 设置了连接可复用的最大时间。
 	// 这对于解决 MySQL 的 'wait_timeout' 问题至关重要。
-	// 设置为1小时，意味着连接在创建1小时后会被标记为过期，
+	// 默认1小时，意味着连接在创建1小时后会被标记为过期，
 	// GORM 在下次使用它之前会安全地重新建立连接。
-	sqlDB.SetConnMaxLifetime(time.Hour)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	// SQLite 只允许单个写入者，限制为一个连接以避免 "database is locked"
+	if cfg.Driver == "sqlite" {
+		sqlDB.SetMaxOpenConns(1)
+	}
 	// =======================================================
 
-	log.Println("Database connection successfully established and connection pool configured.")
+	log.Printf("Database connection (%s) successfully established and connection pool configured.", cfg.Driver)
 }
 
-// MigrateTables 函数 (如果你不希望 GORM 自动修改表结构，也应该禁用它)
-func MigrateTables() {
-	err := DB.AutoMigrate(
-		&models.School{},
-		&models.User{},
-		&models.Team{},
-		&models.TeamMember{},
-		&models.QuestionType{},
-		&models.Challenge{},
-		&models.Attachment{},
-		&models.Submission{},
-		&models.Scoreboard{},
-		&models.SolveFeed{},
-		&models.Contest{},
-		&models.ContestSchool{},
-		&models.ContestSponsor{},
-	)
-	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+// openDialector 根据配置的驱动名返回对应的 GORM 方言
+func openDialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case "mysql":
+		return mysql.Open(dsn), nil
+	case "postgres":
+		return postgres.Open(dsn), nil
+	case "sqlite":
+		return sqlite.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
 	}
-	log.Println("Database migration completed.")
 }
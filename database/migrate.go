@@ -0,0 +1,278 @@
+// file: database/migrate.go
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Migration 是一个带版本号的结构变更，Up 和 Down 必须互为逆操作。
+//
+// 每一步都在事务中执行，但 MySQL 的 DDL 会隐式提交，失败时已执行的建表、加列不会回滚，
+// schema_migrations 也不会记录该版本。因此 Up 和 Down 都必须可以重复执行：
+// 结构变更使用下方的 createTables / addColumns / createIndexes 等函数（先检查表、列、索引是否存在），
+// 数据变更也要保证对已处理过的数据再执行一次结果不变。修复失败原因后重新执行 migrate 即可继续
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration 对应 schema_migrations 表，记录已经执行过的迁移
+type SchemaMigration struct {
+	Version   uint   `gorm:"primarykey;autoIncrement:false"`
+	Name      string `gorm:"size:100;not null"`
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationState 描述单个迁移的执行状态，供 migrate status 输出
+type MigrationState struct {
+	Version   uint
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// ErrSchemaOutdated 表示数据库中还有未执行的迁移
+var ErrSchemaOutdated = errors.New("database schema is outdated, run 'migrate up' first")
+
+// sortedMigrations 返回按版本号升序排列的迁移列表，并检查版本号是否重复
+func sortedMigrations() ([]Migration, error) {
+	list := make([]Migration, len(migrations))
+	copy(list, migrations)
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i := 1; i < len(list); i++ {
+		if list[i].Version == list[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", list[i].Version)
+		}
+	}
+	return list, nil
+}
+
+// appliedVersions 读取已执行的迁移，schema_migrations 表不存在时会先创建
+func appliedVersions() (map[uint]SchemaMigration, error) {
+	if err := DB.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, fmt.Errorf("prepare schema_migrations: %w", err)
+	}
+	var rows []SchemaMigration
+	if err := DB.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[uint]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// MigrateUp 按版本号顺序执行所有未执行的迁移
+func MigrateUp() error {
+	list, err := sortedMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedVersions()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range list {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) up: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Applied migration %d_%s", m.Version, m.Name)
+	}
+	return nil
+}
+
+// MigrateDown 回滚最近执行的 steps 个迁移
+func MigrateDown(steps int) error {
+	list, err := sortedMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedVersions()
+	if err != nil {
+		return err
+	}
+
+	for i := len(list) - 1; i >= 0 && steps > 0; i-- {
+		m := list[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) down: %w", m.Version, m.Name, err)
+		}
+		log.Printf("Reverted migration %d_%s", m.Version, m.Name)
+		steps--
+	}
+	return nil
+}
+
+// MigrationStatus 返回所有迁移及其执行状态
+func MigrationStatus() ([]MigrationState, error) {
+	list, err := sortedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(list))
+	for _, m := range list {
+		state := MigrationState{Version: m.Version, Name: m.Name}
+		if row, ok := applied[m.Version]; ok {
+			state.Applied = true
+			appliedAt := row.AppliedAt
+			state.AppliedAt = &appliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// CheckSchema 在服务启动时调用，存在未执行的迁移时返回 ErrSchemaOutdated
+func CheckSchema() error {
+	states, err := MigrationStatus()
+	if err != nil {
+		return err
+	}
+	var pending []uint
+	for _, s := range states {
+		if !s.Applied {
+			pending = append(pending, s.Version)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w (pending versions: %v)", ErrSchemaOutdated, pending)
+	}
+	return nil
+}
+
+// createTables 创建 models 对应的表，已存在的表跳过
+func createTables(tx *gorm.DB, models ...any) error {
+	for _, model := range models {
+		if tx.Migrator().HasTable(model) {
+			continue
+		}
+		if err := tx.Migrator().CreateTable(model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropTables 按逆序删除 models 对应的表，不存在的表跳过
+func dropTables(tx *gorm.DB, models ...any) error {
+	for i := len(models) - 1; i >= 0; i-- {
+		if err := tx.Migrator().DropTable(models[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumns 为 model 对应的表添加 fields 列，已存在的列跳过
+func addColumns(tx *gorm.DB, model any, fields ...string) error {
+	for _, field := range fields {
+		if tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropColumns 删除 model 对应的表中的 fields 列，不存在的列跳过。
+// 列上的索引需先用 dropIndexes 删除（SQLite 不允许删除带索引的列）。
+// 不使用 Migrator().DropColumn：SQLite 驱动会重建整张表，表上其余的索引随之丢失
+func dropColumns(tx *gorm.DB, model any, fields ...string) error {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	for _, name := range fields {
+		if !tx.Migrator().HasColumn(model, name) {
+			continue
+		}
+		field := stmt.Schema.LookUpField(name)
+		if field == nil {
+			return fmt.Errorf("%s: unknown field %s", stmt.Table, name)
+		}
+		if err := tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: stmt.Table}, clause.Column{Name: field.DBName}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alterColumns 把 model 对应的表中的 fields 列改为 model 中的定义。
+// SQLite 不限制 varchar 长度，修改列又会重建整张表，因此跳过
+func alterColumns(tx *gorm.DB, model any, fields ...string) error {
+	if tx.Dialector.Name() == "sqlite" {
+		return nil
+	}
+	for _, field := range fields {
+		if err := tx.Migrator().AlterColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createIndexes 创建 model 中定义的索引，names 为索引名或单列索引的字段名，已存在的索引跳过
+func createIndexes(tx *gorm.DB, model any, names ...string) error {
+	for _, name := range names {
+		if tx.Migrator().HasIndex(model, name) {
+			continue
+		}
+		if err := tx.Migrator().CreateIndex(model, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropIndexes 删除 model 中定义的索引，不存在的索引跳过
+func dropIndexes(tx *gorm.DB, model any, names ...string) error {
+	for _, name := range names {
+		if !tx.Migrator().HasIndex(model, name) {
+			continue
+		}
+		if err := tx.Migrator().DropIndex(model, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,515 @@
+// file: database/migrations.go
+package database
+
+import (
+	"ISCTF/utils"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrations 是全部结构变更的有序列表。
+// 已发布的迁移不允许修改，新的变更请在末尾追加新版本号。
+// 迁移只使用 schema_snapshots.go 中对应版本的表结构快照，不引用 models 中的模型
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			// 使用 AutoMigrate 以便接管引入迁移之前由 MigrateTables 建好的表
+			return tx.AutoMigrate(initialTables()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropTables(tx, initialTables()...)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "container_expiry_warned_at",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v2Container{}, "ExpiryWarnedAt")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v2Container{}, "ExpiryWarnedAt")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "container_event_tracking",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v3Container{}, "RestartCount", "LastEvent", "LastEventAt", "LastExitCode", "FailureReason")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v3Container{}, "RestartCount", "LastEvent", "LastEventAt", "LastExitCode", "FailureReason")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "challenge_instance_policy",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v4Challenge{}, "MemoryLimitMB", "CPULimit", "PidsLimit", "LifetimeMinutes", "MaxRenewals", "RenewalMinutes", "MaxTeamContainers")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v4Challenge{}, "MemoryLimitMB", "CPULimit", "PidsLimit", "LifetimeMinutes", "MaxRenewals", "RenewalMinutes", "MaxTeamContainers")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "container_endpoints",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v5Container{}, "Endpoints")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v5Container{}, "Endpoints")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "container_gateway_token",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v6Container{}, "GatewayToken"); err != nil {
+				return err
+			}
+			return createIndexes(tx, &v6Container{}, "GatewayToken")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropIndexes(tx, &v6Container{}, "GatewayToken"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v6Container{}, "GatewayToken")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "tcp_proxy_tickets_and_connections",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v7Container{}, "ProxyTicket"); err != nil {
+				return err
+			}
+			if err := createIndexes(tx, &v7Container{}, "ProxyTicket"); err != nil {
+				return err
+			}
+			return createTables(tx, &v7ContainerConnection{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropTables(tx, &v7ContainerConnection{}); err != nil {
+				return err
+			}
+			if err := dropIndexes(tx, &v7Container{}, "ProxyTicket"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v7Container{}, "ProxyTicket")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "challenge_network_policy",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v8Challenge{}, "NetworkIsolation", "BlockEgress")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v8Challenge{}, "NetworkIsolation", "BlockEgress")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "multi_service_challenges",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v9Challenge{}, "ServiceSpec"); err != nil {
+				return err
+			}
+			return createTables(tx, &v9ContainerInstance{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropTables(tx, &v9ContainerInstance{}); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v9Challenge{}, "ServiceSpec")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "challenge_flag_injection",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v10Challenge{}, "FlagInjection", "FlagEnvName", "FlagPath", "FlagCommand", "FlagReadyCheck")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v10Challenge{}, "FlagInjection", "FlagEnvName", "FlagPath", "FlagCommand", "FlagReadyCheck")
+		},
+	},
+	{
+		Version: 11,
+		Name:    "challenge_flag_template",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v11Challenge{}, "FlagTemplate")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v11Challenge{}, "FlagTemplate")
+		},
+	},
+	{
+		Version: 12,
+		Name:    "challenge_team_flag",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v12Challenge{}, "TeamFlagFile", "TeamFlagContent")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v12Challenge{}, "TeamFlagFile", "TeamFlagContent")
+		},
+	},
+	{
+		Version: 13,
+		Name:    "flag_rules",
+		Up: func(tx *gorm.DB) error {
+			if err := createTables(tx, &v13FlagRule{}); err != nil {
+				return err
+			}
+			return addColumns(tx, &v13SubmissionLog{}, "MatchedRuleID")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumns(tx, &v13SubmissionLog{}, "MatchedRuleID"); err != nil {
+				return err
+			}
+			return dropTables(tx, &v13FlagRule{})
+		},
+	},
+	{
+		Version: 14,
+		Name:    "encrypt_stored_flags",
+		Up: func(tx *gorm.DB) error {
+			// 密文比明文长，先放宽列再加密
+			if err := alterColumns(tx, &v14Challenge{}, "StaticFlag"); err != nil {
+				return err
+			}
+			if err := alterColumns(tx, &v14FlagRule{}, "Pattern"); err != nil {
+				return err
+			}
+			if err := createTables(tx, &v14FlagRevealLog{}); err != nil {
+				return err
+			}
+			return convertStoredFlags(tx, true)
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := convertStoredFlags(tx, false); err != nil {
+				return err
+			}
+			if err := dropTables(tx, &v14FlagRevealLog{}); err != nil {
+				return err
+			}
+			if err := alterColumns(tx, &v1Challenge{}, "StaticFlag"); err != nil {
+				return err
+			}
+			return alterColumns(tx, &v13FlagRule{}, "Pattern")
+		},
+	},
+	{
+		Version: 15,
+		Name:    "multi_part_challenges",
+		Up: func(tx *gorm.DB) error {
+			// 解题记录的唯一键从 (题目, 队伍) 改为 (题目, 部分, 队伍)
+			if err := dropIndexes(tx, &v1Submission{}, "unique_team_challenge"); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &v15Submission{}, "PartID"); err != nil {
+				return err
+			}
+			if err := createIndexes(tx, &v15Submission{}, "unique_team_challenge_part"); err != nil {
+				return err
+			}
+			if err := createTables(tx, &v15ChallengePart{}); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &v15SubmissionLog{}, "MatchedPartID"); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &v15SolveFeed{}, "PartID", "PartName", "PartPosition", "PartCount", "PartsSolved"); err != nil {
+				return err
+			}
+			return addColumns(tx, &v15Scoreboard{}, "Progress")
+		},
+		Down: func(tx *gorm.DB) error {
+			// 各部分的解题记录无法放进 (题目, 队伍) 唯一键，直接删除
+			if tx.Migrator().HasColumn(&v15Submission{}, "PartID") {
+				if err := tx.Exec("DELETE FROM dalictf_problem_solving_record WHERE part_id <> 0").Error; err != nil {
+					return err
+				}
+			}
+			if err := dropIndexes(tx, &v15Submission{}, "unique_team_challenge_part"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &v15Submission{}, "PartID"); err != nil {
+				return err
+			}
+			if err := createIndexes(tx, &v1Submission{}, "unique_team_challenge"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &v15SolveFeed{}, "PartID", "PartName", "PartPosition", "PartCount", "PartsSolved"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &v15SubmissionLog{}, "MatchedPartID"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &v15Scoreboard{}, "Progress"); err != nil {
+				return err
+			}
+			return dropTables(tx, &v15ChallengePart{})
+		},
+	},
+	{
+		Version: 16,
+		Name:    "contest_phases",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v16Contest{}, "FreezeTime", "PracticeMode")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v16Contest{}, "FreezeTime", "PracticeMode")
+		},
+	},
+	{
+		Version: 17,
+		Name:    "scoreboard_freeze",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v17Contest{}, "RevealedAt"); err != nil {
+				return err
+			}
+			return addColumns(tx, &v17Scoreboard{}, "Frozen")
+		},
+		Down: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&v17Scoreboard{}, "Frozen") {
+				if err := tx.Exec("DELETE FROM dalictf_scoreboard WHERE frozen = ?", true).Error; err != nil {
+					return err
+				}
+			}
+			if err := dropColumns(tx, &v17Scoreboard{}, "Frozen"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v17Contest{}, "RevealedAt")
+		},
+	},
+	{
+		Version: 18,
+		Name:    "multi_contest",
+		Up: func(tx *gorm.DB) error {
+			for _, model := range contestScopedTables() {
+				if err := addColumns(tx, model, "ContestID"); err != nil {
+					return err
+				}
+				if err := createIndexes(tx, model, "ContestID"); err != nil {
+					return err
+				}
+			}
+			if err := addColumns(tx, &v18Contest{}, "IsCurrent"); err != nil {
+				return err
+			}
+			if err := createIndexes(tx, &v18Contest{}, "IsCurrent"); err != nil {
+				return err
+			}
+			if err := createTables(tx, &v18ContestTeam{}); err != nil {
+				return err
+			}
+			// 升级前只有 ID 为 1 的比赛：它成为当前比赛，已有的题目、解题记录、容器和排行榜归入该比赛，
+			// 已有的队伍视为已报名
+			var legacyID uint
+			if err := tx.Table("dalictf_contest").Order("id").Limit(1).Pluck("id", &legacyID).Error; err != nil || legacyID == 0 {
+				return err
+			}
+			if err := tx.Exec("UPDATE dalictf_contest SET is_current = ? WHERE id = ?", true, legacyID).Error; err != nil {
+				return err
+			}
+			for _, model := range contestScopedTables() {
+				if err := tx.Model(model).Where("contest_id = ?", 0).UpdateColumn("contest_id", legacyID).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Exec(`INSERT INTO dalictf_contest_teams (contest_id, team_id, created_at)
+				SELECT ?, t.id, ? FROM dalictf_team t
+				WHERE NOT EXISTS (SELECT 1 FROM dalictf_contest_teams ct WHERE ct.contest_id = ? AND ct.team_id = t.id)`,
+				legacyID, time.Now(), legacyID).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropTables(tx, &v18ContestTeam{}); err != nil {
+				return err
+			}
+			if err := dropIndexes(tx, &v18Contest{}, "IsCurrent"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &v18Contest{}, "IsCurrent"); err != nil {
+				return err
+			}
+			for _, model := range contestScopedTables() {
+				if err := dropIndexes(tx, model, "ContestID"); err != nil {
+					return err
+				}
+				if err := dropColumns(tx, model, "ContestID"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 19,
+		Name:    "scoring_formulas",
+		Up: func(tx *gorm.DB) error {
+			// 已有题目的 score_formula 取列默认值 linear，与升级前的计分方式一致
+			return addColumns(tx, &v19Challenge{}, "ScoreFormula", "ScoreDecay", "Retroactive")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v19Challenge{}, "ScoreFormula", "ScoreDecay", "Retroactive")
+		},
+	},
+	{
+		Version: 20,
+		Name:    "blood_bonuses",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v20Challenge{}, "BloodBonusType", "BloodBonuses"); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &v20Submission{}, "Blood", "BonusScore"); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &v20Scoreboard{}, "Bloods"); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &v20SolveFeed{}, "Blood", "BonusScore"); err != nil {
+				return err
+			}
+			return backfillBloods(tx)
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumns(tx, &v20Challenge{}, "BloodBonusType", "BloodBonuses"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &v20Submission{}, "Blood", "BonusScore"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &v20Scoreboard{}, "Bloods"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v20SolveFeed{}, "Blood", "BonusScore")
+		},
+	},
+}
+
+// backfillBloods 按已有解题记录补记各题的一二三血。奖励分保持为 0，
+// 需要为已有的血发放奖励时由管理员重算分值
+func backfillBloods(tx *gorm.DB) error {
+	var challengeIDs []uint32
+	if err := tx.Table("dalictf_challenge").Pluck("id", &challengeIDs).Error; err != nil {
+		return err
+	}
+	for _, challengeID := range challengeIDs {
+		var partIDs []uint32
+		if err := tx.Table("dalictf_challenge_part").Where("challenge_id = ?", challengeID).Pluck("id", &partIDs).Error; err != nil {
+			return err
+		}
+		var solves []struct{ ID, TeamID uint32 }
+		query := tx.Table("dalictf_problem_solving_record").Select("id", "team_id").
+			Where("challenge_id = ?", challengeID).Order("solving_time ASC, id ASC")
+		if len(partIDs) == 0 {
+			query = query.Where("part_id = ?", 0)
+		} else {
+			query = query.Where("part_id IN ?", partIDs)
+		}
+		if err := query.Scan(&solves).Error; err != nil {
+			return err
+		}
+
+		// 多阶段题目以解出最后一个部分的记录为准，单 Flag 题目每条记录都是完整解出
+		need := max(len(partIDs), 1)
+		counts := make(map[uint32]int)
+		var blood uint8
+		for _, solve := range solves {
+			counts[solve.TeamID]++
+			if counts[solve.TeamID] != need {
+				continue
+			}
+			blood++
+			if err := tx.Exec("UPDATE dalictf_problem_solving_record SET blood = ? WHERE id = ?", blood, solve.ID).Error; err != nil {
+				return err
+			}
+			if blood == 3 {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// contestScopedTables 是第 18 版起按比赛划分的表
+func contestScopedTables() []any {
+	return []any{
+		&v18Challenge{}, &v18Submission{}, &v18SubmissionLog{},
+		&v18Container{}, &v18Scoreboard{}, &v18SolveFeed{},
+	}
+}
+
+// convertStoredFlags 把静态 Flag 和 Flag 规则在明文与密文之间转换，已是目标形式的值保持不变
+func convertStoredFlags(tx *gorm.DB, encrypt bool) error {
+	convert := func(v string) (string, error) {
+		if v == "" || utils.IsEncryptedFlag(v) == encrypt {
+			return v, nil
+		}
+		if encrypt {
+			return utils.EncryptFlag(v)
+		}
+		return utils.DecryptFlag(v)
+	}
+
+	var challenges []struct {
+		ID         uint32
+		StaticFlag string
+	}
+	if err := tx.Table("dalictf_challenge").Select("id", "static_flag").Where("static_flag <> ''").Scan(&challenges).Error; err != nil {
+		return err
+	}
+	for _, ch := range challenges {
+		v, err := convert(ch.StaticFlag)
+		if err != nil {
+			return fmt.Errorf("challenge %d: %w", ch.ID, err)
+		}
+		if err := tx.Exec("UPDATE dalictf_challenge SET static_flag = ? WHERE id = ?", v, ch.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	var rules []struct {
+		ID      uint64
+		Pattern string
+	}
+	if err := tx.Table("dalictf_flag_rule").Select("id", "pattern").Scan(&rules).Error; err != nil {
+		return err
+	}
+	for _, r := range rules {
+		v, err := convert(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("flag rule %d: %w", r.ID, err)
+		}
+		if err := tx.Exec("UPDATE dalictf_flag_rule SET pattern = ? WHERE id = ?", v, r.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initialTables 是初始版本包含的全部表（含此前遗漏的容器表和 Flag 提交日志表）
+func initialTables() []any {
+	return []any{
+		&v1School{},
+		&v1User{},
+		&v1Team{},
+		&v1TeamMember{},
+		&v1QuestionType{},
+		&v1Challenge{},
+		&v1Attachment{},
+		&v1Submission{},
+		&v1Scoreboard{},
+		&v1SolveFeed{},
+		&v1Contest{},
+		&v1ContestSchool{},
+		&v1ContestSponsor{},
+		&v1Container{},
+		&v1SubmissionLog{},
+	}
+}
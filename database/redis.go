@@ -2,6 +2,7 @@
 package database
 
 import (
+	"ISCTF/config"
 	"context"
 	"github.com/redis/go-redis/v9"
 	"log"
@@ -11,12 +12,12 @@ import (
 var RDB *redis.Client
 var Ctx = context.Background()
 
-func InitRedis() {
+func InitRedis(cfg config.RedisConfig) {
 	RDB = redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379", // Redis 服务器地址
-		Password: "",               // 没有密码，留空
-		DB:       0,                // 使用默认 DB
-		PoolSize: 100,              // 连接池大小
+		Addr:     cfg.Addr,     // Redis 服务器地址
+		Password: cfg.Password, // 没有密码时留空
+		DB:       cfg.DB,       // 默认 DB 为 0
+		PoolSize: cfg.PoolSize, // 连接池大小
 	})
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -0,0 +1,579 @@
+// file: database/schema_snapshots.go
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 本文件是各迁移版本使用的表结构快照，与 models 中的模型相互独立：
+// 模型以后怎么改，已发布的迁移建出的表都不变。
+// vN 前缀表示该结构在第 N 版引入；只为已有表加列的快照只包含新增的字段。
+// 快照一经发布不允许修改，结构变更请在新版本中新增快照。
+
+// ---- v1 initial_schema ----
+
+type v1School struct {
+	ID             uint32 `gorm:"primarykey"`
+	SchoolName     string `gorm:"column:school_name;size:100;unique;not null"`
+	InvitationCode string `gorm:"size:20;unique;not null"`
+	UserCount      uint32 `gorm:"default:0"`
+	Status         string `gorm:"size:20;default:'active';not null"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1School) TableName() string { return "dalictf_school" }
+
+type v1User struct {
+	ID            uint32 `gorm:"primarykey"`
+	Username      string `gorm:"size:50;unique;not null"`
+	Password      string `gorm:"size:255;not null"`
+	Email         string `gorm:"size:100;unique;not null"`
+	RealName      string `gorm:"size:50"`
+	SchoolID      *uint32
+	School        *v1School `gorm:"foreignKey:SchoolID"`
+	StudentNumber string    `gorm:"size:50"`
+	GradeYear     *int
+	Track         string `gorm:"size:20;not null;default:'society'"`
+	Role          string `gorm:"size:20;not null;default:'user'"`
+	Status        string `gorm:"size:20;not null;default:'active'"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (v1User) TableName() string { return "dalictf_user" }
+
+type v1Team struct {
+	ID             uint32 `gorm:"primarykey"`
+	TeamName       string `gorm:"size:100;unique;not null"`
+	LeaderID       uint32 `gorm:"not null"`
+	Leader         v1User `gorm:"foreignKey:LeaderID"`
+	SchoolID       *uint32
+	School         *v1School `gorm:"foreignKey:SchoolID"`
+	Track          string    `gorm:"size:20;not null"`
+	InvitationCode string    `gorm:"size:20;unique;not null"`
+	TeamDescribe   string    `gorm:"type:text"`
+	TeamStatus     string    `gorm:"size:20;default:'active'"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Members        []v1TeamMember `gorm:"foreignKey:TeamID"`
+}
+
+func (v1Team) TableName() string { return "dalictf_team" }
+
+type v1TeamMember struct {
+	ID       uint32 `gorm:"primarykey"`
+	TeamID   uint32 `gorm:"uniqueIndex:unique_team_user;not null"`
+	UserID   uint32 `gorm:"uniqueIndex:unique_team_user;not null"`
+	User     v1User `gorm:"foreignKey:UserID"`
+	Role     string `gorm:"size:20;default:'member'"`
+	JoinedAt time.Time
+}
+
+func (v1TeamMember) TableName() string { return "dalictf_team_members" }
+
+type v1QuestionType struct {
+	ID          uint32 `gorm:"primarykey"`
+	Direction   string `gorm:"size:50;unique;not null"`
+	Alias       string `gorm:"size:50"`
+	Description string `gorm:"type:text"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (v1QuestionType) TableName() string { return "dalictf_question_type" }
+
+type v1Challenge struct {
+	ID              uint32         `gorm:"primarykey"`
+	ChallengeName   string         `gorm:"size:100;unique;not null"`
+	ChallengeTypeID uint32         `gorm:"not null"`
+	QuestionType    v1QuestionType `gorm:"foreignKey:ChallengeTypeID"`
+	Author          string         `gorm:"size:50;not null"`
+	Description     string         `gorm:"type:text;not null"`
+	Hint            string         `gorm:"type:text"`
+	State           string         `gorm:"size:20;default:'hidden'"`
+	Mode            string         `gorm:"size:20;not null"`
+	StaticFlag      string         `gorm:"size:255"`
+	DockerImage     string         `gorm:"size:255"`
+	DockerPorts     string         `gorm:"size:50"`
+	Difficulty      string         `gorm:"size:20;default:'medium'"`
+	InitialScore    uint           `gorm:"not null"`
+	MinScore        uint           `gorm:"not null"`
+	CurrentScore    uint           `gorm:"not null"`
+	DecayRatio      float32        `gorm:"default:0.1"`
+	SolvedCount     uint           `gorm:"default:0"`
+	Attachments     []v1Attachment `gorm:"foreignKey:ChallengeID"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func (v1Challenge) TableName() string { return "dalictf_challenge" }
+
+type v1Attachment struct {
+	ID           uint64 `gorm:"primarykey"`
+	ChallengeID  uint32 `gorm:"not null"`
+	Storage      string `gorm:"size:20;not null"`
+	URL          string `gorm:"size:2048"`
+	ObjectBucket string `gorm:"size:63"`
+	ObjectKey    string `gorm:"size:512"`
+	FileName     string `gorm:"size:255;not null"`
+	ContentType  string `gorm:"size:255;not null"`
+	FileSize     uint64 `gorm:"default:0"`
+	SHA256       string `gorm:"size:64;not null"`
+	Status       string `gorm:"size:20;default:'pending_scan'"`
+	Visibility   string `gorm:"size:20;default:'private'"`
+	Version      uint16 `gorm:"default:1"`
+	SortOrder    uint   `gorm:"default:0"`
+	CreatedBy    uint32 `gorm:"not null"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (v1Attachment) TableName() string { return "dalictf_attachment" }
+
+type v1Submission struct {
+	ID          uint32    `gorm:"primarykey"`
+	ChallengeID uint32    `gorm:"uniqueIndex:unique_team_challenge;not null"`
+	TeamID      uint32    `gorm:"uniqueIndex:unique_team_challenge;not null"`
+	UserID      uint32    `gorm:"not null"`
+	Score       uint      `gorm:"not null"`
+	SolvingTime time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+func (v1Submission) TableName() string { return "dalictf_problem_solving_record" }
+
+type v1Scoreboard struct {
+	ID            uint    `gorm:"primarykey"`
+	TeamID        uint32  `gorm:"not null"`
+	TeamName      string  `gorm:"size:100;not null"`
+	SchoolName    *string `gorm:"size:100"`
+	Track         string  `gorm:"size:20;not null"`
+	Score         uint    `gorm:"not null"`
+	LastSolveTime *time.Time
+	Rank          uint `gorm:"not null"`
+	UpdatedAt     time.Time
+}
+
+func (v1Scoreboard) TableName() string { return "dalictf_scoreboard" }
+
+type v1SolveFeed struct {
+	ID            uint64    `gorm:"primarykey"`
+	ChallengeID   uint32    `gorm:"not null"`
+	ChallengeName string    `gorm:"size:100;not null"`
+	TeamID        uint32    `gorm:"not null"`
+	TeamName      string    `gorm:"size:100;not null"`
+	SchoolName    *string   `gorm:"size:100"`
+	Score         uint      `gorm:"not null"`
+	SolvingTime   time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+func (v1SolveFeed) TableName() string { return "dalictf_solve_feed" }
+
+type v1Contest struct {
+	ID           uint      `gorm:"primarykey"`
+	ContestName  string    `gorm:"size:100;not null"`
+	CoverImage   string    `gorm:"size:255"`
+	Description  string    `gorm:"type:text"`
+	StartTime    time.Time `gorm:"not null"`
+	EndTime      time.Time `gorm:"not null"`
+	OrganizerURL string    `gorm:"size:255"`
+	Status       string    `gorm:"size:20;default:'preparing'"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (v1Contest) TableName() string { return "dalictf_contest" }
+
+type v1ContestSchool struct {
+	ID         uint   `gorm:"primarykey"`
+	ContestID  uint   `gorm:"not null"`
+	SchoolID   uint32 `gorm:"not null"`
+	SchoolLogo string `gorm:"size:255"`
+}
+
+func (v1ContestSchool) TableName() string { return "dalictf_contest_schools" }
+
+type v1ContestSponsor struct {
+	ID          uint   `gorm:"primarykey"`
+	ContestID   uint   `gorm:"not null"`
+	SponsorName string `gorm:"size:100;not null"`
+	LogoURL     string `gorm:"size:255"`
+	Description string `gorm:"type:text"`
+	Link        string `gorm:"size:255"`
+}
+
+func (v1ContestSponsor) TableName() string { return "dalictf_contest_sponsors" }
+
+type v1Container struct {
+	ID             uint32    `gorm:"primarykey"`
+	DockerID       string    `gorm:"size:64;not null"`
+	ChallengeID    uint32    `gorm:"not null"`
+	TeamID         uint32    `gorm:"not null"`
+	ContainerName  string    `gorm:"size:100;not null"`
+	DockerImage    string    `gorm:"size:255;not null"`
+	DockerPorts    string    `gorm:"size:100;not null"`
+	ContainerFlag  string    `gorm:"size:255;not null"`
+	State          string    `gorm:"size:20;default:'running'"`
+	StartTime      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	EndTime        time.Time `gorm:"not null"`
+	ExtendedCount  uint      `gorm:"default:0"`
+	PcapPath       string    `gorm:"size:255"`
+	AnalysisResult string    `gorm:"type:text"`
+}
+
+func (v1Container) TableName() string { return "dalictf_container" }
+
+type v1SubmissionLog struct {
+	ID             uint64    `gorm:"primarykey"`
+	ChallengeID    uint32    `gorm:"not null"`
+	TeamID         uint32    `gorm:"not null"`
+	UserID         uint32    `gorm:"not null"`
+	SubmittedFlag  string    `gorm:"size:255;not null"`
+	FlagResult     string    `gorm:"size:20;not null"`
+	SubmissionTime time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	IPAddress      string    `gorm:"size:45"`
+	Suspected      bool      `gorm:"default:false"`
+}
+
+func (v1SubmissionLog) TableName() string { return "dalictf_flag_information" }
+
+// ---- v2 container_expiry_warned_at ----
+
+type v2Container struct {
+	ExpiryWarnedAt *time.Time
+}
+
+func (v2Container) TableName() string { return "dalictf_container" }
+
+// ---- v3 container_event_tracking ----
+
+type v3Container struct {
+	RestartCount  uint   `gorm:"default:0"`
+	LastEvent     string `gorm:"size:20"`
+	LastEventAt   *time.Time
+	LastExitCode  *int
+	FailureReason string `gorm:"size:255"`
+}
+
+func (v3Container) TableName() string { return "dalictf_container" }
+
+// ---- v4 challenge_instance_policy ----
+
+type v4Challenge struct {
+	MemoryLimitMB     *uint
+	CPULimit          *float64
+	PidsLimit         *uint
+	LifetimeMinutes   *uint
+	MaxRenewals       *uint
+	RenewalMinutes    *uint
+	MaxTeamContainers *uint
+}
+
+func (v4Challenge) TableName() string { return "dalictf_challenge" }
+
+// ---- v5 container_endpoints ----
+
+type v5Container struct {
+	Endpoints string `gorm:"type:text"` // JSON
+}
+
+func (v5Container) TableName() string { return "dalictf_container" }
+
+// ---- v6 container_gateway_token ----
+
+type v6Container struct {
+	GatewayToken string `gorm:"size:32;index"`
+}
+
+func (v6Container) TableName() string { return "dalictf_container" }
+
+// ---- v7 tcp_proxy_tickets_and_connections ----
+
+type v7Container struct {
+	ProxyTicket string `gorm:"size:32;index"`
+}
+
+func (v7Container) TableName() string { return "dalictf_container" }
+
+type v7ContainerConnection struct {
+	ID          uint64    `gorm:"primarykey"`
+	ContainerID uint32    `gorm:"not null;index"`
+	TeamID      uint32    `gorm:"not null"`
+	RemoteAddr  string    `gorm:"size:64;not null"`
+	TargetPort  uint32    `gorm:"not null"`
+	StartedAt   time.Time `gorm:"not null"`
+	EndedAt     *time.Time
+	BytesIn     int64 `gorm:"default:0"`
+	BytesOut    int64 `gorm:"default:0"`
+}
+
+func (v7ContainerConnection) TableName() string { return "dalictf_container_connection" }
+
+// ---- v8 challenge_network_policy ----
+
+type v8Challenge struct {
+	NetworkIsolation bool `gorm:"default:false"`
+	BlockEgress      bool `gorm:"default:false"`
+}
+
+func (v8Challenge) TableName() string { return "dalictf_challenge" }
+
+// ---- v9 multi_service_challenges ----
+
+type v9Challenge struct {
+	ServiceSpec string `gorm:"type:text"`
+}
+
+func (v9Challenge) TableName() string { return "dalictf_challenge" }
+
+type v9ContainerInstance struct {
+	ID           uint64 `gorm:"primarykey"`
+	ContainerID  uint32 `gorm:"not null;index"`
+	Service      string `gorm:"size:30;not null"`
+	InstanceID   string `gorm:"size:100;not null;index"`
+	InstanceName string `gorm:"size:255"`
+}
+
+func (v9ContainerInstance) TableName() string { return "dalictf_container_instance" }
+
+// ---- v10 challenge_flag_injection ----
+
+type v10Challenge struct {
+	FlagInjection  string `gorm:"size:10;default:'env'"`
+	FlagEnvName    string `gorm:"size:64"`
+	FlagPath       string `gorm:"size:255"`
+	FlagCommand    string `gorm:"type:text"`
+	FlagReadyCheck bool   `gorm:"default:false"`
+}
+
+func (v10Challenge) TableName() string { return "dalictf_challenge" }
+
+// ---- v11 challenge_flag_template ----
+
+type v11Challenge struct {
+	FlagTemplate string `gorm:"size:255"`
+}
+
+func (v11Challenge) TableName() string { return "dalictf_challenge" }
+
+// ---- v12 challenge_team_flag ----
+
+type v12Challenge struct {
+	TeamFlagFile    string `gorm:"size:255"`
+	TeamFlagContent string `gorm:"type:text"`
+}
+
+func (v12Challenge) TableName() string { return "dalictf_challenge" }
+
+// ---- v13 flag_rules ----
+
+type v13FlagRule struct {
+	ID          uint64 `gorm:"primarykey"`
+	ChallengeID uint32 `gorm:"not null;index"`
+	Kind        string `gorm:"size:20;not null"`
+	Pattern     string `gorm:"size:255;not null"`
+	SortOrder   uint   `gorm:"default:0"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (v13FlagRule) TableName() string { return "dalictf_flag_rule" }
+
+type v13SubmissionLog struct {
+	MatchedRuleID *uint64
+}
+
+func (v13SubmissionLog) TableName() string { return "dalictf_flag_information" }
+
+// ---- v14 encrypt_stored_flags ----
+
+type v14Challenge struct {
+	StaticFlag string `gorm:"size:512"`
+}
+
+func (v14Challenge) TableName() string { return "dalictf_challenge" }
+
+type v14FlagRule struct {
+	Pattern string `gorm:"size:512;not null"`
+}
+
+func (v14FlagRule) TableName() string { return "dalictf_flag_rule" }
+
+type v14FlagRevealLog struct {
+	ID          uint64 `gorm:"primarykey"`
+	ChallengeID uint32 `gorm:"not null;index"`
+	UserID      uint32 `gorm:"not null"`
+	Reason      string `gorm:"size:255;not null"`
+	IPAddress   string `gorm:"size:45"`
+	CreatedAt   time.Time
+}
+
+func (v14FlagRevealLog) TableName() string { return "dalictf_flag_reveal_log" }
+
+// ---- v15 multi_part_challenges ----
+
+type v15ChallengePart struct {
+	ID           uint32  `gorm:"primarykey"`
+	ChallengeID  uint32  `gorm:"not null;index"`
+	Position     uint    `gorm:"not null"`
+	Name         string  `gorm:"size:100;not null"`
+	Kind         string  `gorm:"size:20;not null;default:'exact'"`
+	Flag         string  `gorm:"size:512;not null"`
+	InitialScore uint    `gorm:"not null"`
+	MinScore     uint    `gorm:"not null"`
+	CurrentScore uint    `gorm:"not null"`
+	DecayRatio   float32 `gorm:"default:0.1"`
+	SolvedCount  uint    `gorm:"default:0"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (v15ChallengePart) TableName() string { return "dalictf_challenge_part" }
+
+type v15Submission struct {
+	ChallengeID uint32 `gorm:"uniqueIndex:unique_team_challenge_part;not null"`
+	PartID      uint32 `gorm:"uniqueIndex:unique_team_challenge_part;not null;default:0"`
+	TeamID      uint32 `gorm:"uniqueIndex:unique_team_challenge_part;not null"`
+}
+
+func (v15Submission) TableName() string { return "dalictf_problem_solving_record" }
+
+type v15SubmissionLog struct {
+	MatchedPartID *uint32
+}
+
+func (v15SubmissionLog) TableName() string { return "dalictf_flag_information" }
+
+type v15SolveFeed struct {
+	PartID       uint32 `gorm:"default:0"`
+	PartName     string `gorm:"size:100"`
+	PartPosition uint   `gorm:"default:0"`
+	PartCount    uint   `gorm:"default:0"`
+	PartsSolved  uint   `gorm:"default:0"`
+}
+
+func (v15SolveFeed) TableName() string { return "dalictf_solve_feed" }
+
+type v15Scoreboard struct {
+	Progress string `gorm:"type:text"` // JSON
+}
+
+func (v15Scoreboard) TableName() string { return "dalictf_scoreboard" }
+
+// ---- v16 contest_phases ----
+
+type v16Contest struct {
+	FreezeTime   *time.Time
+	PracticeMode bool `gorm:"not null;default:false"`
+}
+
+func (v16Contest) TableName() string { return "dalictf_contest" }
+
+// ---- v17 scoreboard_freeze ----
+
+type v17Scoreboard struct {
+	Frozen bool `gorm:"not null;default:false"`
+}
+
+func (v17Scoreboard) TableName() string { return "dalictf_scoreboard" }
+
+type v17Contest struct {
+	RevealedAt *time.Time
+}
+
+func (v17Contest) TableName() string { return "dalictf_contest" }
+
+// ---- v18 multi_contest ----
+
+type v18Challenge struct {
+	ContestID uint `gorm:"not null;default:0;index"`
+}
+
+func (v18Challenge) TableName() string { return "dalictf_challenge" }
+
+type v18Submission struct {
+	ContestID uint `gorm:"not null;default:0;index"`
+}
+
+func (v18Submission) TableName() string { return "dalictf_problem_solving_record" }
+
+type v18SubmissionLog struct {
+	ContestID uint `gorm:"not null;default:0;index"`
+}
+
+func (v18SubmissionLog) TableName() string { return "dalictf_flag_information" }
+
+type v18Container struct {
+	ContestID uint `gorm:"not null;default:0;index"`
+}
+
+func (v18Container) TableName() string { return "dalictf_container" }
+
+type v18Scoreboard struct {
+	ContestID uint `gorm:"not null;default:0;index"`
+}
+
+func (v18Scoreboard) TableName() string { return "dalictf_scoreboard" }
+
+type v18SolveFeed struct {
+	ContestID uint `gorm:"not null;default:0;index"`
+}
+
+func (v18SolveFeed) TableName() string { return "dalictf_solve_feed" }
+
+type v18Contest struct {
+	IsCurrent bool `gorm:"not null;default:false;index"`
+}
+
+func (v18Contest) TableName() string { return "dalictf_contest" }
+
+type v18ContestTeam struct {
+	ID        uint   `gorm:"primarykey"`
+	ContestID uint   `gorm:"uniqueIndex:unique_contest_team;not null"`
+	TeamID    uint32 `gorm:"uniqueIndex:unique_contest_team;not null"`
+	CreatedAt time.Time
+}
+
+func (v18ContestTeam) TableName() string { return "dalictf_contest_teams" }
+
+// ---- v19 scoring_formulas ----
+
+type v19Challenge struct {
+	ScoreFormula string `gorm:"size:20;not null;default:'linear'"`
+	ScoreDecay   uint   `gorm:"not null;default:0"`
+	Retroactive  bool   `gorm:"not null;default:false"`
+}
+
+func (v19Challenge) TableName() string { return "dalictf_challenge" }
+
+// ---- v20 blood_bonuses ----
+
+type v20Challenge struct {
+	BloodBonusType string `gorm:"size:10;not null;default:''"`
+	BloodBonuses   string `gorm:"type:text"` // JSON
+}
+
+func (v20Challenge) TableName() string { return "dalictf_challenge" }
+
+type v20Submission struct {
+	Blood      uint8 `gorm:"not null;default:0"`
+	BonusScore uint  `gorm:"not null;default:0"`
+}
+
+func (v20Submission) TableName() string { return "dalictf_problem_solving_record" }
+
+type v20Scoreboard struct {
+	Bloods string `gorm:"type:text"` // JSON
+}
+
+func (v20Scoreboard) TableName() string { return "dalictf_scoreboard" }
+
+type v20SolveFeed struct {
+	Blood      uint8 `gorm:"not null;default:0"`
+	BonusScore uint  `gorm:"not null;default:0"`
+}
+
+func (v20SolveFeed) TableName() string { return "dalictf_solve_feed" }
@@ -1,7 +1,13 @@
 // file: dto/challenge.go
 package dto
 
-import "strings"
+import (
+	"encoding/json"
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+)
 
 // ========== 请求 DTO ==========
 
@@ -12,15 +18,32 @@ type CreateChallengeReq struct {
 	Author          string  `json:"author"`
 	Description     string  `json:"description"`
 	Hint            string  `json:"hint"`
-	Mode            string  `json:"mode"` // static / dynamic
+	Mode            string  `json:"mode"` // static / dynamic / team
 	StaticFlag      string  `json:"static_flag"`
 	DockerImage     string  `json:"docker_image"`
-	DockerPorts     string  `json:"docker_ports"`
-	Difficulty      string  `json:"difficulty"` // easy / medium / hard
+	DockerPorts     string  `json:"docker_ports"`      // 形如 "80/http,9999"，协议可选 tcp（默认）/ http / https
+	ServiceSpec     string  `json:"service_spec"`      // 多服务题目的 compose 风格定义（YAML），填写后忽略 docker_image / docker_ports
+	FlagTemplate    string  `json:"flag_template"`     // 动态 Flag 模板，如 flag{leet_{team_hmac}}，留空使用全局默认模板
+	TeamFlagFile    string  `json:"team_flag_file"`    // team 模式的个人化附件文件名，留空则在题目页面显示 Flag
+	TeamFlagContent string  `json:"team_flag_content"` // 个人化附件内容模板，{flag} 替换为队伍的 Flag
+	Difficulty      string  `json:"difficulty"`        // easy / medium / hard
 	InitialScore    uint    `json:"initial_score"`
 	MinScore        uint    `json:"min_score"`
 	DecayRatio      float32 `json:"decay_ratio"`
 
+	// 动态容器策略（可选，不填则使用全局默认值）
+	InstancePolicyReq
+	// 动态 Flag 注入方式（可选，默认写入环境变量 DALICTF_FLAG）
+	FlagInjectionReq
+	// 计分方式（可选，不填则使用配置 scoring 中的默认值）
+	ScoringReq
+	// 静态题目的附加 Flag 规则，可与 static_flag 同时使用，也可代替 static_flag
+	FlagRules []FlagRuleReq `json:"flag_rules"`
+	// 多阶段静态题目的各部分，按顺序解锁、分别计分；设置后不能再使用 static_flag / flag_rules
+	Parts []ChallengePartReq `json:"parts"`
+	// 题目所属的比赛，不填则归入当前比赛
+	ContestID *uint `json:"contest_id"`
+
 	// 仅用于兼容旧客户端（camelCase / 大小写变体），注意：所有别名都与上面 tag 不重复
 	ChallengeNameCamel    string  `json:"challengeName"`
 	ChallengeTypeIDCamel  uint32  `json:"challengeTypeId"`
@@ -28,7 +51,7 @@ type CreateChallengeReq struct {
 	StaticFlagCamel       string  `json:"staticFlag"`
 	DockerImageCamel      string  `json:"dockerImage"`
 	DockerPortsCamel      string  `json:"dockerPorts"`
-	DifficultyCamel       string  `json:"difficulty"`
+	DifficultyCamel       string  `json:"Difficulty"`
 	InitialScoreCamel     uint    `json:"initialScore"`
 	MinScoreCamel         uint    `json:"minScore"`
 	DecayRatioCamel       float32 `json:"decayRatio"`
@@ -85,13 +108,190 @@ func (r *CreateChallengeReq) Normalize() {
 }
 
 type UpdateChallengeReq struct {
-	State       *string `json:"state"` // visible/hidden
-	Hint        *string `json:"hint"`
-	Difficulty  *string `json:"difficulty"`
-	Mode        *string `json:"mode"`
-	StaticFlag  *string `json:"static_flag"`
-	DockerImage *string `json:"docker_image"`
-	DockerPorts *string `json:"docker_ports"`
+	State           *string `json:"state"` // visible/hidden
+	Hint            *string `json:"hint"`
+	Difficulty      *string `json:"difficulty"`
+	Mode            *string `json:"mode"`
+	StaticFlag      *string `json:"static_flag"`
+	DockerImage     *string `json:"docker_image"`
+	DockerPorts     *string `json:"docker_ports"`
+	ServiceSpec     *string `json:"service_spec"`   // 传空字符串改回单镜像题目
+	FlagTemplate    *string `json:"flag_template"`  // 传空字符串恢复全局默认模板
+	TeamFlagFile    *string `json:"team_flag_file"` // 传空字符串改为在题目页面显示 Flag
+	TeamFlagContent *string `json:"team_flag_content"`
+	ContestID       *uint   `json:"contest_id"` // 把题目移到另一场比赛
+
+	// 修改分值参数或计分方式后按新的方式重算全部解题得分；多阶段题目的分值在各部分上修改
+	InitialScore *uint    `json:"initial_score"`
+	MinScore     *uint    `json:"min_score"`
+	DecayRatio   *float32 `json:"decay_ratio"`
+
+	InstancePolicyReq
+	FlagInjectionReq
+	ScoringReq
+}
+
+// ScoringReq 是题目的计分方式
+type ScoringReq struct {
+	ScoreFormula *string `json:"score_formula"` // linear / logarithmic / parabolic / static
+	ScoreDecay   *uint   `json:"score_decay"`   // logarithmic / parabolic 中分值降到 min_score 所需的解题数
+	Retroactive  *bool   `json:"retroactive"`   // 所有解题队伍的得分随题目当前分值变化
+
+	// 一二三血奖励：percent / fixed / none，空字符串表示使用配置 scoring.blood
+	BloodBonusType *string `json:"blood_bonus_type"`
+	BloodBonuses   []uint  `json:"blood_bonuses"` // 依次为一二三血的奖励，不传表示不修改
+}
+
+// Updates 返回已设置计分字段对应的列更新
+func (r ScoringReq) Updates() map[string]interface{} {
+	updates := map[string]interface{}{}
+	if r.ScoreFormula != nil {
+		updates["score_formula"] = *r.ScoreFormula
+	}
+	if r.ScoreDecay != nil {
+		updates["score_decay"] = *r.ScoreDecay
+	}
+	if r.Retroactive != nil {
+		updates["retroactive"] = *r.Retroactive
+	}
+	if r.BloodBonusType != nil {
+		updates["blood_bonus_type"] = *r.BloodBonusType
+	}
+	if r.BloodBonuses != nil {
+		// 列按 JSON 序列化存储，map 更新不经过模型的 serializer
+		bonuses, _ := json.Marshal(r.BloodBonuses)
+		updates["blood_bonuses"] = string(bonuses)
+	}
+	return updates
+}
+
+// FlagRuleReq 是一条 Flag 规则，kind 为 exact / case_insensitive / regex / trimmed
+type FlagRuleReq struct {
+	Kind      string `json:"kind" binding:"required"`
+	Pattern   string `json:"pattern" binding:"required"`
+	SortOrder uint   `json:"sort_order"`
+}
+
+// ChallengePartReq 是多阶段题目的一个部分，kind 为空时按 exact 匹配
+type ChallengePartReq struct {
+	Name         string  `json:"name" binding:"required,max=100"`
+	Kind         string  `json:"kind"`
+	Flag         string  `json:"flag" binding:"required"`
+	InitialScore uint    `json:"initial_score" binding:"required"`
+	MinScore     uint    `json:"min_score"`
+	DecayRatio   float32 `json:"decay_ratio"`
+}
+
+// Normalize 填充默认的匹配方式和衰减比例
+func (r *ChallengePartReq) Normalize() {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Kind == "" {
+		r.Kind = "exact"
+	}
+	if r.DecayRatio == 0 {
+		r.DecayRatio = 0.1
+	}
+}
+
+// Validate 检查分值设置，Flag 的匹配方式由 services.ValidateFlagRule 检查
+func (r ChallengePartReq) Validate() error {
+	if r.Name == "" {
+		return errors.New("part name is required")
+	}
+	if r.InitialScore == 0 || r.MinScore > r.InitialScore {
+		return errors.New("part initial_score must be positive and not less than min_score")
+	}
+	if r.DecayRatio < 0 || r.DecayRatio > 1 {
+		return errors.New("part decay_ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// UpdateChallengePartReq 修改部分，字段为空表示不修改
+type UpdateChallengePartReq struct {
+	Name         *string  `json:"name"`
+	Position     *uint    `json:"position"`
+	Kind         *string  `json:"kind"`
+	Flag         *string  `json:"flag"`
+	InitialScore *uint    `json:"initial_score"`
+	MinScore     *uint    `json:"min_score"`
+	DecayRatio   *float32 `json:"decay_ratio"`
+}
+
+// UpdateFlagRuleReq 修改 Flag 规则，字段为空表示不修改
+type UpdateFlagRuleReq struct {
+	Kind      *string `json:"kind"`
+	Pattern   *string `json:"pattern"`
+	SortOrder *uint   `json:"sort_order"`
+}
+
+// InstancePolicyReq 是题目级别的动态容器策略，字段为空表示不设置（沿用全局默认值或原值）
+type InstancePolicyReq struct {
+	MemoryLimitMB     *uint    `json:"memory_limit_mb"`
+	CPULimit          *float64 `json:"cpu_limit"`
+	PidsLimit         *uint    `json:"pids_limit"`
+	LifetimeMinutes   *uint    `json:"lifetime_minutes"`
+	MaxRenewals       *uint    `json:"max_renewals"` // 0 表示不允许续期
+	RenewalMinutes    *uint    `json:"renewal_minutes"`
+	MaxTeamContainers *uint    `json:"max_team_containers"`
+	NetworkIsolation  *bool    `json:"network_isolation"` // 每支队伍独立网络
+	BlockEgress       *bool    `json:"block_egress"`      // 禁止出网，需开启 HTTP 网关或 TCP 代理
+}
+
+// Validate 检查已设置的策略项是否合法
+func (p InstancePolicyReq) Validate() error {
+	if p.MemoryLimitMB != nil && *p.MemoryLimitMB < 16 {
+		return errors.New("memory_limit_mb 不能小于 16")
+	}
+	if p.CPULimit != nil && (*p.CPULimit <= 0 || *p.CPULimit > 64) {
+		return errors.New("cpu_limit 取值无效（0-64）")
+	}
+	if p.PidsLimit != nil && *p.PidsLimit == 0 {
+		return errors.New("pids_limit 必须大于 0")
+	}
+	if p.LifetimeMinutes != nil && *p.LifetimeMinutes == 0 {
+		return errors.New("lifetime_minutes 必须大于 0")
+	}
+	if p.RenewalMinutes != nil && *p.RenewalMinutes == 0 {
+		return errors.New("renewal_minutes 必须大于 0")
+	}
+	if p.MaxTeamContainers != nil && *p.MaxTeamContainers == 0 {
+		return errors.New("max_team_containers 必须大于 0")
+	}
+	return nil
+}
+
+// Updates 返回已设置策略项对应的列更新
+func (p InstancePolicyReq) Updates() map[string]interface{} {
+	updates := make(map[string]interface{})
+	if p.MemoryLimitMB != nil {
+		updates["memory_limit_mb"] = *p.MemoryLimitMB
+	}
+	if p.CPULimit != nil {
+		updates["cpu_limit"] = *p.CPULimit
+	}
+	if p.PidsLimit != nil {
+		updates["pids_limit"] = *p.PidsLimit
+	}
+	if p.LifetimeMinutes != nil {
+		updates["lifetime_minutes"] = *p.LifetimeMinutes
+	}
+	if p.MaxRenewals != nil {
+		updates["max_renewals"] = *p.MaxRenewals
+	}
+	if p.RenewalMinutes != nil {
+		updates["renewal_minutes"] = *p.RenewalMinutes
+	}
+	if p.MaxTeamContainers != nil {
+		updates["max_team_containers"] = *p.MaxTeamContainers
+	}
+	if p.NetworkIsolation != nil {
+		updates["network_isolation"] = *p.NetworkIsolation
+	}
+	if p.BlockEgress != nil {
+		updates["block_egress"] = *p.BlockEgress
+	}
+	return updates
 }
 
 type SubmitFlagReq struct {
@@ -105,6 +305,71 @@ func (r *SubmitFlagReq) Normalize() {
 	}
 }
 
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// FlagInjectionReq 是动态 Flag 的注入设置，字段为空表示不设置
+type FlagInjectionReq struct {
+	FlagInjection  *string `json:"flag_injection"`   // env / file / exec
+	FlagEnvName    *string `json:"flag_env_name"`    // env 方式的变量名，默认 DALICTF_FLAG
+	FlagPath       *string `json:"flag_path"`        // file 方式的写入路径，如 /flag
+	FlagCommand    *string `json:"flag_command"`     // exec 方式启动后执行的命令，Flag 在环境变量 DALICTF_FLAG 中
+	FlagReadyCheck *bool   `json:"flag_ready_check"` // 创建时确认 Flag 已写入实例
+}
+
+// Validate 检查注入设置。mode / flagPath / command 为题目当前的值（创建题目时为空），请求中设置的项覆盖它们
+func (f FlagInjectionReq) Validate(mode, flagPath, command string) error {
+	if f.FlagInjection != nil {
+		mode = *f.FlagInjection
+	}
+	if f.FlagPath != nil {
+		flagPath = *f.FlagPath
+	}
+	if f.FlagCommand != nil {
+		command = *f.FlagCommand
+	}
+	if f.FlagEnvName != nil && *f.FlagEnvName != "" && !envNamePattern.MatchString(*f.FlagEnvName) {
+		return errors.New("flag_env_name 不是合法的环境变量名")
+	}
+	if flagPath != "" && (!path.IsAbs(flagPath) || path.Clean(flagPath) != flagPath || flagPath == "/") {
+		return errors.New("flag_path 必须是绝对路径")
+	}
+	switch mode {
+	case "", "env":
+	case "file":
+		if flagPath == "" {
+			return errors.New("file 方式必须提供 flag_path")
+		}
+	case "exec":
+		if strings.TrimSpace(command) == "" {
+			return errors.New("exec 方式必须提供 flag_command")
+		}
+	default:
+		return errors.New("flag_injection 取值无效（env/file/exec）")
+	}
+	return nil
+}
+
+// Updates 返回已设置注入项对应的列更新
+func (f FlagInjectionReq) Updates() map[string]interface{} {
+	updates := make(map[string]interface{})
+	if f.FlagInjection != nil {
+		updates["flag_injection"] = *f.FlagInjection
+	}
+	if f.FlagEnvName != nil {
+		updates["flag_env_name"] = *f.FlagEnvName
+	}
+	if f.FlagPath != nil {
+		updates["flag_path"] = *f.FlagPath
+	}
+	if f.FlagCommand != nil {
+		updates["flag_command"] = *f.FlagCommand
+	}
+	if f.FlagReadyCheck != nil {
+		updates["flag_ready_check"] = *f.FlagReadyCheck
+	}
+	return updates
+}
+
 // ========== 响应 DTO ==========
 
 type ChallengeItemResp struct {
@@ -136,6 +401,32 @@ type ChallengeDetailResp struct {
 	Attachments   []AttachmentMini `json:"attachments"`
 	CurrentScore  uint             `json:"current_score"`
 	SolvedCount   uint             `json:"solved_count"`
+	// team 模式下当前队伍的 Flag 或个人化附件，按请求的队伍填充，不进入缓存
+	TeamFlag       string `json:"team_flag,omitempty"`
+	TeamAttachment string `json:"team_attachment,omitempty"`
+	// 多阶段题目的各部分，solved 按请求的队伍填充
+	Parts []PartMini `json:"parts,omitempty"`
+	// ContestID 是题目所属的比赛，读取缓存时据此检查请求的比赛
+	ContestID uint `json:"contest_id"`
+	// 一二三血，按请求者的封榜视图填充，不进入缓存
+	Bloods []BloodMini `json:"bloods"`
+}
+
+type BloodMini struct {
+	Blood       uint8  `json:"blood"`
+	TeamID      uint32 `json:"team_id"`
+	TeamName    string `json:"team_name"`
+	BonusScore  uint   `json:"bonus_score"`
+	SolvingTime string `json:"solving_time"`
+}
+
+type PartMini struct {
+	ID           uint32 `json:"id"`
+	Position     uint   `json:"position"`
+	Name         string `json:"name"`
+	CurrentScore uint   `json:"current_score"`
+	SolvedCount  uint   `json:"solved_count"`
+	Solved       bool   `json:"solved"`
 }
 
 // ====== Admin 专用响应 DTO ======
@@ -150,6 +441,7 @@ type AdminChallengeItemResp struct {
 	CurrentScore  uint   `json:"current_score"`
 	SolvedCount   uint   `json:"solved_count"`
 	UpdatedAt     string `json:"updated_at"`
+	ContestID     uint   `json:"contest_id"`
 }
 
 type AdminAttachmentMini struct {
@@ -162,24 +454,91 @@ type AdminAttachmentMini struct {
 }
 
 type AdminChallengeDetailResp struct {
-	ID            uint32                `json:"id"`
-	ChallengeName string                `json:"challenge_name"`
-	Type          string                `json:"type"`
-	Author        string                `json:"author"`
-	Description   string                `json:"description"`
-	Hint          string                `json:"hint"`
-	Mode          string                `json:"mode"`
-	Difficulty    string                `json:"difficulty"`
-	State         string                `json:"state"`
-	StaticFlag    string                `json:"static_flag,omitempty"` // 视需要也可不返回
-	DockerImage   string                `json:"docker_image,omitempty"`
-	DockerPorts   string                `json:"docker_ports,omitempty"`
-	CurrentScore  uint                  `json:"current_score"`
-	InitialScore  uint                  `json:"initial_score"`
-	MinScore      uint                  `json:"min_score"`
-	DecayRatio    float32               `json:"decay_ratio"`
-	SolvedCount   uint                  `json:"solved_count"`
-	Attachments   []AdminAttachmentMini `json:"attachments"`
-	CreatedAt     string                `json:"created_at"`
-	UpdatedAt     string                `json:"updated_at"`
+	ID              uint32                `json:"id"`
+	ChallengeName   string                `json:"challenge_name"`
+	Type            string                `json:"type"`
+	Author          string                `json:"author"`
+	Description     string                `json:"description"`
+	Hint            string                `json:"hint"`
+	Mode            string                `json:"mode"`
+	Difficulty      string                `json:"difficulty"`
+	State           string                `json:"state"`
+	HasStaticFlag   bool                  `json:"has_static_flag"` // Flag 加密存储，明文只能经 reveal 接口查看
+	DockerImage     string                `json:"docker_image,omitempty"`
+	DockerPorts     string                `json:"docker_ports,omitempty"`
+	ServiceSpec     string                `json:"service_spec,omitempty"`
+	FlagTemplate    string                `json:"flag_template,omitempty"`
+	TeamFlagFile    string                `json:"team_flag_file,omitempty"`
+	TeamFlagContent string                `json:"team_flag_content,omitempty"`
+	CurrentScore    uint                  `json:"current_score"`
+	InitialScore    uint                  `json:"initial_score"`
+	MinScore        uint                  `json:"min_score"`
+	DecayRatio      float32               `json:"decay_ratio"`
+	SolvedCount     uint                  `json:"solved_count"`
+	Attachments     []AdminAttachmentMini `json:"attachments"`
+	// 动态题目生效的容器策略（题目设置覆盖全局默认值后的结果）
+	InstancePolicy *InstancePolicyResp `json:"instance_policy,omitempty"`
+	FlagInjection  *FlagInjectionResp  `json:"flag_injection,omitempty"`
+	FlagRules      []FlagRuleResp      `json:"flag_rules"`
+	Parts          []ChallengePartResp `json:"parts"`
+	ContestID      uint                `json:"contest_id"`
+	ScoreFormula   string              `json:"score_formula"`
+	ScoreDecay     uint                `json:"score_decay"`
+	Retroactive    bool                `json:"retroactive"`
+	BloodBonusType string              `json:"blood_bonus_type"`
+	BloodBonuses   []uint              `json:"blood_bonuses"`
+	CreatedAt      string              `json:"created_at"`
+	UpdatedAt      string              `json:"updated_at"`
+}
+
+// FlagRuleResp 不含规则内容，规则内容只能经 reveal 接口查看
+type FlagRuleResp struct {
+	ID        uint64 `json:"id"`
+	Kind      string `json:"kind"`
+	SortOrder uint   `json:"sort_order"`
+}
+
+// ChallengePartResp 不含部分的 Flag，Flag 只能经 reveal 接口查看
+type ChallengePartResp struct {
+	ID           uint32  `json:"id"`
+	Position     uint    `json:"position"`
+	Name         string  `json:"name"`
+	Kind         string  `json:"kind"`
+	InitialScore uint    `json:"initial_score"`
+	MinScore     uint    `json:"min_score"`
+	CurrentScore uint    `json:"current_score"`
+	DecayRatio   float32 `json:"decay_ratio"`
+	SolvedCount  uint    `json:"solved_count"`
+}
+
+// RevealFlagsReq 查看明文 Flag 必须填写原因，写入审计日志
+type RevealFlagsReq struct {
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+type RevealedFlagRule struct {
+	ID        uint64 `json:"id"`
+	Kind      string `json:"kind"`
+	Pattern   string `json:"pattern"`
+	SortOrder uint   `json:"sort_order"`
+}
+
+type FlagInjectionResp struct {
+	Mode       string `json:"mode"`
+	EnvName    string `json:"env_name,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Command    string `json:"command,omitempty"`
+	ReadyCheck bool   `json:"ready_check"`
+}
+
+type InstancePolicyResp struct {
+	MemoryLimitMB     int64   `json:"memory_limit_mb"`
+	CPULimit          float64 `json:"cpu_limit"`
+	PidsLimit         int64   `json:"pids_limit"`
+	LifetimeMinutes   uint    `json:"lifetime_minutes"`
+	MaxRenewals       uint    `json:"max_renewals"`
+	RenewalMinutes    uint    `json:"renewal_minutes"`
+	MaxTeamContainers int     `json:"max_team_containers"`
+	NetworkIsolation  bool    `json:"network_isolation"`
+	BlockEgress       bool    `json:"block_egress"`
 }
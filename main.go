@@ -2,31 +2,76 @@
 package main
 
 import (
+	"ISCTF/config"
 	"ISCTF/database"
 	"ISCTF/routes"
 	"ISCTF/services" // 确保导入 services 包
+	"ISCTF/utils"
+	"context"
+	"flag"
 	"log"
+	"os"
 )
 
 func main() {
+	// 0. 加载配置：-config 参数优先，其次是环境变量 DALICTF_CONFIG
+	defaultPath := os.Getenv("DALICTF_CONFIG")
+	if defaultPath == "" {
+		defaultPath = "config.yaml"
+	}
+	configPath := flag.String("config", defaultPath, "path to the YAML config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	utils.InitJWT(cfg.JWT.Secret, cfg.JWT.Expire)
+	if err := utils.InitFlagKeys(cfg.Flag.EncryptionKeyID, cfg.Flag.EncryptionKey, cfg.Flag.RetiredKeys); err != nil {
+		log.Fatalf("Failed to initialize flag encryption: %v", err)
+	}
+
 	// 1. 连接数据库
-	database.Connect()
+	database.Connect(cfg.Database)
+
+	// 子命令 migrate 只操作数据库结构，不启动服务
+	if args := flag.Args(); len(args) > 0 {
+		if args[0] != "migrate" {
+			log.Fatalf("Unknown command %q", args[0])
+		}
+		runMigrate(args[1:])
+		return
+	}
+
+	// 拒绝在未迁移到最新版本的数据库上启动
+	if err := database.CheckSchema(); err != nil {
+		log.Fatalf("Schema check failed: %v", err)
+	}
 
 	// 2. 初始化 Redis 客户端
-	database.InitRedis()
+	database.InitRedis(cfg.Redis)
 
-	// 3. 初始化 Docker 客户端
-	services.InitDocker()
+	// 3. 初始化容器编排后端
+	if err := services.InitOrchestrator(cfg.Docker); err != nil {
+		log.Fatalf("Failed to initialize container orchestrator: %v", err)
+	}
 
-	//// 4. 自动迁移数据库表结构
-	//database.MigrateTables()
+	// 4. 启动后台任务：容器对账、销毁到期容器
+	services.StartContainerReconciler(context.Background(), cfg.Container)
+	services.StartEventWatcher(context.Background())
+	services.StartContainerReaper(context.Background(), cfg.Container)
+	if cfg.TCPProxy.Enabled {
+		if err := services.StartTCPProxy(context.Background(), cfg.TCPProxy); err != nil {
+			log.Fatalf("Failed to start TCP proxy: %v", err)
+		}
+	}
 
 	// 5. 设置并获取路由引擎
-	r := routes.SetupRouter()
+	r := routes.SetupRouter(cfg)
 
 	// 6. 启动服务器
-	log.Println("Starting server on :8080")
-	if err := r.Run(":8080"); err != nil {
+	log.Printf("Starting server on %s", cfg.Server.Addr)
+	if err := r.Run(cfg.Server.Addr); err != nil {
 		log.Fatalf("Failed to run server: %v", err)
 	}
 }
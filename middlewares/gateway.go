@@ -0,0 +1,110 @@
+// file: middlewares/gateway.go
+package middlewares
+
+import (
+	"ISCTF/config"
+	"ISCTF/services"
+	"ISCTF/utils"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const gatewayCookieName = "dalictf_gateway"
+
+// Gateway 把 <token>.<domain> 的请求反向代理到对应的动态容器，其余请求交给后续路由。
+// 必须注册在其他中间件之前，避免 CORS 等逻辑作用到题目流量上
+func Gateway(cfg config.GatewayConfig) gin.HandlerFunc {
+	suffix := "." + strings.ToLower(cfg.Domain)
+	return func(c *gin.Context) {
+		host := strings.ToLower(c.Request.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !strings.HasSuffix(host, suffix) {
+			c.Next()
+			return
+		}
+		c.Abort()
+
+		label := strings.TrimSuffix(host, suffix)
+		target, err := services.ResolveGatewayTarget(label)
+		if err != nil {
+			if !errors.Is(err, services.ErrGatewayTargetNotFound) {
+				log.Printf("Gateway: resolve %s: %v", host, err)
+			}
+			c.String(http.StatusNotFound, "instance not found or not running")
+			return
+		}
+
+		if cfg.TeamCookie {
+			if c.Request.URL.Path == services.GatewayAuthPath {
+				exchangeGatewayTicket(c, cfg, target)
+				return
+			}
+			cookie, err := c.Cookie(gatewayCookieName)
+			if err != nil {
+				c.String(http.StatusForbidden, "access denied: open this instance from the platform")
+				return
+			}
+			claims, err := utils.ParseGatewayTicket(cookie)
+			if err != nil || claims.ContainerID != target.ContainerID || claims.TeamID != target.TeamID {
+				c.String(http.StatusForbidden, "access denied: open this instance from the platform")
+				return
+			}
+		}
+
+		proxy := httputil.NewSingleHostReverseProxy(target.Upstream)
+		director := proxy.Director
+		proxy.Director = func(req *http.Request) {
+			director(req)
+			req.Header.Set("X-Forwarded-Host", c.Request.Host)
+			stripGatewayCookie(req)
+		}
+		proxy.ErrorHandler = func(w http.ResponseWriter, _ *http.Request, err error) {
+			log.Printf("Gateway: container %d upstream %s: %v", target.ContainerID, target.Upstream.Host, err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		proxy.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// exchangeGatewayTicket 校验平台签发的一次性链接，写入仅对该子域名有效的访问 Cookie 后跳转到首页
+func exchangeGatewayTicket(c *gin.Context, cfg config.GatewayConfig, target *services.GatewayTarget) {
+	claims, err := utils.ParseGatewayTicket(c.Query("ticket"))
+	if err != nil || claims.ContainerID != target.ContainerID || claims.TeamID != target.TeamID {
+		c.String(http.StatusForbidden, "invalid or expired access link")
+		return
+	}
+	cookie, err := utils.GenerateGatewayTicket(target.ContainerID, target.TeamID, cfg.CookieTTL)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "failed to issue access cookie")
+		return
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     gatewayCookieName,
+		Value:    cookie,
+		Path:     "/",
+		MaxAge:   int(cfg.CookieTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.Scheme == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Redirect(http.StatusSeeOther, "/")
+}
+
+// stripGatewayCookie 去掉网关自己的 Cookie，题目服务看不到平台凭证
+func stripGatewayCookie(req *http.Request) {
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, ck := range cookies {
+		if ck.Name != gatewayCookieName {
+			req.AddCookie(ck)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// file: migrate_cmd.go
+package main
+
+import (
+	"ISCTF/database"
+	"fmt"
+	"log"
+	"strconv"
+)
+
+// runMigrate 处理 `migrate up|down [n]|status` 子命令
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: migrate up | migrate down [steps] | migrate status")
+	}
+
+	switch args[0] {
+	case "up":
+		if err := database.MigrateUp(); err != nil {
+			log.Fatalf("Migrate up failed: %v", err)
+		}
+		log.Println("Database schema is up to date.")
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				log.Fatalf("Invalid steps %q", args[1])
+			}
+			steps = n
+		}
+		if err := database.MigrateDown(steps); err != nil {
+			log.Fatalf("Migrate down failed: %v", err)
+		}
+	case "status":
+		states, err := database.MigrationStatus()
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.Applied {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-40s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		log.Fatalf("Unknown migrate command %q", args[0])
+	}
+}
@@ -29,7 +29,7 @@ const (
 type Attachment struct {
 	ID           uint64               `gorm:"primarykey"`
 	ChallengeID  uint32               `gorm:"not null"`
-	Storage      AttachmentStorage    `gorm:"type:enum('url','object');not null"`
+	Storage      AttachmentStorage    `gorm:"size:20;not null"`
 	URL          string               `gorm:"size:2048"`
 	ObjectBucket string               `gorm:"size:63"`
 	ObjectKey    string               `gorm:"size:512"`
@@ -37,8 +37,8 @@ type Attachment struct {
 	ContentType  string               `gorm:"size:255;not null"`
 	FileSize     uint64               `gorm:"default:0"`
 	SHA256       string               `gorm:"size:64;not null"`
-	Status       AttachmentStatus     `gorm:"type:enum('pending_scan','active','quarantined','archived');default:'pending_scan'"`
-	Visibility   AttachmentVisibility `gorm:"type:enum('private','public');default:'private'"`
+	Status       AttachmentStatus     `gorm:"size:20;default:'pending_scan'"`
+	Visibility   AttachmentVisibility `gorm:"size:20;default:'private'"`
 	Version      uint16               `gorm:"default:1"`
 	SortOrder    uint                 `gorm:"default:0"`
 	CreatedBy    uint32               `gorm:"not null"`
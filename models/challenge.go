@@ -8,6 +8,9 @@ import (
 type ChallengeState string
 type ChallengeMode string
 type ChallengeDifficulty string
+type FlagInjection string
+type ScoreFormula string
+type BloodBonusType string
 
 const (
 	ChallengeStateVisible ChallengeState = "visible"
@@ -15,12 +18,30 @@ const (
 
 	ChallengeModeStatic  ChallengeMode = "static"
 	ChallengeModeDynamic ChallengeMode = "dynamic"
+	ChallengeModeTeam    ChallengeMode = "team" // 无容器，每支队伍按 Flag 模板得到各自确定的 Flag
 
 	ChallengeDifficultyEasy   ChallengeDifficulty = "easy"
 	ChallengeDifficultyMedium ChallengeDifficulty = "medium"
 	ChallengeDifficultyHard   ChallengeDifficulty = "hard"
+
+	FlagInjectionEnv  FlagInjection = "env"  // 写入环境变量
+	FlagInjectionFile FlagInjection = "file" // 启动前写入文件（Swarm 使用 secret 挂载）
+	FlagInjectionExec FlagInjection = "exec" // 启动后在实例内执行命令写入
+
+	ScoreFormulaLinear      ScoreFormula = "linear"      // 每次解题按初始分的 DecayRatio 衰减
+	ScoreFormulaLogarithmic ScoreFormula = "logarithmic" // 按解题数的对数衰减，ScoreDecay 次解题后降到最低分
+	ScoreFormulaParabolic   ScoreFormula = "parabolic"   // CTFd 动态计分，ScoreDecay 次解题后降到最低分
+	ScoreFormulaStatic      ScoreFormula = "static"      // 分值不随解题变化
+
+	BloodBonusDefault BloodBonusType = ""        // 使用配置 scoring.blood
+	BloodBonusPercent BloodBonusType = "percent" // 题目初始分的百分比
+	BloodBonusFixed   BloodBonusType = "fixed"   // 固定分数
+	BloodBonusNone    BloodBonusType = "none"    // 该题不设血奖励，仍记录一二三血
 )
 
+// DefaultFlagEnvName 是未设置 FlagEnvName 时使用的环境变量名
+const DefaultFlagEnvName = "DALICTF_FLAG"
+
 type Challenge struct {
 	ID              uint32              `gorm:"primarykey"`
 	ChallengeName   string              `gorm:"size:100;unique;not null"`
@@ -29,12 +50,12 @@ type Challenge struct {
 	Author          string              `gorm:"size:50;not null"`
 	Description     string              `gorm:"type:text;not null"`
 	Hint            string              `gorm:"type:text"`
-	State           ChallengeState      `gorm:"type:enum('visible','hidden');default:'hidden'"`
-	Mode            ChallengeMode       `gorm:"type:enum('static','dynamic');not null"`
-	StaticFlag      string              `gorm:"size:255"`
+	State           ChallengeState      `gorm:"size:20;default:'hidden'"`
+	Mode            ChallengeMode       `gorm:"size:20;not null"`
+	StaticFlag      string              `gorm:"size:512"` // 经 utils.EncryptFlag 加密存储
 	DockerImage     string              `gorm:"size:255"`
 	DockerPorts     string              `gorm:"size:50"`
-	Difficulty      ChallengeDifficulty `gorm:"type:enum('easy','medium','hard');default:'medium'"`
+	Difficulty      ChallengeDifficulty `gorm:"size:20;default:'medium'"`
 	InitialScore    uint                `gorm:"not null"`
 	MinScore        uint                `gorm:"not null"`
 	CurrentScore    uint                `gorm:"not null"`
@@ -43,6 +64,48 @@ type Challenge struct {
 	Attachments     []Attachment        `gorm:"foreignKey:ChallengeID"`
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
+
+	// 动态容器策略，NULL 表示使用配置 container.defaults 中的全局默认值
+	MemoryLimitMB     *uint
+	CPULimit          *float64
+	PidsLimit         *uint
+	LifetimeMinutes   *uint
+	MaxRenewals       *uint
+	RenewalMinutes    *uint
+	MaxTeamContainers *uint
+
+	// NetworkIsolation 为每支队伍的实例创建独立网络，实例之间无法互访
+	NetworkIsolation bool `gorm:"default:false"`
+	// BlockEgress 实例只接入无出网路由的内部网络，不发布端口，只能经 HTTP 网关或 TCP 代理访问
+	BlockEgress bool `gorm:"default:false"`
+	// ServiceSpec 多服务题目的 compose 风格定义（YAML），非空时忽略 DockerImage / DockerPorts
+	ServiceSpec string `gorm:"type:text"`
+
+	// FlagTemplate 动态 Flag 模板，如 flag{leet_{team_hmac}}，空表示使用配置 flag.default_template
+	FlagTemplate string `gorm:"size:255"`
+
+	// 每队 Flag 题目的下发方式：TeamFlagFile 为空时在题目页面显示 Flag，否则作为个人化附件下载
+	TeamFlagFile    string `gorm:"size:255"`
+	TeamFlagContent string `gorm:"type:text"` // 附件内容模板，{flag} 替换为队伍的 Flag，空表示附件只包含 Flag
+
+	// 动态 Flag 的注入方式
+	FlagInjection  FlagInjection `gorm:"size:10;default:'env'"`
+	FlagEnvName    string        `gorm:"size:64"`       // env 方式的变量名，空表示 DALICTF_FLAG
+	FlagPath       string        `gorm:"size:255"`      // file 方式写入的路径；exec 方式下就绪检查读取的路径
+	FlagCommand    string        `gorm:"type:text"`     // exec 方式在实例启动后以 sh -c 执行的命令，Flag 经环境变量 DALICTF_FLAG 传入
+	FlagReadyCheck bool          `gorm:"default:false"` // 创建容器时确认 Flag 已写入实例后才返回
+
+	// ContestID 是题目所属的比赛，0 表示平台未启用比赛
+	ContestID uint `gorm:"not null;default:0;index"`
+
+	// 计分方式，分值计算见 services.ScoreAt
+	ScoreFormula ScoreFormula `gorm:"size:20;not null;default:'linear'"`
+	ScoreDecay   uint         `gorm:"not null;default:0"`     // logarithmic / parabolic 降到最低分所需的解题数
+	Retroactive  bool         `gorm:"not null;default:false"` // 所有解题队伍的得分随题目当前分值变化，而不是保留解题时的分值
+
+	// 一二三血奖励，BloodBonuses 依次为一二三血的奖励，奖励计算见 services.BloodBonus
+	BloodBonusType BloodBonusType `gorm:"size:10;not null;default:''"`
+	BloodBonuses   []uint         `gorm:"type:text;serializer:json"`
 }
 
 func (Challenge) TableName() string {
@@ -0,0 +1,35 @@
+// file: models/challenge_part.go
+package models
+
+import (
+	"time"
+)
+
+// ChallengePart 对应 dalictf_challenge_part 表，是多阶段静态题目中的一个部分（如 user flag / root flag）。
+// 各部分按 Position 顺序解锁，分别计分和衰减；题目有部分时只匹配各部分的 Flag
+type ChallengePart struct {
+	ID           uint32       `gorm:"primarykey"`
+	ChallengeID  uint32       `gorm:"not null;index"`
+	Position     uint         `gorm:"not null"` // 从 1 开始的顺序，需先解出前面的部分
+	Name         string       `gorm:"size:100;not null"`
+	Kind         FlagRuleKind `gorm:"size:20;not null;default:'exact'"` // 匹配方式，与 Flag 规则相同
+	Flag         string       `gorm:"size:512;not null"`                // 经 utils.EncryptFlag 加密存储
+	InitialScore uint         `gorm:"not null"`
+	MinScore     uint         `gorm:"not null"`
+	CurrentScore uint         `gorm:"not null"`
+	DecayRatio   float32      `gorm:"default:0.1"`
+	SolvedCount  uint         `gorm:"default:0"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (ChallengePart) TableName() string {
+	return "dalictf_challenge_part"
+}
+
+// PartProgress 是队伍在一道多阶段题目上的进度
+type PartProgress struct {
+	ChallengeID uint32 `json:"challenge_id"`
+	Solved      uint   `json:"solved"`
+	Total       uint   `json:"total"`
+}
@@ -8,27 +8,59 @@ import (
 type ContainerState string
 
 const (
-	ContainerStateRunning   ContainerState = "running"
-	ContainerStateStopped   ContainerState = "stopped"
+	ContainerStatePending ContainerState = "pending" // 已落库，实例尚在创建中
+	ContainerStateRunning ContainerState = "running"
+	ContainerStateStopped ContainerState = "stopped" // 实例进程已退出，可能由重启策略拉起
+
 	ContainerStateDestroyed ContainerState = "destroyed"
 )
 
+// ContainerEndpoint 是容器一个端口对外的连接方式
+type ContainerEndpoint struct {
+	TargetPort    uint32 `json:"target_port"`
+	PublishedPort uint32 `json:"published_port"`
+	Host          string `json:"host"`
+	Protocol      string `json:"protocol"`           // tcp / http / https
+	Address       string `json:"address"`            // 可直接使用的地址：tcp 为 host:port，http(s) 为 URL
+	Ticket        string `json:"ticket,omitempty"`   // 经 TCP 代理连接时，连上后需先发送的票据
+	Internal      bool   `json:"internal,omitempty"` // 端口未发布，Host 为实例在内部网络中的名称，只能由网关或代理访问
+	Service       string `json:"service,omitempty"`  // 多服务题目中暴露该端口的服务
+}
+
+// InstanceStates 是实例仍存在于编排后端的状态，销毁、到期、对账都以此为准
+var InstanceStates = []ContainerState{ContainerStateRunning, ContainerStateStopped}
+
+// ActiveStates 是占用队伍容器配额的状态
+var ActiveStates = []ContainerState{ContainerStatePending, ContainerStateRunning, ContainerStateStopped}
+
 // Container 对应 dalictf_container 表
 type Container struct {
-	ID             uint32         `gorm:"primarykey"`
-	DockerID       string         `gorm:"size:64;not null"`
-	ChallengeID    uint32         `gorm:"not null"`
-	TeamID         uint32         `gorm:"not null"`
-	ContainerName  string         `gorm:"size:100;not null"`
-	DockerImage    string         `gorm:"size:255;not null"`
-	DockerPorts    string         `gorm:"size:100;not null"`
-	ContainerFlag  string         `gorm:"size:255;not null"`
-	State          ContainerState `gorm:"type:enum('running','stopped','destroyed');default:'running'"`
-	StartTime      time.Time      `gorm:"default:CURRENT_TIMESTAMP"`
-	EndTime        time.Time      `gorm:"not null"`
-	ExtendedCount  uint           `gorm:"default:0"`
-	PcapPath       string         `gorm:"size:255"`
-	AnalysisResult string         `gorm:"type:text"`
+	ID             uint32              `gorm:"primarykey"`
+	DockerID       string              `gorm:"size:64;not null"`
+	ChallengeID    uint32              `gorm:"not null"`
+	TeamID         uint32              `gorm:"not null"`
+	ContainerName  string              `gorm:"size:100;not null"`
+	DockerImage    string              `gorm:"size:255;not null"`
+	DockerPorts    string              `gorm:"size:100;not null"`
+	ContainerFlag  string              `gorm:"size:255;not null"`
+	State          ContainerState      `gorm:"size:20;default:'running'"`
+	StartTime      time.Time           `gorm:"default:CURRENT_TIMESTAMP"`
+	EndTime        time.Time           `gorm:"not null"`
+	ExtendedCount  uint                `gorm:"default:0"`
+	ExpiryWarnedAt *time.Time          // 已发送到期提醒的时间，续期后清空
+	RestartCount   uint                `gorm:"default:0"` // 实例退出后被重启策略拉起的次数
+	LastEvent      string              `gorm:"size:20"`   // 最近一次编排事件: started / died / oom / removed
+	LastEventAt    *time.Time          // 最近一次编排事件的时间
+	LastExitCode   *int                // 最近一次退出码
+	FailureReason  string              `gorm:"size:255"`                  // 最近一次异常退出的原因，供管理员排查
+	Endpoints      []ContainerEndpoint `gorm:"type:text;serializer:json"` // 创建时记录的对外连接地址
+	GatewayToken   string              `gorm:"size:32;index"`             // HTTP 网关子域名中的随机标识
+	ProxyTicket    string              `gorm:"size:32;index"`             // 连接 TCP 代理时需要发送的票据
+	PcapPath       string              `gorm:"size:255"`
+	AnalysisResult string              `gorm:"type:text"`
+
+	// ContestID 取自题目所属的比赛
+	ContestID uint `gorm:"not null;default:0;index"`
 }
 
 func (Container) TableName() string {
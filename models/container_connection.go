@@ -0,0 +1,23 @@
+// file: models/container_connection.go
+package models
+
+import (
+	"time"
+)
+
+// ContainerConnection 对应 dalictf_container_connection 表，记录经 TCP 代理建立的每条连接
+type ContainerConnection struct {
+	ID          uint64     `gorm:"primarykey"`
+	ContainerID uint32     `gorm:"not null;index"`
+	TeamID      uint32     `gorm:"not null"`
+	RemoteAddr  string     `gorm:"size:64;not null"`
+	TargetPort  uint32     `gorm:"not null"`
+	StartedAt   time.Time  `gorm:"not null"`
+	EndedAt     *time.Time // 连接仍在进行时为空
+	BytesIn     int64      `gorm:"default:0"` // 选手发往实例的字节数
+	BytesOut    int64      `gorm:"default:0"` // 实例发往选手的字节数
+}
+
+func (ContainerConnection) TableName() string {
+	return "dalictf_container_connection"
+}
@@ -0,0 +1,16 @@
+// file: models/container_instance.go
+package models
+
+// ContainerInstance 对应 dalictf_container_instance 表，记录多服务题目中一个容器记录下的各个服务实例。
+// 单镜像题目只使用 Container.DockerID，不写入该表
+type ContainerInstance struct {
+	ID           uint64 `gorm:"primarykey"`
+	ContainerID  uint32 `gorm:"not null;index"`
+	Service      string `gorm:"size:30;not null"`
+	InstanceID   string `gorm:"size:100;not null;index"`
+	InstanceName string `gorm:"size:255"`
+}
+
+func (ContainerInstance) TableName() string {
+	return "dalictf_container_instance"
+}
@@ -11,7 +11,9 @@ type ContestStatus string
 const (
 	ContestStatusPreparing ContestStatus = "preparing"
 	ContestStatusRunning   ContestStatus = "running"
+	ContestStatusFrozen    ContestStatus = "frozen" // 封榜后到比赛结束之间
 	ContestStatusEnded     ContestStatus = "ended"
+	ContestStatusPractice  ContestStatus = "practice" // 比赛结束后开放练习，提交不计分
 )
 
 // Contest 对应 dalictf_contest 表 (已添加 JSON 绑定标签)
@@ -23,11 +25,42 @@ type Contest struct {
 	StartTime    time.Time     `gorm:"not null" json:"start_time" binding:"required" time_format:"2006-01-02T15:04:05Z07:00"`
 	EndTime      time.Time     `gorm:"not null" json:"end_time" binding:"required" time_format:"2006-01-02T15:04:05Z07:00"`
 	OrganizerURL string        `gorm:"size:255" json:"organizer_url"`
-	Status       ContestStatus `gorm:"type:enum('preparing','running','ended');default:'preparing'" json:"status,omitempty"`
+	Status       ContestStatus `gorm:"size:20;default:'preparing'" json:"status,omitempty"`
 	CreatedAt    time.Time     `json:"created_at,omitempty"`
 	UpdatedAt    time.Time     `json:"updated_at,omitempty"`
+
+	// FreezeTime 之后排行榜封榜，为空表示不封榜
+	FreezeTime *time.Time `json:"freeze_time" time_format:"2006-01-02T15:04:05Z07:00"`
+	// PracticeMode 为 true 时比赛结束后进入练习阶段，提交只判定不计分
+	PracticeMode bool `gorm:"not null;default:false" json:"practice_mode"`
+	// RevealedAt 是赛后揭晓排行榜的时间，揭晓前封榜持续到比赛结束之后
+	RevealedAt *time.Time `json:"revealed_at"`
+	// IsCurrent 标记当前比赛，同一时间只有一场；未指定比赛的接口都作用于当前比赛
+	IsCurrent bool `gorm:"not null;default:false;index" json:"is_current"`
 }
 
 func (Contest) TableName() string {
 	return "dalictf_contest"
 }
+
+// Phase 按时间计算比赛所处的阶段
+func (c *Contest) Phase(now time.Time) ContestStatus {
+	switch {
+	case now.Before(c.StartTime):
+		return ContestStatusPreparing
+	case !now.Before(c.EndTime):
+		if c.PracticeMode {
+			return ContestStatusPractice
+		}
+		return ContestStatusEnded
+	case c.FreezeTime != nil && !now.Before(*c.FreezeTime):
+		return ContestStatusFrozen
+	default:
+		return ContestStatusRunning
+	}
+}
+
+// ScoreboardFrozen 返回排行榜此时是否处于封榜状态：到达封榜时间且尚未揭晓
+func (c *Contest) ScoreboardFrozen(now time.Time) bool {
+	return c.FreezeTime != nil && !now.Before(*c.FreezeTime) && c.RevealedAt == nil
+}
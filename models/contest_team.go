@@ -0,0 +1,18 @@
+// file: models/contest_team.go
+package models
+
+import (
+	"time"
+)
+
+// ContestTeam 对应 dalictf_contest_teams 表，记录队伍报名的比赛
+type ContestTeam struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	ContestID uint      `gorm:"uniqueIndex:unique_contest_team;not null" json:"contest_id"`
+	TeamID    uint32    `gorm:"uniqueIndex:unique_contest_team;not null" json:"team_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ContestTeam) TableName() string {
+	return "dalictf_contest_teams"
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContestPhase(t *testing.T) {
+	start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(8 * time.Hour)
+	freeze := end.Add(-time.Hour)
+
+	tests := []struct {
+		name     string
+		freeze   *time.Time
+		practice bool
+		now      time.Time
+		want     ContestStatus
+	}{
+		{"before start", nil, false, start.Add(-time.Second), ContestStatusPreparing},
+		{"at start", nil, false, start, ContestStatusRunning},
+		{"running without freeze", nil, false, end.Add(-time.Second), ContestStatusRunning},
+		{"before freeze", &freeze, false, freeze.Add(-time.Second), ContestStatusRunning},
+		{"at freeze", &freeze, false, freeze, ContestStatusFrozen},
+		{"frozen until end", &freeze, false, end.Add(-time.Second), ContestStatusFrozen},
+		{"at end", &freeze, false, end, ContestStatusEnded},
+		{"after end", nil, false, end.Add(time.Hour), ContestStatusEnded},
+		{"practice after end", &freeze, true, end, ContestStatusPractice},
+		{"practice mode while running", nil, true, start.Add(time.Hour), ContestStatusRunning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Contest{StartTime: start, EndTime: end, FreezeTime: tt.freeze, PracticeMode: tt.practice}
+			if got := c.Phase(tt.now); got != tt.want {
+				t.Errorf("Phase(%s) = %s, want %s", tt.now.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContestScoreboardFrozen(t *testing.T) {
+	start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	end := start.Add(8 * time.Hour)
+	freeze := end.Add(-time.Hour)
+	revealed := end.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		freeze   *time.Time
+		revealed *time.Time
+		now      time.Time
+		want     bool
+	}{
+		{"no freeze time", nil, nil, end.Add(-time.Minute), false},
+		{"before freeze", &freeze, nil, freeze.Add(-time.Second), false},
+		{"at freeze", &freeze, nil, freeze, true},
+		{"stays frozen after end until revealed", &freeze, nil, end.Add(24 * time.Hour), true},
+		{"revealed", &freeze, &revealed, revealed, false},
+		{"revealed before reaching freeze", &freeze, &revealed, freeze.Add(-time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Contest{StartTime: start, EndTime: end, FreezeTime: tt.freeze, RevealedAt: tt.revealed}
+			if got := c.ScoreboardFrozen(tt.now); got != tt.want {
+				t.Errorf("ScoreboardFrozen(%s) = %v, want %v", tt.now.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// file: models/flag_reveal_log.go
+package models
+
+import (
+	"time"
+)
+
+// FlagRevealLog 对应 dalictf_flag_reveal_log 表，记录 root_admin 查看题目明文 Flag 的操作
+type FlagRevealLog struct {
+	ID          uint64 `gorm:"primarykey"`
+	ChallengeID uint32 `gorm:"not null;index"`
+	UserID      uint32 `gorm:"not null"`
+	Reason      string `gorm:"size:255;not null"`
+	IPAddress   string `gorm:"size:45"`
+	CreatedAt   time.Time
+}
+
+func (FlagRevealLog) TableName() string {
+	return "dalictf_flag_reveal_log"
+}
@@ -0,0 +1,30 @@
+// file: models/flag_rule.go
+package models
+
+import (
+	"time"
+)
+
+type FlagRuleKind string
+
+const (
+	FlagRuleExact           FlagRuleKind = "exact"            // 逐字节相同
+	FlagRuleCaseInsensitive FlagRuleKind = "case_insensitive" // 忽略大小写
+	FlagRuleRegex           FlagRuleKind = "regex"            // 整串匹配正则（RE2 语法）
+	FlagRuleTrimmed         FlagRuleKind = "trimmed"          // 去掉首尾空白后相同
+)
+
+// FlagRule 对应 dalictf_flag_rule 表，是静态题目除 StaticFlag 之外可接受的答案，按 SortOrder 依次匹配
+type FlagRule struct {
+	ID          uint64       `gorm:"primarykey"`
+	ChallengeID uint32       `gorm:"not null;index"`
+	Kind        FlagRuleKind `gorm:"size:20;not null"`
+	Pattern     string       `gorm:"size:512;not null"` // 经 utils.EncryptFlag 加密存储
+	SortOrder   uint         `gorm:"default:0"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (FlagRule) TableName() string {
+	return "dalictf_flag_rule"
+}
@@ -19,7 +19,7 @@ type School struct {
 	SchoolName     string         `gorm:"column:school_name;size:100;unique;not null" json:"school_name"`
 	InvitationCode string         `gorm:"size:20;unique;not null" json:"invitation_code"`
 	UserCount      uint32         `gorm:"default:0" json:"user_count"`
-	Status         SchoolStatus   `gorm:"type:enum('active','suspended');default:'active';not null" json:"status"`
+	Status         SchoolStatus   `gorm:"size:20;default:'active';not null" json:"status"`
 	CreatedAt      time.Time      `json:"created_at"`
 	UpdatedAt      time.Time      `json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"` // GORM 的软删除支持, JSON中忽略
@@ -20,11 +20,20 @@ type Scoreboard struct {
 	TeamID        uint32          `gorm:"not null"`
 	TeamName      string          `gorm:"size:100;not null"`
 	SchoolName    *string         `gorm:"size:100"`
-	Track         ScoreboardTrack `gorm:"type:enum('freshman','advanced','society','overall');not null"`
+	Track         ScoreboardTrack `gorm:"size:20;not null"`
 	Score         uint            `gorm:"not null"`
 	LastSolveTime *time.Time
 	Rank          uint `gorm:"not null"`
 	UpdatedAt     time.Time
+
+	// Progress 是队伍在各多阶段题目上已解出的部分数
+	Progress []PartProgress `gorm:"type:text;serializer:json"`
+	// Frozen 为 true 的行只统计封榜前的解题记录，封榜期间向公众展示
+	Frozen bool `gorm:"not null;default:false"`
+	// ContestID 是该排行榜所属的比赛
+	ContestID uint `gorm:"not null;default:0;index"`
+	// Bloods 是队伍拿到的一二三血，Score 已包含血奖励
+	Bloods []TeamBlood `gorm:"type:text;serializer:json"`
 }
 
 func (Scoreboard) TableName() string {
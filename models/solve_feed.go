@@ -15,6 +15,19 @@ type SolveFeed struct {
 	SchoolName    *string   `gorm:"size:100"`
 	Score         uint      `gorm:"not null"`
 	SolvingTime   time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+
+	// 多阶段题目解出的部分及该队伍的进度，单 Flag 题目为空
+	PartID       uint32 `gorm:"default:0"`
+	PartName     string `gorm:"size:100"`
+	PartPosition uint   `gorm:"default:0"`
+	PartCount    uint   `gorm:"default:0"`
+	PartsSolved  uint   `gorm:"default:0"`
+
+	// ContestID 是解题所属的比赛
+	ContestID uint `gorm:"not null;default:0;index"`
+	// Blood 为 1/2/3 表示这次解题拿到一二三血，BonusScore 是血奖励分，不含在 Score 中
+	Blood      uint8 `gorm:"not null;default:0"`
+	BonusScore uint  `gorm:"not null;default:0"`
 }
 
 func (SolveFeed) TableName() string {
@@ -5,14 +5,30 @@ import (
 	"time"
 )
 
-// Submission 结构体现在对应解题得分表 dalictf_problem_solving_record
+// Submission 结构体现在对应解题得分表 dalictf_problem_solving_record。
+// 多阶段题目每个部分一条记录，单 Flag 题目的 PartID 为 0
 type Submission struct {
 	ID          uint32    `gorm:"primarykey" json:"id"`
-	ChallengeID uint32    `gorm:"uniqueIndex:unique_team_challenge;not null" json:"challenge_id"`
-	TeamID      uint32    `gorm:"uniqueIndex:unique_team_challenge;not null" json:"team_id"`
+	ChallengeID uint32    `gorm:"uniqueIndex:unique_team_challenge_part;not null" json:"challenge_id"`
+	PartID      uint32    `gorm:"uniqueIndex:unique_team_challenge_part;not null;default:0" json:"part_id"`
+	TeamID      uint32    `gorm:"uniqueIndex:unique_team_challenge_part;not null" json:"team_id"`
 	UserID      uint32    `gorm:"not null" json:"user_id"`
 	Score       uint      `gorm:"not null" json:"score"`
 	SolvingTime time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"solving_time"`
+
+	// ContestID 取自题目所属的比赛，排行榜按比赛统计
+	ContestID uint `gorm:"not null;default:0;index" json:"contest_id"`
+
+	// Blood 为 1/2/3 表示该记录是题目的一二三血，0 表示不是；多阶段题目记在解出最后一个部分的记录上
+	Blood uint8 `gorm:"not null;default:0" json:"blood"`
+	// BonusScore 是血奖励分，与 Score 分开存储，队伍总分为两者之和
+	BonusScore uint `gorm:"not null;default:0" json:"bonus_score"`
+}
+
+// TeamBlood 是队伍拿到的一次血，排行榜按队伍展示
+type TeamBlood struct {
+	ChallengeID uint32 `json:"challenge_id"`
+	Blood       uint8  `json:"blood"`
 }
 
 func (Submission) TableName() string {
@@ -11,6 +11,9 @@ const (
 	FlagResultCorrect   FlagResult = "correct"
 	FlagResultWrong     FlagResult = "wrong"
 	FlagResultDuplicate FlagResult = "duplicate"
+	FlagResultLocked    FlagResult = "locked"    // 多阶段题目中命中了尚未解锁的部分
+	FlagResultThrottled FlagResult = "throttled" // 超出提交频率限制，未做比对
+	FlagResultPractice  FlagResult = "practice"  // 赛后练习阶段的正确提交，不计分
 )
 
 // SubmissionLog 对应 dalictf_flag_information 表
@@ -20,10 +23,13 @@ type SubmissionLog struct {
 	TeamID         uint32     `gorm:"not null"`
 	UserID         uint32     `gorm:"not null"`
 	SubmittedFlag  string     `gorm:"size:255;not null"`
-	FlagResult     FlagResult `gorm:"type:enum('correct','wrong','duplicate');not null"`
+	FlagResult     FlagResult `gorm:"size:20;not null"`
 	SubmissionTime time.Time  `gorm:"default:CURRENT_TIMESTAMP"`
 	IPAddress      string     `gorm:"size:45"`
-	Suspected      bool       `gorm:"default:0"` // 新增字段
+	Suspected      bool       `gorm:"default:false"` // 新增字段
+	MatchedRuleID  *uint64    // 静态题目命中的 Flag 规则，命中 StaticFlag 或非静态题目时为空
+	MatchedPartID  *uint32    // 多阶段题目命中的部分
+	ContestID      uint       `gorm:"not null;default:0;index"` // 题目所属的比赛
 }
 
 func (SubmissionLog) TableName() string {
@@ -21,10 +21,10 @@ type Team struct {
 	Leader         User         `gorm:"foreignKey:LeaderID" json:"leader"`
 	SchoolID       *uint32      `json:"school_id"`
 	School         *School      `gorm:"foreignKey:SchoolID" json:"school"`
-	Track          UserTrack    `gorm:"type:enum('freshman','advanced','society');not null" json:"track"`
+	Track          UserTrack    `gorm:"size:20;not null" json:"track"`
 	InvitationCode string       `gorm:"size:20;unique;not null" json:"invitation_code"`
 	TeamDescribe   string       `gorm:"type:text" json:"team_describe"`
-	TeamStatus     TeamStatus   `gorm:"type:enum('active','banned','hidden');default:'active'" json:"team_status"`
+	TeamStatus     TeamStatus   `gorm:"size:20;default:'active'" json:"team_status"`
 	CreatedAt      time.Time    `json:"created_at"`
 	UpdatedAt      time.Time    `json:"updated_at"`
 	Members        []TeamMember `gorm:"foreignKey:TeamID" json:"members"`
@@ -16,7 +16,7 @@ type TeamMember struct {
 	TeamID   uint32         `gorm:"uniqueIndex:unique_team_user;not null"`
 	UserID   uint32         `gorm:"uniqueIndex:unique_team_user;not null"`
 	User     User           `gorm:"foreignKey:UserID"`
-	Role     TeamMemberRole `gorm:"type:enum('leader','member');default:'member'"`
+	Role     TeamMemberRole `gorm:"size:20;default:'member'"`
 	JoinedAt time.Time
 }
 
@@ -32,10 +32,10 @@ type User struct {
 	SchoolID      *uint32    `json:"school_id,omitempty"`
 	School        *School    `gorm:"foreignKey:SchoolID" json:"school,omitempty"`
 	StudentNumber string     `gorm:"size:50" json:"student_number,omitempty"`
-	GradeYear     *int       `gorm:"type:year" json:"grade_year,omitempty"`
-	Track         UserTrack  `gorm:"type:enum('freshman','advanced','society');not null;default:'society'" json:"track"`
-	Role          UserRole   `gorm:"type:enum('user','admin','root_admin');not null;default:'user'" json:"role"`
-	Status        UserStatus `gorm:"type:enum('active','banned');not null;default:'active'" json:"status"`
+	GradeYear     *int       `json:"grade_year,omitempty"`
+	Track         UserTrack  `gorm:"size:20;not null;default:'society'" json:"track"`
+	Role          UserRole   `gorm:"size:20;not null;default:'user'" json:"role"`
+	Status        UserStatus `gorm:"size:20;not null;default:'active'" json:"status"`
 	CreatedAt     time.Time  `json:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at"`
 }
@@ -2,6 +2,7 @@
 package routes
 
 import (
+	"ISCTF/config"
 	"ISCTF/controllers"
 	"ISCTF/middlewares"
 	"ISCTF/models"
@@ -10,12 +11,18 @@ import (
 	"time"
 )
 
-func SetupRouter() *gin.Engine {
+func SetupRouter(cfg *config.Config) *gin.Engine {
+	gin.SetMode(cfg.Server.Mode)
 	r := gin.Default()
 
+	// HTTP 网关按 Host 分流，题目子域名的请求不会进入下面的 API 路由
+	if cfg.Gateway.Enabled {
+		r.Use(middlewares.Gateway(cfg.Gateway))
+	}
+
 	r.Use(cors.New(cors.Config{
-		// 允许访问的源，这里直接指定你的前端开发服务器地址
-		AllowOrigins: []string{"http://localhost:5173"},
+		// 允许访问的源，由配置文件 cors.allow_origins 指定
+		AllowOrigins: cfg.CORS.AllowOrigins,
 		// 允许的请求方法
 		AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		// 允许的请求头
@@ -40,10 +47,14 @@ func SetupRouter() *gin.Engine {
 			usersPublic.POST("/login", controllers.Login)
 		}
 		// 比赛大屏
+		// 封榜期间按登录身份区分展示内容，未登录也可以访问
 		scoreboardRoutes := apiV1.Group("/scoreboard")
+		scoreboardRoutes.Use(middlewares.JWTTryAuthMiddleware())
 		{
 			scoreboardRoutes.GET("", controllers.GetScoreboard)
 			scoreboardRoutes.GET("/feed", controllers.GetSolveFeed)
+			scoreboardRoutes.GET("/bloods", controllers.GetBloods)
+			scoreboardRoutes.GET("/replay", controllers.GetScoreboardReplay)
 		}
 		// 比赛基础信息
 		contestRoutes := apiV1.Group("/contest")
@@ -51,6 +62,9 @@ func SetupRouter() *gin.Engine {
 			contestRoutes.GET("/current", controllers.GetCurrentContest)
 			contestRoutes.GET("/status", controllers.GetContestStatus)
 		}
+		// 比赛列表，往届比赛同样可以查看
+		apiV1.GET("/contests", controllers.ListContests)
+		apiV1.GET("/contests/:id", controllers.GetContest)
 		// 学校列表
 		apiV1.GET("/schools", controllers.GetSchoolList)
 		apiV1.GET("/schools/:id", middlewares.JWTTryAuthMiddleware(), controllers.GetSchoolDetail)
@@ -83,27 +97,40 @@ func SetupRouter() *gin.Engine {
 				teamRoutes.GET("/:id/solves", controllers.GetTeamSolves)
 			}
 
+			// 比赛报名
+			authRequired.POST("/contests/:id/register", controllers.RegisterContest)
+			authRequired.DELETE("/contests/:id/register", controllers.WithdrawContest)
+
+			// 答题相关接口按比赛阶段放行，见 contest.phases
+			viewGate := middlewares.ContestGate(cfg.Contest, middlewares.ContestActionView)
+			submitGate := middlewares.ContestGate(cfg.Contest, middlewares.ContestActionSubmit)
+			containerGate := middlewares.ContestGate(cfg.Contest, middlewares.ContestActionContainer)
+
 			// 题目
 			challengeRoutes := authRequired.Group("/challenges")
 			{
-				challengeRoutes.GET("", controllers.ListChallenges)
-				challengeRoutes.GET("/:id", controllers.GetChallengeDetail)
-				challengeRoutes.POST("/:id/submit", controllers.SubmitFlag)
-				challengeRoutes.GET("/:id/attachments", controllers.ListAttachments)
+				challengeRoutes.GET("", viewGate, controllers.ListChallenges)
+				challengeRoutes.GET("/:id", viewGate, controllers.GetChallengeDetail)
+				challengeRoutes.POST("/:id/submit", submitGate, controllers.SubmitFlag)
+				challengeRoutes.GET("/:id/attachments", viewGate, controllers.ListAttachments)
+				challengeRoutes.GET("/:id/team-attachment", viewGate, controllers.DownloadTeamAttachment)
 			}
 
 			// 附件下载
 			attachmentRoutes := authRequired.Group("/attachments")
 			{
-				attachmentRoutes.GET("/:attachment_id/download", controllers.DownloadAttachment)
+				attachmentRoutes.GET("/:attachment_id/download", viewGate, controllers.DownloadAttachment)
 			}
 
-			// 动态容器
+			// 动态容器，查询和销毁不受比赛阶段限制
 			containerRoutes := authRequired.Group("/containers")
 			{
-				containerRoutes.POST("", controllers.CreateContainer)
+				containerRoutes.POST("", containerGate, controllers.CreateContainer)
 				containerRoutes.GET("", controllers.ListContainers)
-				containerRoutes.PUT("/:id/renew", controllers.RenewContainer)
+				containerRoutes.GET("/notices", controllers.ListContainerNotices)
+				containerRoutes.GET("/:id", controllers.GetContainer)
+				containerRoutes.GET("/:id/access", controllers.GetContainerAccess)
+				containerRoutes.PUT("/:id/renew", containerGate, controllers.RenewContainer)
 				containerRoutes.DELETE("/:id", controllers.DestroyContainer)
 			}
 		}
@@ -143,6 +170,19 @@ func SetupRouter() *gin.Engine {
 			adminAPIs.DELETE("/challenges/:id", controllers.DeleteChallenge)
 			adminAPIs.GET("/challenges", controllers.AdminListChallenges)
 			adminAPIs.GET("/challenges/:id", controllers.AdminGetChallengeDetail)
+			adminAPIs.POST("/challenges/:id/rescore", controllers.RescoreChallenge)
+
+			// Flag 规则管理
+			adminAPIs.GET("/challenges/:id/flag-rules", controllers.ListFlagRules)
+			adminAPIs.POST("/challenges/:id/flag-rules", controllers.AddFlagRule)
+			adminAPIs.PUT("/flag-rules/:rule_id", controllers.UpdateFlagRule)
+			adminAPIs.DELETE("/flag-rules/:rule_id", controllers.DeleteFlagRule)
+
+			// 多阶段题目管理
+			adminAPIs.GET("/challenges/:id/parts", controllers.ListChallengeParts)
+			adminAPIs.POST("/challenges/:id/parts", controllers.AddChallengePart)
+			adminAPIs.PUT("/challenge-parts/:part_id", controllers.UpdateChallengePart)
+			adminAPIs.DELETE("/challenge-parts/:part_id", controllers.DeleteChallengePart)
 
 			// 附件管理
 			adminAPIs.POST("/challenges/:id/attachments", controllers.AddAttachment)
@@ -151,16 +191,31 @@ func SetupRouter() *gin.Engine {
 			adminAPIs.POST("/attachments/:attachment_id/rescan", controllers.RescanAttachment)
 
 			// 动态容器管理
+			adminAPIs.GET("/containers/drift", controllers.GetContainerDrift)
+			adminAPIs.GET("/containers/:id", controllers.AdminGetContainer)
 			adminAPIs.GET("/containers/:id/pcap", controllers.GetPcapLog)
+			adminAPIs.GET("/containers/:id/connections", controllers.AdminListContainerConnections)
 			adminAPIs.DELETE("/containers/:id", controllers.AdminDestroyContainer)
 
 			// Flag 审计
 			adminAPIs.GET("/flags/logs", controllers.GetFlagLogs)
 			adminAPIs.PUT("/flags/:id/suspect", controllers.MarkSuspectSubmission)
 			adminAPIs.GET("/flags/compare", controllers.CompareFlagSubmissions)
+			adminAPIs.GET("/flags/trace", controllers.TraceFlag)
+			adminAPIs.GET("/flags/reveals", middlewares.RoleAuthMiddleware(models.RoleRootAdmin), controllers.ListFlagReveals)
+			adminAPIs.POST("/challenges/:id/flags/reveal", middlewares.RoleAuthMiddleware(models.RoleRootAdmin), controllers.RevealChallengeFlags)
 
 			// 比赛信息管理
 			adminAPIs.POST("/contest", controllers.UpsertContest)
+			adminAPIs.POST("/contest/reveal", controllers.RevealScoreboard)
+			adminAPIs.POST("/contests", controllers.CreateContest)
+			adminAPIs.PUT("/contests/:id", controllers.UpdateContest)
+			adminAPIs.POST("/contests/:id/switch", controllers.SwitchContest)
+			adminAPIs.POST("/contests/:id/reveal", controllers.RevealScoreboard)
+			adminAPIs.POST("/contests/:id/rescore", controllers.RescoreContest)
+			adminAPIs.GET("/contests/:id/teams", controllers.ListContestTeams)
+			adminAPIs.POST("/contests/:id/teams", controllers.AddContestTeam)
+			adminAPIs.DELETE("/contests/:id/teams/:team_id", controllers.RemoveContestTeam)
 			adminAPIs.POST("/contest/schools", controllers.AddContestSchool)
 			adminAPIs.DELETE("/contest/schools/:id", controllers.DeleteContestSchool)
 			adminAPIs.POST("/contest/sponsors", controllers.AddContestSponsor)
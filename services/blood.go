@@ -0,0 +1,165 @@
+// file: services/blood.go
+package services
+
+import (
+	"ISCTF/config"
+	"ISCTF/database"
+	"ISCTF/models"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxBlood 是记录的血的名次数：一血、二血、三血
+const maxBlood = 3
+
+// ValidateBloodBonus 检查题目单独设置的血奖励
+func ValidateBloodBonus(kind models.BloodBonusType, bonuses []uint) error {
+	switch kind {
+	case models.BloodBonusDefault, models.BloodBonusNone, models.BloodBonusFixed:
+	case models.BloodBonusPercent:
+		for _, bonus := range bonuses {
+			if bonus > 100 {
+				return fmt.Errorf("blood bonus %d%% exceeds 100%%", bonus)
+			}
+		}
+	default:
+		return fmt.Errorf("blood_bonus_type %q is invalid (percent/fixed/none, empty for the global setting)", kind)
+	}
+	if len(bonuses) > maxBlood {
+		return fmt.Errorf("blood_bonuses allows at most %d entries", maxBlood)
+	}
+	return nil
+}
+
+// BloodBonus 返回题目第 blood 血的奖励分。题目未单独设置时使用配置 scoring.blood；
+// percent 按题目初始分（多阶段题目为各部分初始分之和）计算，不随分值衰减
+func BloodBonus(ch models.Challenge, blood uint8) uint {
+	kind, bonuses := ch.BloodBonusType, ch.BloodBonuses
+	if kind == models.BloodBonusDefault {
+		kind, bonuses = models.BloodBonusType(config.C.Scoring.Blood.Type), config.C.Scoring.Blood.Bonuses
+	}
+	if blood == 0 || int(blood) > len(bonuses) {
+		return 0
+	}
+	bonus := bonuses[blood-1]
+	switch kind {
+	case models.BloodBonusPercent:
+		return uint(math.Round(float64(ch.InitialScore) * float64(bonus) / 100))
+	case models.BloodBonusFixed:
+		return bonus
+	default:
+		return 0
+	}
+}
+
+// AssignBlood 在队伍解出题目后判断是否为前三血，是则在 solve 上记录名次和奖励分。
+// 多阶段题目在解出最后一个部分时调用。tx 应为事务，题目行会被加锁以保证名次不重复
+func AssignBlood(tx *gorm.DB, ch models.Challenge, solve *models.Submission) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Challenge{}, ch.ID).Error; err != nil {
+		return err
+	}
+	var taken int64
+	if err := tx.Model(&models.Submission{}).Where("challenge_id = ? AND blood > 0", ch.ID).Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken >= maxBlood {
+		return nil
+	}
+	solve.Blood = uint8(taken + 1)
+	solve.BonusScore = BloodBonus(ch, solve.Blood)
+	return tx.Model(solve).UpdateColumns(map[string]interface{}{
+		"blood":       solve.Blood,
+		"bonus_score": solve.BonusScore,
+	}).Error
+}
+
+// rescoreBloods 按解题记录重新排定题目的一二三血，并按当前的奖励设置计算奖励分。
+// 多阶段题目以解出 parts 中最后一个部分的记录为准，已删除部分的记录不再参与排定
+func rescoreBloods(tx *gorm.DB, ch models.Challenge, parts []models.ChallengePart) error {
+	var solves []models.Submission
+	query := tx.Where("challenge_id = ?", ch.ID).Order("solving_time ASC, id ASC")
+	if len(parts) == 0 {
+		query = query.Where("part_id = ?", 0)
+	} else {
+		query = query.Where("part_id IN ?", partIDs(parts))
+	}
+	if err := query.Find(&solves).Error; err != nil {
+		return err
+	}
+
+	bloods := make(map[uint32]uint8, maxBlood)
+	need := max(len(parts), 1)
+	counts := make(map[uint32]int)
+	for _, solve := range solves {
+		counts[solve.TeamID]++
+		if counts[solve.TeamID] != need {
+			continue
+		}
+		bloods[solve.ID] = uint8(len(bloods) + 1)
+		if len(bloods) == maxBlood {
+			break
+		}
+	}
+
+	if err := tx.Model(&models.Submission{}).
+		Where("challenge_id = ? AND blood > 0", ch.ID).
+		UpdateColumns(map[string]interface{}{"blood": 0, "bonus_score": 0}).Error; err != nil {
+		return err
+	}
+	for id, blood := range bloods {
+		if err := tx.Model(&models.Submission{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+			"blood":       blood,
+			"bonus_score": BloodBonus(ch, blood),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BloodHolder 是题目的一次血
+type BloodHolder struct {
+	ChallengeID   uint32    `json:"challenge_id"`
+	ChallengeName string    `json:"challenge_name"`
+	Blood         uint8     `json:"blood"`
+	TeamID        uint32    `json:"team_id"`
+	TeamName      string    `json:"team_name"`
+	BonusScore    uint      `json:"bonus_score"`
+	SolvingTime   time.Time `json:"solving_time"`
+}
+
+// BloodQuery 描述要查询的血
+type BloodQuery struct {
+	ContestID   uint
+	ChallengeID uint32     // 不为 0 时只查询该题目
+	Until       *time.Time // 封榜期间只返回该时间之前的血和 TeamID 自己的血
+	TeamID      uint32
+	VisibleOnly bool // 只返回已上线题目的血
+}
+
+// ListBloods 按题目和名次返回一场比赛的一二三血
+func ListBloods(q BloodQuery) ([]BloodHolder, error) {
+	query := database.DB.Table("dalictf_problem_solving_record r").
+		Select("r.challenge_id, c.challenge_name, r.blood, r.team_id, t.team_name, r.bonus_score, r.solving_time").
+		Joins("JOIN dalictf_challenge c ON r.challenge_id = c.id").
+		Joins("JOIN dalictf_team t ON r.team_id = t.id").
+		Where("r.contest_id = ? AND r.blood > 0", q.ContestID)
+	if q.ChallengeID != 0 {
+		query = query.Where("r.challenge_id = ?", q.ChallengeID)
+	}
+	if q.Until != nil {
+		query = query.Where("r.solving_time < ? OR r.team_id = ?", *q.Until, q.TeamID)
+	}
+	if q.VisibleOnly {
+		query = query.Where("c.state = ?", models.ChallengeStateVisible)
+	}
+	bloods := []BloodHolder{}
+	if err := query.Order("r.challenge_id asc, r.blood asc").Scan(&bloods).Error; err != nil {
+		return nil, err
+	}
+	return bloods, nil
+}
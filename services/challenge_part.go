@@ -0,0 +1,161 @@
+// file: services/challenge_part.go
+package services
+
+import (
+	"ISCTF/database"
+	"ISCTF/models"
+	"ISCTF/utils"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LoadChallengeParts 按顺序读取题目的各部分并解密 Flag，单 Flag 题目返回空列表
+func LoadChallengeParts(challengeID uint32) ([]models.ChallengePart, error) {
+	var parts []models.ChallengePart
+	if err := database.DB.Where("challenge_id = ?", challengeID).Order("position ASC, id ASC").Find(&parts).Error; err != nil {
+		return nil, err
+	}
+	for i := range parts {
+		flag, err := utils.DecryptFlag(parts[i].Flag)
+		if err != nil {
+			return nil, fmt.Errorf("challenge part %d: %w", parts[i].ID, err)
+		}
+		parts[i].Flag = flag
+	}
+	return parts, nil
+}
+
+// MatchPart 返回 Flag 命中的部分，均不命中时返回 nil
+func MatchPart(parts []models.ChallengePart, flag string) *models.ChallengePart {
+	for i := range parts {
+		if matchFlagRule(models.FlagRule{Kind: parts[i].Kind, Pattern: parts[i].Flag}, flag) {
+			return &parts[i]
+		}
+	}
+	return nil
+}
+
+// PartUnlocked 表示排在 part 之前的部分都已解出
+func PartUnlocked(parts []models.ChallengePart, solved []uint32, part *models.ChallengePart) bool {
+	for _, p := range parts {
+		if p.ID == part.ID {
+			return true
+		}
+		if !slices.Contains(solved, p.ID) {
+			return false
+		}
+	}
+	return true
+}
+
+// SyncPartScores 按各部分重新计算多阶段题目的汇总分值，解题数为解出全部部分的队伍数。
+// 在解题、增删部分后调用，tx 可以是事务
+func SyncPartScores(tx *gorm.DB, challengeID uint32) error {
+	var parts []models.ChallengePart
+	if err := tx.Where("challenge_id = ?", challengeID).Find(&parts).Error; err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	var initial, minScore, current uint
+	for _, p := range parts {
+		initial += p.InitialScore
+		minScore += p.MinScore
+		current += p.CurrentScore
+	}
+
+	var fullSolvers []uint32
+	err := tx.Model(&models.Submission{}).
+		Where("challenge_id = ? AND part_id IN ?", challengeID, partIDs(parts)).
+		Group("team_id").
+		Having("COUNT(*) = ?", len(parts)).
+		Pluck("team_id", &fullSolvers).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&models.Challenge{}).Where("id = ?", challengeID).Updates(map[string]interface{}{
+		"initial_score": initial,
+		"min_score":     minScore,
+		"current_score": current,
+		"solved_count":  len(fullSolvers),
+	}).Error
+}
+
+// ChallengePartProgress 统计各队伍在一场比赛的多阶段题目上已解出的部分数，键为队伍 ID。
+// until 不为空时只统计该时间之前的解题记录
+func ChallengePartProgress(contestID uint, until *time.Time) (map[uint32][]models.PartProgress, error) {
+	type partCount struct {
+		ChallengeID uint32
+		Total       uint
+	}
+	var totals []partCount
+	if err := database.DB.Model(&models.ChallengePart{}).
+		Select("challenge_id, COUNT(*) AS total").
+		Group("challenge_id").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	if len(totals) == 0 {
+		return nil, nil
+	}
+
+	type solvedCount struct {
+		TeamID      uint32
+		ChallengeID uint32
+		Solved      uint
+	}
+	var solved []solvedCount
+	// 只统计仍存在的部分，已删除部分的解题记录不计入进度
+	query := database.DB.Table("dalictf_problem_solving_record r").
+		Select("r.team_id, r.challenge_id, COUNT(*) AS solved").
+		Joins("JOIN dalictf_challenge_part p ON p.id = r.part_id").
+		Where("r.contest_id = ?", contestID)
+	if until != nil {
+		query = query.Where("r.solving_time < ?", *until)
+	}
+	if err := query.
+		Group("r.team_id, r.challenge_id").
+		Order("r.challenge_id").
+		Scan(&solved).Error; err != nil {
+		return nil, err
+	}
+
+	totalByChallenge := make(map[uint32]uint, len(totals))
+	for _, t := range totals {
+		totalByChallenge[t.ChallengeID] = t.Total
+	}
+	progress := make(map[uint32][]models.PartProgress)
+	for _, s := range solved {
+		total, ok := totalByChallenge[s.ChallengeID]
+		if !ok {
+			continue
+		}
+		progress[s.TeamID] = append(progress[s.TeamID], models.PartProgress{ChallengeID: s.ChallengeID, Solved: s.Solved, Total: total})
+	}
+	return progress, nil
+}
+
+// SolvedPartIDs 返回队伍已解出的部分 ID，只包含 parts 中仍存在的部分，已删除部分的解题记录不计入进度
+func SolvedPartIDs(tx *gorm.DB, challengeID, teamID uint32, parts []models.ChallengePart) ([]uint32, error) {
+	solved := []uint32{}
+	if len(parts) == 0 {
+		return solved, nil
+	}
+	err := tx.Model(&models.Submission{}).
+		Where("challenge_id = ? AND team_id = ? AND part_id IN ?", challengeID, teamID, partIDs(parts)).
+		Pluck("part_id", &solved).Error
+	return solved, err
+}
+
+func partIDs(parts []models.ChallengePart) []uint32 {
+	ids := make([]uint32, 0, len(parts))
+	for _, p := range parts {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
@@ -0,0 +1,414 @@
+// file: services/container_service.go
+package services
+
+import (
+	"ISCTF/config"
+	"ISCTF/database"
+	"ISCTF/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 实例标签，用于把编排后端中的实例与 dalictf_container 记录对应起来
+const (
+	LabelManaged     = "dalictf.managed"
+	LabelTeamID      = "dalictf.team_id"
+	LabelChallengeID = "dalictf.challenge_id"
+	LabelContainerID = "dalictf.container_id"
+	LabelService     = "dalictf.service"
+)
+
+// InstancePolicyFor 返回题目生效的容器策略：题目上设置的项覆盖全局默认值
+func InstancePolicyFor(challenge models.Challenge) config.InstancePolicy {
+	policy := config.C.Container.Defaults
+	if challenge.MemoryLimitMB != nil {
+		policy.MemoryMB = int64(*challenge.MemoryLimitMB)
+	}
+	if challenge.CPULimit != nil {
+		policy.CPUs = *challenge.CPULimit
+	}
+	if challenge.PidsLimit != nil {
+		policy.PidsLimit = int64(*challenge.PidsLimit)
+	}
+	if challenge.LifetimeMinutes != nil {
+		policy.Lifetime = time.Duration(*challenge.LifetimeMinutes) * time.Minute
+	}
+	if challenge.MaxRenewals != nil {
+		policy.MaxRenewals = *challenge.MaxRenewals
+	}
+	if challenge.RenewalMinutes != nil {
+		policy.RenewalStep = time.Duration(*challenge.RenewalMinutes) * time.Minute
+	}
+	if challenge.MaxTeamContainers != nil {
+		policy.MaxPerTeam = int(*challenge.MaxTeamContainers)
+	}
+	return policy
+}
+
+// PortSpec 是题目暴露的一个端口及其连接协议
+type PortSpec struct {
+	Port     uint32
+	Protocol string // tcp / http / https
+}
+
+// ParsePortSpecs 解析题目端口配置，形如 "80/http,3306"，未写协议的端口按 tcp 处理
+func ParsePortSpecs(s string) []PortSpec {
+	var specs []PortSpec
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		portStr, protocol, _ := strings.Cut(item, "/")
+		protocol = strings.ToLower(strings.TrimSpace(protocol))
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		port, err := strconv.ParseUint(strings.TrimSpace(portStr), 10, 16)
+		if err != nil || port == 0 || (protocol != "tcp" && protocol != "http" && protocol != "https") {
+			log.Printf("Warning: Invalid port format '%s'", item)
+			continue
+		}
+		specs = append(specs, PortSpec{Port: uint32(port), Protocol: protocol})
+	}
+	return specs
+}
+
+// DeployedService 是容器记录下已启动的一个服务实例，单镜像题目只有一个且 Service 为空
+type DeployedService struct {
+	Service  string
+	Ports    []PortSpec
+	Instance *Instance
+}
+
+// BuildEndpoints 根据实例发布的端口生成选手可直接使用的连接地址。
+// 连接主机优先使用编排后端给出的地址（如 Swarm 节点标签），否则使用配置 docker.public_host；
+// 开启 HTTP 网关或 TCP 代理时，对应端口的地址改为网关子域名或代理地址加票据。
+// 禁止出网的实例和经网关、代理转发的端口不发布，端点记录实例在内部网络中的名称，只能经网关或代理访问
+func BuildEndpoints(challenge models.Challenge, container models.Container, deployed []DeployedService) []models.ContainerEndpoint {
+	var endpoints []models.ContainerEndpoint
+	primaryHTTP, primaryTCP := true, true
+	for _, svc := range deployed {
+		host := svc.Instance.Host
+		if host == "" {
+			host = config.C.Docker.PublicHost
+		}
+		published := make(map[uint32]uint32, len(svc.Instance.Ports))
+		for _, port := range svc.Instance.Ports {
+			published[port.TargetPort] = port.PublishedPort
+		}
+
+		for _, spec := range svc.Ports {
+			ep := models.ContainerEndpoint{
+				TargetPort: spec.Port,
+				Host:       host,
+				Protocol:   spec.Protocol,
+				Service:    svc.Service,
+			}
+			if challenge.BlockEgress || forwardedPort(spec) {
+				ep.Host = svc.Instance.Name
+				ep.Internal = true
+			} else if port, ok := published[spec.Port]; ok {
+				ep.PublishedPort = port
+			} else {
+				continue
+			}
+			hostPort := net.JoinHostPort(host, strconv.Itoa(int(ep.PublishedPort)))
+			switch {
+			case ep.Protocol == "tcp" && config.C.TCPProxy.Enabled && container.ProxyTicket != "":
+				ep.Address = config.C.TCPProxy.PublicAddr
+				ep.Ticket = ProxyTicketFor(container.ProxyTicket, spec.Port, primaryTCP)
+				primaryTCP = false
+			case ep.Protocol != "tcp" && config.C.Gateway.Enabled && container.GatewayToken != "":
+				ep.Address = config.C.Gateway.Scheme + "://" + GatewayHost(container.GatewayToken, spec.Port, primaryHTTP)
+				primaryHTTP = false
+			case ep.Internal:
+				// 没有可用的转发入口，CheckNetworkRequirements 会在创建前拦截这种配置
+			case ep.Protocol == "tcp":
+				ep.Address = hostPort
+			default:
+				ep.Address = ep.Protocol + "://" + hostPort
+			}
+			endpoints = append(endpoints, ep)
+		}
+	}
+	if endpoints == nil {
+		endpoints = []models.ContainerEndpoint{}
+	}
+	return endpoints
+}
+
+// EndpointUpstream 返回网关或代理转发到端点时连接的地址：
+// 内部端点直接连接实例名和容器端口，其余端点连接 upstreamHost（为空时用端点主机）和发布端口
+func EndpointUpstream(ep models.ContainerEndpoint, upstreamHost string) string {
+	if ep.Internal {
+		return net.JoinHostPort(ep.Host, strconv.Itoa(int(ep.TargetPort)))
+	}
+	host := upstreamHost
+	if host == "" {
+		host = ep.Host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(ep.PublishedPort)))
+}
+
+// forwardedPort 表示端口经 TCP 代理或 HTTP 网关转发：实例不对外发布该端口，代理和网关经私有网络连接实例
+func forwardedPort(p PortSpec) bool {
+	if p.Protocol == "tcp" {
+		return config.C.TCPProxy.Enabled
+	}
+	return config.C.Gateway.Enabled
+}
+
+// hasForwardedPort 表示题目有服务的端口经转发访问
+func hasForwardedPort(services *ServiceSpec) bool {
+	for _, svc := range services.Services {
+		if slices.ContainsFunc(svc.PortSpecs(), forwardedPort) {
+			return true
+		}
+	}
+	return false
+}
+
+// TeamNetworkName 返回队伍专属网络的名称，禁止出网的实例使用单独的内部网络
+func TeamNetworkName(teamID uint32, internal bool) string {
+	name := fmt.Sprintf("%steam-%d", instanceNamePrefix, teamID)
+	if internal {
+		name += "-noegress"
+	}
+	return name
+}
+
+// ErrNetworkPolicyUnsupported 表示当前部署无法满足题目的网络策略
+var ErrNetworkPolicyUnsupported = errors.New("network policy unsupported")
+
+// CheckNetworkRequirements 检查题目的网络策略在当前配置下能否生效：
+// 禁止出网的实例只能经网关或代理访问，且平台自身需要接入队伍网络才能转发
+func CheckNetworkRequirements(challenge models.Challenge, services *ServiceSpec) error {
+	if !challenge.BlockEgress {
+		return nil
+	}
+	for _, svc := range services.Services {
+		for _, spec := range svc.PortSpecs() {
+			if spec.Protocol == "tcp" && !config.C.TCPProxy.Enabled {
+				return fmt.Errorf("%w: tcp port %d requires tcp_proxy.enabled", ErrNetworkPolicyUnsupported, spec.Port)
+			}
+			if spec.Protocol != "tcp" && !config.C.Gateway.Enabled {
+				return fmt.Errorf("%w: %s port %d requires gateway.enabled", ErrNetworkPolicyUnsupported, spec.Protocol, spec.Port)
+			}
+		}
+	}
+	if config.C.Docker.Backend != "fake" && config.C.Docker.AttachContainer == "" {
+		return fmt.Errorf("%w: docker.attach_container must be set", ErrNetworkPolicyUnsupported)
+	}
+	return nil
+}
+
+// BuildInstanceSpec 根据题目配置和容器记录生成一个服务的实例规格，不含 Flag（见 applyFlagInjection）。
+// 经转发的端口不对外发布
+func BuildInstanceSpec(challenge models.Challenge, team models.Team, container models.Container, svc ServiceDef) InstanceSpec {
+	var ports []uint32
+	for _, p := range svc.PortSpecs() {
+		if !forwardedPort(p) {
+			ports = append(ports, p.Port)
+		}
+	}
+	policy := InstancePolicyFor(challenge)
+
+	env := make([]string, 0, len(svc.Environment)+1)
+	for _, key := range slices.Sorted(maps.Keys(svc.Environment)) {
+		env = append(env, key+"="+svc.Environment[key])
+	}
+
+	spec := InstanceSpec{
+		// 使用时间戳确保实例名唯一，避免冲突
+		Name:  fmt.Sprintf("%s%d-%d-%d", instanceNamePrefix, team.ID, challenge.ID, time.Now().UnixNano()),
+		Image: svc.Image,
+		Env:   env,
+		Ports: ports,
+		Labels: map[string]string{
+			LabelManaged:     "true",
+			LabelTeamID:      strconv.FormatUint(uint64(team.ID), 10),
+			LabelChallengeID: strconv.FormatUint(uint64(challenge.ID), 10),
+			LabelContainerID: strconv.FormatUint(uint64(container.ID), 10),
+		},
+		MemoryBytes: policy.MemoryMB * 1024 * 1024,
+		NanoCPUs:    int64(policy.CPUs * 1e9),
+		PidsLimit:   policy.PidsLimit,
+	}
+	if svc.Name != "" {
+		spec.Name += "-" + svc.Name
+		spec.Labels[LabelService] = svc.Name
+		spec.Aliases = []string{svc.Name}
+	}
+	return spec
+}
+
+// LaunchChallengeUnit 为队伍按顺序启动题目的全部服务，container 需已落库（ID 会写入实例标签）。
+// 任一服务启动失败时销毁已启动的服务和网络，整体视为失败
+func LaunchChallengeUnit(ctx context.Context, challenge models.Challenge, services *ServiceSpec, team models.Team, container models.Container) ([]DeployedService, error) {
+	networks, err := prepareNetworks(ctx, challenge, services, team, container)
+	if err != nil {
+		return nil, fmt.Errorf("prepare network: %w", err)
+	}
+
+	deployed := make([]DeployedService, 0, len(services.Services))
+	flagIndex := flagServiceIndex(services)
+	for i, svc := range services.Services {
+		spec := BuildInstanceSpec(challenge, team, container, svc)
+		spec.Networks = networks[svc.Name]
+		// 没有需要直接发布的端口时实例只接入私有网络
+		spec.PrivateOnly = challenge.BlockEgress || len(spec.Ports) == 0
+		if i == flagIndex {
+			applyFlagInjection(challenge, &spec, container.ContainerFlag)
+		}
+		instance, err := Orch.Create(ctx, spec)
+		if err != nil {
+			DestroyDeployed(context.Background(), container.ID, deployed)
+			if !services.MultiService() {
+				return nil, err
+			}
+			removeUnitNetworks(context.Background(), container.ID)
+			return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		deployed = append(deployed, DeployedService{Service: svc.Name, Ports: svc.PortSpecs(), Instance: instance})
+	}
+
+	if err := deliverFlag(ctx, challenge, deployed[flagIndex].Instance, container.ContainerFlag); err != nil {
+		DestroyDeployed(context.Background(), container.ID, deployed)
+		return nil, err
+	}
+	return deployed, nil
+}
+
+// prepareNetworks 创建实例需要的网络，返回每个服务要接入的网络。
+// 单镜像题目开启网络隔离、禁止出网或有经转发的端口时使用队伍网络（平台容器随之接入，以便转发）；
+// 多服务题目总是使用本容器记录专属的网络，服务之间按服务名互访，不同队伍之间天然隔离
+func prepareNetworks(ctx context.Context, challenge models.Challenge, services *ServiceSpec, team models.Team, container models.Container) (map[string][]string, error) {
+	labels := map[string]string{
+		LabelManaged: "true",
+		LabelTeamID:  strconv.FormatUint(uint64(team.ID), 10),
+	}
+	result := make(map[string][]string, len(services.Services))
+
+	if !services.MultiService() {
+		if !challenge.NetworkIsolation && !challenge.BlockEgress && !hasForwardedPort(services) {
+			return result, nil
+		}
+		network := NetworkSpec{Name: TeamNetworkName(team.ID, challenge.BlockEgress), Internal: challenge.BlockEgress, Labels: labels}
+		if err := Orch.EnsureNetwork(ctx, network); err != nil {
+			return nil, err
+		}
+		result[""] = []string{network.Name}
+		return result, nil
+	}
+
+	labels[LabelContainerID] = strconv.FormatUint(uint64(container.ID), 10)
+	created := make(map[string]bool)
+	for _, svc := range services.Services {
+		names := svc.Networks
+		if len(names) == 0 {
+			names = []string{defaultUnitNetwork}
+		}
+		for _, name := range names {
+			network := NetworkSpec{
+				Name:     unitNetworkPrefix(container.ID) + name,
+				Internal: services.Networks[name].Internal || challenge.BlockEgress,
+				Labels:   labels,
+			}
+			if !created[name] {
+				if err := Orch.EnsureNetwork(ctx, network); err != nil {
+					removeUnitNetworks(context.Background(), container.ID)
+					return nil, err
+				}
+				created[name] = true
+			}
+			result[svc.Name] = append(result[svc.Name], network.Name)
+		}
+	}
+	return result, nil
+}
+
+// SaveUnitInstances 记录多服务题目各服务的实例，单镜像题目无需记录
+func SaveUnitInstances(containerID uint32, deployed []DeployedService) error {
+	if len(deployed) == 0 || deployed[0].Service == "" {
+		return nil
+	}
+	rows := make([]models.ContainerInstance, 0, len(deployed))
+	for _, d := range deployed {
+		rows = append(rows, models.ContainerInstance{
+			ContainerID:  containerID,
+			Service:      d.Service,
+			InstanceID:   d.Instance.ID,
+			InstanceName: d.Instance.Name,
+		})
+	}
+	return database.DB.Create(&rows).Error
+}
+
+// DestroyContainerUnit 销毁容器记录下的全部实例；多服务题目同时删除其专属网络
+func DestroyContainerUnit(ctx context.Context, container models.Container) error {
+	var rows []models.ContainerInstance
+	if err := database.DB.Where("container_id = ?", container.ID).Find(&rows).Error; err != nil {
+		return err
+	}
+
+	var errs []error
+	if container.DockerID != "" {
+		if err := DestroyInstance(ctx, container.DockerID); err != nil {
+			errs = append(errs, fmt.Errorf("destroy instance %s: %w", container.DockerID, err))
+		}
+	}
+	for _, row := range rows {
+		if row.InstanceID == container.DockerID {
+			continue
+		}
+		if err := DestroyInstance(ctx, row.InstanceID); err != nil {
+			errs = append(errs, fmt.Errorf("destroy service %s instance %s: %w", row.Service, row.InstanceID, err))
+		}
+	}
+	if len(rows) > 0 {
+		removeUnitNetworks(ctx, container.ID)
+	}
+	return errors.Join(errs...)
+}
+
+// DestroyDeployed 回滚刚启动、尚未写入数据库的服务实例，多服务题目同时删除其专属网络
+func DestroyDeployed(ctx context.Context, containerID uint32, deployed []DeployedService) {
+	for _, d := range deployed {
+		_ = DestroyInstance(ctx, d.Instance.ID)
+	}
+	if len(deployed) > 0 && deployed[0].Service != "" {
+		removeUnitNetworks(ctx, containerID)
+	}
+}
+
+// removeUnitNetworks 尽力删除多服务实例的专属网络，实例尚未完全退出导致的失败留给对账任务重试
+func removeUnitNetworks(ctx context.Context, containerID uint32) {
+	networks, err := Orch.ListNetworks(ctx)
+	if err != nil {
+		return
+	}
+	prefix := unitNetworkPrefix(containerID)
+	for _, name := range networks {
+		if strings.HasPrefix(name, prefix) {
+			_ = Orch.RemoveNetwork(ctx, name)
+		}
+	}
+}
+
+// DestroyInstance 销毁实例，实例已不存在时视为成功
+func DestroyInstance(ctx context.Context, id string) error {
+	err := Orch.Destroy(ctx, id)
+	if errors.Is(err, ErrInstanceNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"ISCTF/config"
+	"ISCTF/models"
+	"context"
+	"net"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParsePortSpecs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []PortSpec
+	}{
+		{"", nil},
+		{"80", []PortSpec{{80, "tcp"}}},
+		{"80/http, 3306", []PortSpec{{80, "http"}, {3306, "tcp"}}},
+		{" 443/HTTPS ,22/tcp", []PortSpec{{443, "https"}, {22, "tcp"}}},
+		{"80/http,,8080/", []PortSpec{{80, "http"}, {8080, "tcp"}}},
+		{"0,70000,abc,80/udp,9000", []PortSpec{{9000, "tcp"}}},
+	}
+	for _, tt := range tests {
+		if got := ParsePortSpecs(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePortSpecs(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLaunchChallengeUnitForwardedPorts(t *testing.T) {
+	tests := []struct {
+		name          string
+		tcpProxy      bool
+		gateway       bool
+		wantPublished []uint32 // 对外发布的容器端口
+		wantInternal  []uint32 // 经转发、只能在私有网络内访问的端口
+		wantNetwork   bool     // 实例接入队伍网络
+	}{
+		{"no forwarding", false, false, []uint32{22, 80}, nil, false},
+		{"tcp proxy", true, false, []uint32{80}, []uint32{22}, true},
+		{"gateway", false, true, []uint32{22}, []uint32{80}, true},
+		{"both", true, true, nil, []uint32{22, 80}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := setupContainerTest(t)
+			config.C = config.Default()
+			config.C.TCPProxy.Enabled = tt.tcpProxy
+			config.C.Gateway.Enabled = tt.gateway
+
+			challenge := models.Challenge{ID: 1, DockerImage: "nginx", DockerPorts: "22,80/http"}
+			unit, err := ChallengeServices(challenge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			container := insertTestContainer(t, models.Container{TeamID: 1, ChallengeID: 1, State: models.ContainerStatePending, EndTime: time.Now().Add(time.Hour), ProxyTicket: "ticket", GatewayToken: "token"})
+			deployed, err := LaunchChallengeUnit(context.Background(), challenge, unit, models.Team{ID: 1}, container)
+			if err != nil {
+				t.Fatalf("LaunchChallengeUnit: %v", err)
+			}
+
+			inst := deployed[0].Instance
+			var published []uint32
+			for _, p := range inst.Ports {
+				published = append(published, p.TargetPort)
+			}
+			if !reflect.DeepEqual(published, tt.wantPublished) {
+				t.Errorf("published ports = %v, want %v", published, tt.wantPublished)
+			}
+			networks, _ := fake.ListNetworks(context.Background())
+			if got := slices.Contains(networks, TeamNetworkName(1, false)); got != tt.wantNetwork {
+				t.Errorf("team network created = %v, want %v", got, tt.wantNetwork)
+			}
+
+			var internal []uint32
+			for _, ep := range BuildEndpoints(challenge, container, deployed) {
+				if !ep.Internal {
+					if ep.PublishedPort == 0 {
+						t.Errorf("port %d: neither published nor internal", ep.TargetPort)
+					}
+					continue
+				}
+				internal = append(internal, ep.TargetPort)
+				wantUpstream := net.JoinHostPort(inst.Name, strconv.Itoa(int(ep.TargetPort)))
+				if got := EndpointUpstream(ep, "upstream.example"); got != wantUpstream {
+					t.Errorf("port %d: upstream = %s, want %s", ep.TargetPort, got, wantUpstream)
+				}
+			}
+			if !reflect.DeepEqual(internal, tt.wantInternal) {
+				t.Errorf("internal endpoints = %v, want %v", internal, tt.wantInternal)
+			}
+		})
+	}
+}
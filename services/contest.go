@@ -0,0 +1,73 @@
+// file: services/contest.go
+package services
+
+import (
+	"ISCTF/database"
+	"ISCTF/models"
+	"errors"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// ErrContestNotFound 表示请求指定的比赛不存在
+var ErrContestNotFound = errors.New("contest not found")
+
+// CurrentContest 返回当前比赛，没有当前比赛时返回 gorm.ErrRecordNotFound
+func CurrentContest() (*models.Contest, error) {
+	var contest models.Contest
+	if err := database.DB.Where("is_current = ?", true).First(&contest).Error; err != nil {
+		return nil, err
+	}
+	return &contest, nil
+}
+
+// ResolveContest 按请求中的 contest_id 返回比赛，id 为空时返回当前比赛。
+// 未指定比赛且没有当前比赛时返回 nil, nil，表示平台未启用比赛，此时题目和排行榜都归属于比赛 0
+func ResolveContest(id string) (*models.Contest, error) {
+	if id == "" {
+		contest, err := CurrentContest()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return contest, err
+	}
+	contestID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return nil, ErrContestNotFound
+	}
+	var contest models.Contest
+	if err := database.DB.First(&contest, contestID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrContestNotFound
+		}
+		return nil, err
+	}
+	return &contest, nil
+}
+
+// SwitchCurrentContest 把 contestID 设为当前比赛，其余比赛取消当前标记
+func SwitchCurrentContest(tx *gorm.DB, contestID uint) error {
+	if err := tx.Model(&models.Contest{}).Where("is_current = ? AND id <> ?", true, contestID).Update("is_current", false).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Contest{}).Where("id = ?", contestID).Update("is_current", true).Error
+}
+
+// RegisteredTeamOf 返回用户所在的队伍及其是否报名了比赛，用户未加入队伍时 teamID 为 0
+func RegisteredTeamOf(contestID uint, userID uint32) (teamID uint32, registered bool, err error) {
+	var member models.TeamMember
+	if err := database.DB.Where("user_id = ?", userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	var count int64
+	if err := database.DB.Model(&models.ContestTeam{}).
+		Where("contest_id = ? AND team_id = ?", contestID, member.TeamID).
+		Count(&count).Error; err != nil {
+		return member.TeamID, false, err
+	}
+	return member.TeamID, count > 0, nil
+}
@@ -2,44 +2,31 @@
 package services
 
 import (
-	"ISCTF/models"
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"strconv"
-	"strings"
 	"time"
 
-	"github.com/docker/docker/api/types"
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	imagetypes "github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/registry"
-	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 )
 
-var DockerClient *client.Client
-
-// InitDocker 初始化 Docker 客户端并检查 Swarm 状态
-func InitDocker() {
-	var err error
-	DockerClient, err = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		log.Fatalf("Failed to connect to Docker daemon: %v", err)
-	}
-
-	info, err := DockerClient.Info(context.Background())
+// newDockerClient 根据环境变量（DOCKER_HOST 等）创建 Docker 客户端
+func newDockerClient() (*client.Client, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
-		log.Fatalf("Failed to get Docker info: %v", err)
+		return nil, fmt.Errorf("connect to docker daemon: %w", err)
 	}
-
-	if info.Swarm.LocalNodeState != swarm.LocalNodeStateActive {
-		log.Fatalf("Docker is not running in Swarm mode. Please run 'docker swarm init'.")
-	}
-
-	log.Println("Docker client initialized and connected to Swarm cluster.")
+	return cli, nil
 }
 
 // encodeRegistryAuth 生成私有仓库认证串
@@ -56,12 +43,12 @@ func encodeRegistryAuth(user, pass, server string) (string, error) {
 	return base64.StdEncoding.EncodeToString(b), nil
 }
 
-// ensureImage 确保镜像在 Swarm 集群中可用
-func ensureImage(ctx context.Context, ref string, registryAuth string) error {
+// ensureImage 确保镜像在当前 Docker 节点上可用
+func ensureImage(ctx context.Context, cli *client.Client, ref string, registryAuth string) error {
 	pullCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
-	rc, err := DockerClient.ImagePull(pullCtx, ref, imagetypes.PullOptions{
+	rc, err := cli.ImagePull(pullCtx, ref, imagetypes.PullOptions{
 		RegistryAuth: registryAuth,
 	})
 	if err != nil {
@@ -72,78 +59,106 @@ func ensureImage(ctx context.Context, ref string, registryAuth string) error {
 	return nil
 }
 
-// CreateService 在 Docker Swarm 中创建一个服务来替代单个容器
-func CreateService(challenge models.Challenge, team models.Team, flag string) (string, error) {
-	ctx := context.Background()
-	// 使用时间戳确保服务名唯一，避免冲突
-	serviceName := fmt.Sprintf("ctf-%d-%d-%d", team.ID, challenge.ID, time.Now().UnixNano())
-
-	// 确保镜像可用 (在生产环境中，建议提前在所有 Swarm Node 上拉取镜像)
-	// var registryAuth string
-	// if err := ensureImage(ctx, challenge.DockerImage, registryAuth); err != nil {
-	// 	return "", fmt.Errorf("ensure image failed: %v", err)
-	// }
+// ensureNetwork 创建网络（同名网络已存在时跳过），并把平台容器 attach 接入，使网关和代理能访问网络内的实例
+func ensureNetwork(ctx context.Context, cli *client.Client, driver string, spec NetworkSpec, attach string) error {
+	_, err := cli.NetworkInspect(ctx, spec.Name, network.InspectOptions{})
+	switch {
+	case err == nil:
+	case cerrdefs.IsNotFound(err):
+		_, err = cli.NetworkCreate(ctx, spec.Name, network.CreateOptions{
+			Driver:     driver,
+			Internal:   spec.Internal,
+			Attachable: driver == "overlay", // 平台容器需要手动接入 overlay 网络
+			Labels:     spec.Labels,
+		})
+		if err != nil && !cerrdefs.IsConflict(err) {
+			return fmt.Errorf("create network %s: %w", spec.Name, err)
+		}
+	default:
+		return fmt.Errorf("inspect network %s: %w", spec.Name, err)
+	}
 
-	// 1. 解析端口配置，形如 "80,3306"
-	var portConfigs []swarm.PortConfig
-	ports := strings.Split(challenge.DockerPorts, ",")
-	for _, p := range ports {
-		port, err := strconv.ParseUint(strings.TrimSpace(p), 10, 32)
-		if err != nil {
-			log.Printf("Warning: Invalid port format '%s' for challenge %d", p, challenge.ID)
-			continue
+	if attach != "" {
+		err := cli.NetworkConnect(ctx, spec.Name, attach, nil)
+		// 已接入时 Docker 返回 Forbidden 或 Conflict
+		if err != nil && !cerrdefs.IsConflict(err) && !cerrdefs.IsPermissionDenied(err) {
+			return fmt.Errorf("attach %s to network %s: %w", attach, spec.Name, err)
 		}
-		portConfigs = append(portConfigs, swarm.PortConfig{
-			Protocol:    swarm.PortConfigProtocolTCP,
-			TargetPort:  uint32(port),
-			PublishMode: swarm.PortConfigPublishModeIngress, // 使用随机端口模式
-		})
 	}
+	return nil
+}
 
-	// 2. 定义服务规格 (ServiceSpec)
-	serviceSpec := swarm.ServiceSpec{
-		Annotations: swarm.Annotations{
-			Name: serviceName,
-		},
-		TaskTemplate: swarm.TaskSpec{
-			ContainerSpec: &swarm.ContainerSpec{
-				Image: challenge.DockerImage,
-				Env:   []string{"DALICTF_FLAG=" + flag},
-			},
-			Resources: &swarm.ResourceRequirements{
-				Limits: &swarm.Limit{
-					MemoryBytes: 256 * 1024 * 1024, // 限制内存 256MB
-					NanoCPUs:    500000000,         // 限制 CPU 0.5 Core
-				},
-			},
-		},
-		EndpointSpec: &swarm.EndpointSpec{
-			Ports: portConfigs,
-		},
+// removeNetwork 先断开平台容器再删除网络，网络不存在时返回 nil
+func removeNetwork(ctx context.Context, cli *client.Client, name, attach string) error {
+	if attach != "" {
+		_ = cli.NetworkDisconnect(ctx, name, attach, true)
 	}
+	err := cli.NetworkRemove(ctx, name)
+	if cerrdefs.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
 
-	// 3. 创建服务
-	createOpts := types.ServiceCreateOptions{}
-	serviceResp, err := DockerClient.ServiceCreate(ctx, serviceSpec, createOpts)
+// listNetworks 列出平台创建的网络名称
+func listNetworks(ctx context.Context, cli *client.Client) ([]string, error) {
+	networks, err := cli.NetworkList(ctx, network.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", LabelManaged+"=true")),
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	return serviceResp.ID, nil
+	names := make([]string, 0, len(networks))
+	for _, n := range networks {
+		names = append(names, n.Name)
+	}
+	return names, nil
 }
 
-// DestroyService 销毁一个服务
-func DestroyService(serviceID string) error {
-	return DockerClient.ServiceRemove(context.Background(), serviceID)
+// execInContainer 在容器内执行命令并等待结束，返回退出码和标准输出
+func execInContainer(ctx context.Context, cli *client.Client, containerID string, cmd []string, env []string) (*ExecResult, error) {
+	created, err := cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		Env:          env,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, ErrInstanceNotFound
+		}
+		return nil, fmt.Errorf("create exec: %w", err)
+	}
+	attach, err := cli.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("attach exec: %w", err)
+	}
+	defer attach.Close()
+
+	var stdout bytes.Buffer
+	if _, err := stdcopy.StdCopy(&limitedWriter{w: &stdout, n: maxExecOutput}, io.Discard, attach.Reader); err != nil {
+		return nil, fmt.Errorf("read exec output: %w", err)
+	}
+	inspect, err := cli.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return nil, fmt.Errorf("inspect exec: %w", err)
+	}
+	return &ExecResult{ExitCode: inspect.ExitCode, Output: stdout.String()}, nil
 }
 
-// GetServiceInfo 获取服务信息
-func GetServiceInfo(serviceID string) (swarm.Service, []byte, error) {
-	return DockerClient.ServiceInspectWithRaw(context.Background(), serviceID, types.ServiceInspectOptions{})
+// limitedWriter 只保留前 n 个字节，其余数据丢弃但不报错，避免阻塞命令输出
+type limitedWriter struct {
+	w io.Writer
+	n int
 }
 
-// IsServiceRunning 检查服务是否仍在运行
-func IsServiceRunning(serviceID string) bool {
-	_, _, err := GetServiceInfo(serviceID)
-	return err == nil
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if l.n > 0 {
+		keep := min(len(p), l.n)
+		if _, err := l.w.Write(p[:keep]); err != nil {
+			return 0, err
+		}
+		l.n -= keep
+	}
+	return len(p), nil
 }
@@ -0,0 +1,190 @@
+// file: services/event_watcher.go
+package services
+
+import (
+	"ISCTF/database"
+	"ISCTF/models"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	eventWatcherLockKey = "lock:event_watcher"
+	// eventWatcherLockTTL 内未续期的锁自动过期，持锁副本崩溃后由其他副本接手
+	eventWatcherLockTTL = 30 * time.Second
+	eventWatcherMaxWait = 30 * time.Second
+)
+
+// StartEventWatcher 启动后台任务，订阅编排后端的实例事件并同步到 dalictf_container。
+// 多副本部署时只有持有锁的副本订阅，事件流中断后按指数退避重连；
+// 断线期间错过的变化由对账任务兜底。
+func StartEventWatcher(ctx context.Context) {
+	go func() {
+		for {
+			if lock, ok := tryLock(ctx, eventWatcherLockKey, eventWatcherLockTTL); ok {
+				watchWithLock(ctx, lock)
+				lock.Release()
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(eventWatcherLockTTL / 3):
+			}
+		}
+	}()
+	log.Println("Container event watcher started.")
+}
+
+// watchWithLock 在持有锁期间订阅事件，锁丢失或 ctx 取消时返回
+func watchWithLock(ctx context.Context, lock *distLock) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 定期续期，续期失败说明锁已被其他副本获取
+	go func() {
+		ticker := time.NewTicker(eventWatcherLockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !lock.Refresh(eventWatcherLockTTL) {
+					log.Println("Event watcher: lost lock, stopping.")
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	events := make(chan InstanceEvent, 64)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev := <-events:
+				handleInstanceEvent(ev)
+			}
+		}
+	}()
+
+	wait := time.Second
+	for {
+		started := time.Now()
+		err := Orch.Watch(ctx, events)
+		if ctx.Err() != nil {
+			return
+		}
+		// 事件流稳定运行过一段时间后断开，重新从最短等待开始
+		if time.Since(started) > eventWatcherMaxWait {
+			wait = time.Second
+		}
+		log.Printf("Event watcher: stream interrupted (%v), reconnecting in %s.", err, wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, eventWatcherMaxWait)
+	}
+}
+
+// handleInstanceEvent 把一条实例事件写入对应的容器记录。
+// 所有更新都带状态条件，重复或乱序的事件不会覆盖更新的状态。
+func handleInstanceEvent(ev InstanceEvent) {
+	if ev.InstanceID == "" {
+		return
+	}
+	container, service, ok := findEventContainer(ev.InstanceID)
+	if !ok {
+		return // 非平台记录的实例，或记录尚未写回实例 ID
+	}
+
+	at := ev.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	updates := map[string]interface{}{
+		"last_event":    string(ev.Kind),
+		"last_event_at": at,
+	}
+	scope := database.DB.Model(&models.Container{}).Where("id = ?", container.ID)
+
+	var result *gorm.DB
+	var notice *TeamNotice
+	switch ev.Kind {
+	case InstanceStarted:
+		// 只有退出过的实例再次启动才算一次重启，首次启动无需记录
+		updates["state"] = models.ContainerStateRunning
+		updates["restart_count"] = gorm.Expr("restart_count + 1")
+		result = scope.Where("state = ?", models.ContainerStateStopped).Updates(updates)
+		notice = &TeamNotice{Kind: "container_restarted", Message: "Container crashed and has been restarted"}
+
+	case InstanceOOM:
+		updates["failure_reason"] = "out of memory"
+		result = scope.Where("state = ?", models.ContainerStateRunning).Updates(updates)
+
+	case InstanceDied:
+		reason := ev.Reason
+		if reason == "" && container.LastEvent == string(InstanceOOM) {
+			reason = "out of memory"
+		}
+		if reason == "" && ev.ExitCode != nil {
+			reason = fmt.Sprintf("exited with code %d", *ev.ExitCode)
+		}
+		if service != "" {
+			reason = "service " + service + ": " + reason
+		}
+		updates["state"] = models.ContainerStateStopped
+		updates["last_exit_code"] = ev.ExitCode
+		updates["failure_reason"] = reason
+		result = scope.Where("state = ?", models.ContainerStateRunning).Updates(updates)
+		notice = &TeamNotice{Kind: "container_stopped", Message: "Container stopped unexpectedly: " + reason}
+
+	case InstanceRemoved:
+		// 平台主动销毁时记录已先置为 destroyed，这里只处理在平台之外被删除的实例
+		updates["state"] = models.ContainerStateDestroyed
+		result = scope.Where("state IN ?", []models.ContainerState{models.ContainerStateRunning, models.ContainerStateStopped}).Updates(updates)
+		notice = &TeamNotice{Kind: "container_removed", Message: "Container was removed outside the platform"}
+
+	default:
+		return
+	}
+
+	if result.Error != nil {
+		log.Printf("Event watcher: container %d: %v", container.ID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	log.Printf("Event watcher: container %d (team %d, challenge %d) %s.", container.ID, container.TeamID, container.ChallengeID, ev.Kind)
+	if notice != nil {
+		notice.ContainerID = container.ID
+		_ = PushTeamNotice(container.TeamID, *notice)
+	}
+}
+
+// findEventContainer 找到实例所属的容器记录；多服务题目的非主服务实例经 dalictf_container_instance 关联
+func findEventContainer(instanceID string) (models.Container, string, bool) {
+	var container models.Container
+	if err := database.DB.Where("docker_id = ?", instanceID).First(&container).Error; err == nil {
+		var row models.ContainerInstance
+		database.DB.Where("instance_id = ?", instanceID).Limit(1).Find(&row)
+		return container, row.Service, true
+	}
+	var row models.ContainerInstance
+	if err := database.DB.Where("instance_id = ?", instanceID).First(&row).Error; err != nil {
+		return container, "", false
+	}
+	if err := database.DB.First(&container, row.ContainerID).Error; err != nil {
+		return container, "", false
+	}
+	return container, row.Service, true
+}
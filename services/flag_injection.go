@@ -0,0 +1,112 @@
+// file: services/flag_injection.go
+package services
+
+import (
+	"ISCTF/config"
+	"ISCTF/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrFlagNotReady 表示就绪检查超时仍未在实例内读到 Flag
+var ErrFlagNotReady = errors.New("flag not ready")
+
+// flagReadyPollInterval 是就绪检查的轮询间隔
+const flagReadyPollInterval = time.Second
+
+// flagServiceIndex 返回接收 Flag 的服务：多服务定义中标注 flag: true 的服务，未标注时为第一个服务
+func flagServiceIndex(services *ServiceSpec) int {
+	for i, svc := range services.Services {
+		if svc.Flag {
+			return i
+		}
+	}
+	return 0
+}
+
+// flagEnvName 返回 env 方式使用的变量名
+func flagEnvName(challenge models.Challenge) string {
+	if challenge.FlagEnvName != "" {
+		return challenge.FlagEnvName
+	}
+	return models.DefaultFlagEnvName
+}
+
+// applyFlagInjection 按题目设置把 Flag 写入实例规格；exec 方式在实例启动后由 deliverFlag 处理
+func applyFlagInjection(challenge models.Challenge, spec *InstanceSpec, flag string) {
+	switch challenge.FlagInjection {
+	case models.FlagInjectionFile:
+		spec.Files = append(spec.Files, InstanceFile{Path: challenge.FlagPath, Content: []byte(flag + "\n")})
+	case models.FlagInjectionExec:
+	default:
+		spec.Env = append(spec.Env, flagEnvName(challenge)+"="+flag)
+	}
+}
+
+// deliverFlag 在实例启动后完成 exec 方式的注入，并在题目开启就绪检查时确认 Flag 已写入实例。
+// 实例刚启动时可能还无法 exec（如 Swarm 任务尚未运行），因此命令和检查都会在超时前重试，exec 命令需可重复执行
+func deliverFlag(ctx context.Context, challenge models.Challenge, instance *Instance, flag string) error {
+	if challenge.FlagInjection != models.FlagInjectionExec && !challenge.FlagReadyCheck {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, config.C.Container.FlagReadyTimeout)
+	defer cancel()
+
+	injected := challenge.FlagInjection != models.FlagInjectionExec
+	var lastErr error
+	for {
+		if !injected {
+			lastErr = runFlagCommand(ctx, challenge, instance.ID, flag)
+			injected = lastErr == nil
+		}
+		if injected {
+			if !challenge.FlagReadyCheck {
+				return nil
+			}
+			if lastErr = checkFlagReady(ctx, challenge, instance.ID, flag); lastErr == nil {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w within %s: %v", ErrFlagNotReady, config.C.Container.FlagReadyTimeout, lastErr)
+		case <-time.After(flagReadyPollInterval):
+		}
+	}
+}
+
+func runFlagCommand(ctx context.Context, challenge models.Challenge, instanceID, flag string) error {
+	result, err := Orch.Exec(ctx, instanceID, []string{"sh", "-c", challenge.FlagCommand}, []string{models.DefaultFlagEnvName + "=" + flag})
+	if err != nil {
+		return fmt.Errorf("exec flag command: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("flag command exited with code %d", result.ExitCode)
+	}
+	return nil
+}
+
+// checkFlagReady 在实例内读取 Flag：env 方式读取环境变量，其余方式读取 FlagPath。
+// exec 方式没有设置 FlagPath 时以命令成功退出为准
+func checkFlagReady(ctx context.Context, challenge models.Challenge, instanceID, flag string) error {
+	var cmd []string
+	switch {
+	case challenge.FlagInjection == models.FlagInjectionEnv || challenge.FlagInjection == "":
+		cmd = []string{"printenv", flagEnvName(challenge)}
+	case challenge.FlagPath != "":
+		cmd = []string{"cat", challenge.FlagPath}
+	default:
+		return nil
+	}
+	result, err := Orch.Exec(ctx, instanceID, cmd, nil)
+	if err != nil {
+		return fmt.Errorf("exec %s: %w", cmd[0], err)
+	}
+	if result.ExitCode != 0 || strings.TrimSpace(result.Output) != flag {
+		return errors.New("flag not found in instance")
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// file: services/flag_matcher.go
+package services
+
+import (
+	"ISCTF/database"
+	"ISCTF/models"
+	"ISCTF/utils"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// regexCache 缓存已编译的规则正则，键为原始表达式
+var regexCache sync.Map
+
+// ValidateFlagRule 检查规则类型和内容，正则规则需能编译
+func ValidateFlagRule(kind models.FlagRuleKind, pattern string) error {
+	if pattern == "" {
+		return errors.New("flag rule pattern is required")
+	}
+	if len(pattern) > 255 {
+		return errors.New("flag rule pattern is too long")
+	}
+	switch kind {
+	case models.FlagRuleExact, models.FlagRuleCaseInsensitive, models.FlagRuleTrimmed:
+		return nil
+	case models.FlagRuleRegex:
+		if _, err := compileFlagRegex(pattern); err != nil {
+			return fmt.Errorf("invalid flag regex: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid flag rule kind %q (exact/case_insensitive/regex/trimmed)", kind)
+	}
+}
+
+// LoadFlagRules 按匹配顺序读取题目的 Flag 规则并解密规则内容
+func LoadFlagRules(challengeID uint32) ([]models.FlagRule, error) {
+	var rules []models.FlagRule
+	if err := database.DB.Where("challenge_id = ?", challengeID).Order("sort_order ASC, id ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		pattern, err := utils.DecryptFlag(rules[i].Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("flag rule %d: %w", rules[i].ID, err)
+		}
+		rules[i].Pattern = pattern
+	}
+	return rules, nil
+}
+
+// MatchStaticFlag 先比对 StaticFlag，再依次匹配 Flag 规则；命中规则时返回该规则，命中 StaticFlag 时规则为 nil
+func MatchStaticFlag(challenge models.Challenge, flag string) (bool, *models.FlagRule, error) {
+	staticFlag, err := utils.DecryptFlag(challenge.StaticFlag)
+	if err != nil {
+		return false, nil, err
+	}
+	if staticFlag != "" && subtle.ConstantTimeCompare([]byte(staticFlag), []byte(flag)) == 1 {
+		return true, nil, nil
+	}
+	rules, err := LoadFlagRules(challenge.ID)
+	if err != nil {
+		return false, nil, err
+	}
+	if rule := MatchFlagRules(rules, flag); rule != nil {
+		return true, rule, nil
+	}
+	return false, nil, nil
+}
+
+// MatchFlagRules 按顺序匹配规则，返回第一条命中的规则，均不命中时返回 nil
+func MatchFlagRules(rules []models.FlagRule, flag string) *models.FlagRule {
+	for i := range rules {
+		if matchFlagRule(rules[i], flag) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+func matchFlagRule(rule models.FlagRule, flag string) bool {
+	switch rule.Kind {
+	case models.FlagRuleExact:
+		return flag == rule.Pattern
+	case models.FlagRuleCaseInsensitive:
+		return strings.EqualFold(flag, rule.Pattern)
+	case models.FlagRuleTrimmed:
+		return strings.TrimSpace(flag) == strings.TrimSpace(rule.Pattern)
+	case models.FlagRuleRegex:
+		re, err := compileFlagRegex(rule.Pattern)
+		return err == nil && re.MatchString(flag)
+	}
+	return false
+}
+
+// compileFlagRegex 编译整串匹配的正则；RE2 的匹配时间与输入长度线性相关，不会被恶意提交拖慢
+func compileFlagRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"ISCTF/models"
+	"testing"
+)
+
+func TestMatchFlagRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    models.FlagRuleKind
+		pattern string
+		flag    string
+		want    bool
+	}{
+		{"exact match", models.FlagRuleExact, "flag{abc}", "flag{abc}", true},
+		{"exact is case sensitive", models.FlagRuleExact, "flag{abc}", "FLAG{abc}", false},
+		{"exact keeps whitespace", models.FlagRuleExact, "flag{abc}", "flag{abc} ", false},
+		{"case insensitive", models.FlagRuleCaseInsensitive, "flag{AbC}", "FLAG{abc}", true},
+		{"case insensitive mismatch", models.FlagRuleCaseInsensitive, "flag{abc}", "flag{abd}", false},
+		{"trimmed", models.FlagRuleTrimmed, "flag{abc}", "  flag{abc}\n", true},
+		{"trimmed keeps inner whitespace", models.FlagRuleTrimmed, "flag{a b}", "flag{ab}", false},
+		{"regex whole string", models.FlagRuleRegex, `flag\{[0-9a-f]{4}\}`, "flag{beef}", true},
+		{"regex anchored at start", models.FlagRuleRegex, `flag\{[0-9a-f]{4}\}`, "xflag{beef}", false},
+		{"regex anchored at end", models.FlagRuleRegex, `flag\{[0-9a-f]{4}\}`, "flag{beef}x", false},
+		{"regex alternation anchored", models.FlagRuleRegex, `a|b`, "ab", false},
+		{"invalid regex never matches", models.FlagRuleRegex, `flag{(`, "flag{(", false},
+		{"unknown kind never matches", "glob", "flag{abc}", "flag{abc}", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := models.FlagRule{Kind: tt.kind, Pattern: tt.pattern}
+			if got := matchFlagRule(rule, tt.flag); got != tt.want {
+				t.Errorf("matchFlagRule(%s %q, %q) = %v, want %v", tt.kind, tt.pattern, tt.flag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchFlagRulesReturnsFirstMatch(t *testing.T) {
+	rules := []models.FlagRule{
+		{ID: 1, Kind: models.FlagRuleExact, Pattern: "flag{other}"},
+		{ID: 2, Kind: models.FlagRuleCaseInsensitive, Pattern: "flag{abc}"},
+		{ID: 3, Kind: models.FlagRuleRegex, Pattern: `flag\{.*\}`},
+	}
+	if rule := MatchFlagRules(rules, "FLAG{abc}"); rule == nil || rule.ID != 2 {
+		t.Fatalf("MatchFlagRules = %+v, want rule 2", rule)
+	}
+	if rule := MatchFlagRules(rules, "flag{zzz}"); rule == nil || rule.ID != 3 {
+		t.Fatalf("MatchFlagRules = %+v, want rule 3", rule)
+	}
+	if rule := MatchFlagRules(rules, "nope"); rule != nil {
+		t.Fatalf("MatchFlagRules = %+v, want nil", rule)
+	}
+}
+
+func TestValidateFlagRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    models.FlagRuleKind
+		pattern string
+		wantErr bool
+	}{
+		{"exact", models.FlagRuleExact, "flag{a}", false},
+		{"valid regex", models.FlagRuleRegex, `flag\{\w+\}`, false},
+		{"invalid regex", models.FlagRuleRegex, `flag{(`, true},
+		{"empty pattern", models.FlagRuleTrimmed, "", true},
+		{"unknown kind", "glob", "flag{*}", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateFlagRule(tt.kind, tt.pattern); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFlagRule error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
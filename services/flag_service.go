@@ -0,0 +1,147 @@
+// file: services/flag_service.go
+package services
+
+import (
+	"ISCTF/config"
+	"ISCTF/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// teamHMACLength 是 {team_hmac} 展开后的长度：8 位加密后的队伍 ID 加 24 位校验码
+const teamHMACLength = 32
+
+// FlagTemplateFor 返回题目生效的 Flag 模板
+func FlagTemplateFor(challenge models.Challenge) string {
+	if challenge.FlagTemplate != "" {
+		return challenge.FlagTemplate
+	}
+	return config.C.Flag.DefaultTemplate
+}
+
+// ValidateFlagTemplate 检查模板能为每支队伍生成不同的 Flag
+func ValidateFlagTemplate(template string) error {
+	if len(template) > 200 {
+		return errors.New("flag template is too long")
+	}
+	if !strings.Contains(template, "{team_hmac}") && !strings.Contains(template, "{random}") {
+		return errors.New("flag template must contain {team_hmac} or {random}")
+	}
+	return nil
+}
+
+// ValidateTeamFlagTemplate 检查每队 Flag 题目的模板：Flag 提交时重新计算比对，不能含随机部分
+func ValidateTeamFlagTemplate(template string) error {
+	if err := ValidateFlagTemplate(template); err != nil {
+		return err
+	}
+	if !strings.Contains(template, "{team_hmac}") || strings.Contains(template, "{random}") {
+		return errors.New("per-team flag template must contain {team_hmac} and must not contain {random}")
+	}
+	return nil
+}
+
+// GenerateTeamFlag 按题目模板为队伍生成 Flag。
+// {team_hmac} 由队伍、题目和密钥计算得出，同一队伍同一题目始终相同，且可通过 TraceFlag 还原出队伍；
+// {random} 为 32 位随机十六进制，两者都足以避免不同队伍之间的碰撞
+func GenerateTeamFlag(challenge models.Challenge, teamID uint32) string {
+	replacer := strings.NewReplacer(
+		"{prefix}", config.C.Flag.Prefix,
+		"{team_hmac}", teamWatermark(challenge.ID, teamID),
+		"{random}", randomHex(16),
+		"{team_id}", strconv.FormatUint(uint64(teamID), 10),
+		"{challenge_id}", strconv.FormatUint(uint64(challenge.ID), 10),
+	)
+	return replacer.Replace(FlagTemplateFor(challenge))
+}
+
+// VerifyTeamFlag 重新计算队伍的 Flag 并与提交的 Flag 比对，用于每队 Flag 题目
+func VerifyTeamFlag(challenge models.Challenge, teamID uint32, flag string) bool {
+	return hmac.Equal([]byte(GenerateTeamFlag(challenge, teamID)), []byte(flag))
+}
+
+// TeamFlagAttachment 生成队伍的个人化附件内容，模板中的 {flag} 替换为该队伍的 Flag，模板为空时附件只包含 Flag
+func TeamFlagAttachment(challenge models.Challenge, teamID uint32) []byte {
+	flag := GenerateTeamFlag(challenge, teamID)
+	if challenge.TeamFlagContent == "" {
+		return []byte(flag + "\n")
+	}
+	return []byte(strings.ReplaceAll(challenge.TeamFlagContent, "{flag}", flag))
+}
+
+// TraceFlag 从 Flag 中找出 {team_hmac} 水印并还原签发给的队伍，无需查询数据库。
+// 模板或前缀修改过也不影响追溯，只要密钥未变
+func TraceFlag(challengeID uint32, flag string) (uint32, bool) {
+	if len(flag) > 255 {
+		return 0, false
+	}
+	for i := 0; i+teamHMACLength <= len(flag); i++ {
+		if teamID, ok := parseWatermark(challengeID, flag[i:i+teamHMACLength]); ok {
+			return teamID, true
+		}
+	}
+	return 0, false
+}
+
+// teamWatermark 由加密后的队伍 ID 和对 (题目, 队伍) 的 HMAC 组成，不同队伍的水印之间看不出规律
+func teamWatermark(challengeID, teamID uint32) string {
+	var id [4]byte
+	binary.BigEndian.PutUint32(id[:], permuteTeamID(challengeID, teamID, false))
+	return hex.EncodeToString(id[:]) + hex.EncodeToString(flagMAC("team", challengeID, teamID)[:12])
+}
+
+func parseWatermark(challengeID uint32, s string) (uint32, bool) {
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != teamHMACLength/2 {
+		return 0, false
+	}
+	teamID := permuteTeamID(challengeID, binary.BigEndian.Uint32(raw[:4]), true)
+	if !hmac.Equal(raw[4:], flagMAC("team", challengeID, teamID)[:12]) {
+		return 0, false
+	}
+	return teamID, true
+}
+
+// permuteTeamID 用以 HMAC 为轮函数的 4 轮 Feistel 网络对 32 位队伍 ID 做可逆置换
+func permuteTeamID(challengeID, v uint32, inverse bool) uint32 {
+	const rounds = 4
+	l, r := uint16(v>>16), uint16(v)
+	for i := 0; i < rounds; i++ {
+		round := uint32(i)
+		if inverse {
+			round = rounds - 1 - round
+			l, r = r^feistelRound(challengeID, round, l), l
+		} else {
+			l, r = r, l^feistelRound(challengeID, round, r)
+		}
+	}
+	return uint32(l)<<16 | uint32(r)
+}
+
+func feistelRound(challengeID, round uint32, half uint16) uint16 {
+	sum := flagMAC("round"+strconv.Itoa(int(round)), challengeID, uint32(half))
+	return binary.BigEndian.Uint16(sum[:2])
+}
+
+func flagMAC(purpose string, challengeID, teamID uint32) []byte {
+	mac := hmac.New(sha256.New, flagSecret())
+	mac.Write([]byte(purpose + ":" + strconv.FormatUint(uint64(challengeID), 10) + ":" + strconv.FormatUint(uint64(teamID), 10)))
+	return mac.Sum(nil)
+}
+
+// flagSecret 返回水印密钥，flag.secret 由 Config.Validate 保证已配置
+func flagSecret() []byte {
+	return []byte(config.C.Flag.Secret)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,178 @@
+// file: services/gateway.go
+package services
+
+import (
+	"ISCTF/config"
+	"ISCTF/database"
+	"ISCTF/models"
+	"ISCTF/utils"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GatewayAuthPath 是实例子域名上兑换访问凭证的路径，平台签发的访问链接指向这里
+const GatewayAuthPath = "/__dalictf/auth"
+
+// gatewayTicketTTL 是访问链接的有效期，链接只用于跳转后换取 Cookie
+const gatewayTicketTTL = time.Minute
+
+// gatewayCacheTTL 是子域名解析结果的缓存时间，容器销毁后最多在该时间内仍可访问
+const gatewayCacheTTL = 5 * time.Second
+
+// ErrGatewayTargetNotFound 表示子域名没有对应的运行中容器
+var ErrGatewayTargetNotFound = errors.New("gateway target not found")
+
+// GatewayTarget 是网关子域名解析出的转发目标
+type GatewayTarget struct {
+	ContainerID uint32
+	TeamID      uint32
+	Upstream    *url.URL
+}
+
+type gatewayCacheEntry struct {
+	target    *GatewayTarget // nil 表示未找到，同样缓存以挡住对随机子域名的扫描
+	expiresAt time.Time
+}
+
+var (
+	gatewayCache  sync.Map // label -> gatewayCacheEntry
+	gatewayStores atomic.Int64
+)
+
+// GatewayHost 返回容器某个 HTTP 端口的网关域名：第一个 HTTP 端口为 <token>.<domain>，其余为 <token>-<port>.<domain>
+func GatewayHost(token string, port uint32, primary bool) string {
+	label := token
+	if !primary {
+		label = token + "-" + strconv.Itoa(int(port))
+	}
+	return label + "." + config.C.Gateway.Domain
+}
+
+// GatewayAccessURL 返回容器主 HTTP 端口的网关访问地址；开启队伍 Cookie 时返回带一次性凭证的兑换链接
+func GatewayAccessURL(container models.Container) (string, error) {
+	if !config.C.Gateway.Enabled || container.GatewayToken == "" {
+		return "", ErrGatewayTargetNotFound
+	}
+	base := config.C.Gateway.Scheme + "://" + GatewayHost(container.GatewayToken, 0, true)
+	if !config.C.Gateway.TeamCookie {
+		return base + "/", nil
+	}
+	ticket, err := utils.GenerateGatewayTicket(container.ID, container.TeamID, gatewayTicketTTL)
+	if err != nil {
+		return "", err
+	}
+	return base + GatewayAuthPath + "?ticket=" + url.QueryEscape(ticket), nil
+}
+
+// ResolveGatewayTarget 把子域名标签解析为运行中容器的转发地址
+func ResolveGatewayTarget(label string) (*GatewayTarget, error) {
+	if !isGatewayLabel(label) {
+		return nil, ErrGatewayTargetNotFound
+	}
+	if v, ok := gatewayCache.Load(label); ok {
+		entry := v.(gatewayCacheEntry)
+		if time.Now().Before(entry.expiresAt) {
+			if entry.target == nil {
+				return nil, ErrGatewayTargetNotFound
+			}
+			return entry.target, nil
+		}
+	}
+
+	target, err := lookupGatewayTarget(label)
+	if err != nil && !errors.Is(err, ErrGatewayTargetNotFound) {
+		return nil, err // 数据库错误不缓存
+	}
+	gatewayCache.Store(label, gatewayCacheEntry{target: target, expiresAt: time.Now().Add(gatewayCacheTTL)})
+	if gatewayStores.Add(1)%1024 == 0 {
+		pruneGatewayCache()
+	}
+	return target, err
+}
+
+// ForgetGatewayToken 立即清除容器的解析缓存，销毁后不再等待缓存过期
+func ForgetGatewayToken(token string) {
+	if token == "" {
+		return
+	}
+	gatewayCache.Range(func(key, _ any) bool {
+		if label := key.(string); label == token || strings.HasPrefix(label, token+"-") {
+			gatewayCache.Delete(key)
+		}
+		return true
+	})
+}
+
+func pruneGatewayCache() {
+	now := time.Now()
+	gatewayCache.Range(func(key, value any) bool {
+		if now.After(value.(gatewayCacheEntry).expiresAt) {
+			gatewayCache.Delete(key)
+		}
+		return true
+	})
+}
+
+// isGatewayLabel 检查标签格式为 32 位十六进制标识加可选的 -<port>，不合法的标签不查库也不缓存
+func isGatewayLabel(label string) bool {
+	token, port, hasPort := strings.Cut(label, "-")
+	if len(token) != 32 {
+		return false
+	}
+	if _, err := hex.DecodeString(token); err != nil {
+		return false
+	}
+	if hasPort {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func lookupGatewayTarget(label string) (*GatewayTarget, error) {
+	token, portStr, hasPort := strings.Cut(label, "-")
+
+	var container models.Container
+	err := database.DB.
+		Where("gateway_token = ? AND state = ?", token, models.ContainerStateRunning).
+		First(&container).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGatewayTargetNotFound
+		}
+		return nil, err
+	}
+
+	// 找到要转发的端点：无端口后缀时取第一个 HTTP 端点
+	var endpoint *models.ContainerEndpoint
+	for i, ep := range container.Endpoints {
+		if ep.Protocol != "http" && ep.Protocol != "https" {
+			continue
+		}
+		if !hasPort || strconv.Itoa(int(ep.TargetPort)) == portStr {
+			endpoint = &container.Endpoints[i]
+			break
+		}
+	}
+	if endpoint == nil {
+		return nil, ErrGatewayTargetNotFound
+	}
+
+	return &GatewayTarget{
+		ContainerID: container.ID,
+		TeamID:      container.TeamID,
+		Upstream: &url.URL{
+			Scheme: endpoint.Protocol,
+			Host:   EndpointUpstream(*endpoint, config.C.Gateway.UpstreamHost),
+		},
+	}, nil
+}
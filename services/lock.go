@@ -0,0 +1,52 @@
+// file: services/lock.go
+package services
+
+import (
+	"ISCTF/database"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// releaseLockScript 只删除自己持有的锁，避免误删其他副本在锁过期后重新获取的锁
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// refreshLockScript 只为自己持有的锁续期
+var refreshLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// distLock 是基于 Redis 的分布式锁，多个 API 副本同时运行后台任务时保证同一时间只有一个在执行
+type distLock struct {
+	key   string
+	token string
+}
+
+// tryLock 尝试获取锁，锁在 ttl 后自动过期
+func tryLock(ctx context.Context, key string, ttl time.Duration) (*distLock, bool) {
+	token := uuid.NewString()
+	ok, err := database.RDB.SetNX(ctx, key, token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false
+	}
+	return &distLock{key: key, token: token}, true
+}
+
+// Refresh 为长时间运行的任务续期，返回 false 表示锁已丢失
+func (l *distLock) Refresh(ttl time.Duration) bool {
+	n, err := refreshLockScript.Run(context.Background(), database.RDB, []string{l.key}, l.token, ttl.Milliseconds()).Int()
+	return err == nil && n == 1
+}
+
+// Release 释放锁
+func (l *distLock) Release() {
+	releaseLockScript.Run(context.Background(), database.RDB, []string{l.key}, l.token)
+}
@@ -0,0 +1,64 @@
+// file: services/notice_service.go
+package services
+
+import (
+	"ISCTF/database"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TeamNotice 是推送给队伍的站内提醒（如容器即将到期）
+type TeamNotice struct {
+	Kind        string    `json:"kind"`
+	Message     string    `json:"message"`
+	ContainerID uint32    `json:"container_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const (
+	teamNoticeLimit = 50
+	teamNoticeTTL   = 24 * time.Hour
+)
+
+func teamNoticeKey(teamID uint32) string {
+	return fmt.Sprintf("team_notice:%d", teamID)
+}
+
+// PushTeamNotice 向队伍推送一条提醒，每个队伍最多保留最近 50 条
+func PushTeamNotice(teamID uint32, notice TeamNotice) error {
+	if notice.CreatedAt.IsZero() {
+		notice.CreatedAt = time.Now()
+	}
+	data, err := json.Marshal(notice)
+	if err != nil {
+		return err
+	}
+	key := teamNoticeKey(teamID)
+	pipe := database.RDB.TxPipeline()
+	pipe.LPush(database.Ctx, key, data)
+	pipe.LTrim(database.Ctx, key, 0, teamNoticeLimit-1)
+	pipe.Expire(database.Ctx, key, teamNoticeTTL)
+	_, err = pipe.Exec(database.Ctx)
+	return err
+}
+
+// PopTeamNotices 取出并清空队伍的全部提醒，按时间倒序返回
+func PopTeamNotices(teamID uint32) ([]TeamNotice, error) {
+	key := teamNoticeKey(teamID)
+	pipe := database.RDB.TxPipeline()
+	rangeCmd := pipe.LRange(database.Ctx, key, 0, -1)
+	pipe.Del(database.Ctx, key)
+	if _, err := pipe.Exec(database.Ctx); err != nil {
+		return nil, err
+	}
+
+	notices := make([]TeamNotice, 0, len(rangeCmd.Val()))
+	for _, raw := range rangeCmd.Val() {
+		var n TeamNotice
+		if json.Unmarshal([]byte(raw), &n) == nil {
+			notices = append(notices, n)
+		}
+	}
+	return notices, nil
+}
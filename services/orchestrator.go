@@ -0,0 +1,142 @@
+// file: services/orchestrator.go
+package services
+
+import (
+	"ISCTF/config"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Orchestrator 抽象动态题目实例的生命周期管理，具体后端由配置 docker.backend 决定
+type Orchestrator interface {
+	// Create 创建并启动一个实例，返回时已包含对外发布的端口
+	Create(ctx context.Context, spec InstanceSpec) (*Instance, error)
+	// Destroy 销毁实例，实例不存在时返回 ErrInstanceNotFound
+	Destroy(ctx context.Context, id string) error
+	// Inspect 查询实例当前状态，实例不存在时返回 ErrInstanceNotFound
+	Inspect(ctx context.Context, id string) (*Instance, error)
+	// List 列出平台创建的全部实例
+	List(ctx context.Context) ([]Instance, error)
+	// Watch 持续把实例的启动、退出、删除等事件写入 out，直到 ctx 取消或事件流中断
+	Watch(ctx context.Context, out chan<- InstanceEvent) error
+	// EnsureNetwork 创建实例网络，同名网络已存在时直接返回
+	EnsureNetwork(ctx context.Context, spec NetworkSpec) error
+	// RemoveNetwork 删除网络，网络不存在时返回 nil，仍有实例接入时返回错误
+	RemoveNetwork(ctx context.Context, name string) error
+	// ListNetworks 列出平台创建的全部网络名称
+	ListNetworks(ctx context.Context) ([]string, error)
+	// Exec 在运行中的实例内执行命令，实例不存在时返回 ErrInstanceNotFound
+	Exec(ctx context.Context, id string, cmd []string, env []string) (*ExecResult, error)
+}
+
+// NetworkSpec 描述实例使用的私有网络
+type NetworkSpec struct {
+	Name     string
+	Internal bool // 内部网络没有出网路由
+	Labels   map[string]string
+}
+
+// InstanceSpec 描述要创建的实例
+type InstanceSpec struct {
+	Name        string
+	Image       string
+	Env         []string
+	Ports       []uint32 // 需要对外发布的容器端口
+	Labels      map[string]string
+	Networks    []string       // 接入的网络，为空时使用后端默认网络
+	Aliases     []string       // 实例在 Networks 中除名称外的别名（多服务题目中为服务名）
+	PrivateOnly bool           // 只接入 Networks，不对外发布端口（禁止出网或全部端口都经转发时使用，由网关和代理经网络访问）
+	Files       []InstanceFile // 启动前写入实例的文件（Swarm 使用 secret 挂载）
+	MemoryBytes int64
+	NanoCPUs    int64
+	PidsLimit   int64
+}
+
+// InstanceFile 是启动前写入实例的一个只读文件
+type InstanceFile struct {
+	Path    string // 容器内的绝对路径
+	Content []byte
+}
+
+// ExecResult 是在实例内执行命令的结果
+type ExecResult struct {
+	ExitCode int
+	Output   string // 标准输出，超过 maxExecOutput 的部分被截断
+}
+
+// maxExecOutput 是 Exec 读取的最大输出长度
+const maxExecOutput = 64 * 1024
+
+// PortMapping 是容器端口到对外发布端口的映射
+type PortMapping struct {
+	TargetPort    uint32 `json:"target_port"`
+	PublishedPort uint32 `json:"published_port"`
+}
+
+// Instance 是编排后端中一个实例的快照
+type Instance struct {
+	ID        string
+	Name      string
+	Image     string
+	Running   bool
+	Host      string // 后端能确定的对外连接地址（如节点标签），为空时使用配置 docker.public_host
+	Ports     []PortMapping
+	Labels    map[string]string
+	CreatedAt time.Time
+}
+
+// InstanceEventKind 是实例事件的类型
+type InstanceEventKind string
+
+const (
+	InstanceStarted InstanceEventKind = "started" // 实例（或重启后的新任务）开始运行
+	InstanceDied    InstanceEventKind = "died"    // 实例进程退出
+	InstanceOOM     InstanceEventKind = "oom"     // 实例因内存超限被杀，随后通常还会有一条 died
+	InstanceRemoved InstanceEventKind = "removed" // 实例已从编排后端删除
+)
+
+// InstanceEvent 是编排后端上报的一条实例状态变化
+type InstanceEvent struct {
+	InstanceID string
+	Kind       InstanceEventKind
+	ExitCode   *int
+	Reason     string // 后端给出的失败原因，可能为空
+	Time       time.Time
+}
+
+// ErrInstanceNotFound 表示编排后端中不存在该实例
+var ErrInstanceNotFound = errors.New("instance not found")
+
+// instanceNamePrefix 是平台创建的所有实例名称的前缀
+const instanceNamePrefix = "ctf-"
+
+// Orch 是全局使用的编排后端，由 InitOrchestrator 初始化
+var Orch Orchestrator
+
+// InitOrchestrator 根据配置选择并初始化编排后端
+func InitOrchestrator(cfg config.DockerConfig) error {
+	orch, err := NewOrchestrator(cfg)
+	if err != nil {
+		return err
+	}
+	Orch = orch
+	log.Printf("Container orchestrator initialized (backend: %s).", cfg.Backend)
+	return nil
+}
+
+// NewOrchestrator 创建配置指定的编排后端
+func NewOrchestrator(cfg config.DockerConfig) (Orchestrator, error) {
+	switch cfg.Backend {
+	case "swarm":
+		return newSwarmOrchestrator(cfg)
+	case "docker":
+		return newDockerOrchestrator(cfg)
+	case "fake":
+		return NewFakeOrchestrator(), nil
+	default:
+		return nil, fmt.Errorf("unsupported orchestrator backend %q", cfg.Backend)
+	}
+}
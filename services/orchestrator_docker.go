@@ -0,0 +1,260 @@
+// file: services/orchestrator_docker.go
+package services
+
+import (
+	"ISCTF/config"
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+// dockerOrchestrator 使用单机 Docker（docker run）部署实例，适合没有 Swarm 的小型比赛
+type dockerOrchestrator struct {
+	cli *client.Client
+	// attach 是需要接入实例网络的平台容器
+	attach string
+}
+
+func newDockerOrchestrator(cfg config.DockerConfig) (*dockerOrchestrator, error) {
+	cli, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := cli.Ping(context.Background()); err != nil {
+		return nil, fmt.Errorf("ping docker daemon: %w", err)
+	}
+	return &dockerOrchestrator{cli: cli, attach: cfg.AttachContainer}, nil
+}
+
+func (o *dockerOrchestrator) Create(ctx context.Context, spec InstanceSpec) (*Instance, error) {
+	exposed := nat.PortSet{}
+	bindings := nat.PortMap{}
+	for _, port := range spec.Ports {
+		p := nat.Port(fmt.Sprintf("%d/tcp", port))
+		exposed[p] = struct{}{}
+		if !spec.PrivateOnly {
+			bindings[p] = []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: ""}} // 随机分配宿主机端口
+		}
+	}
+
+	aliases := append([]string{spec.Name}, spec.Aliases...)
+	// 单机 Docker 创建时只能指定一个网络，其余网络在启动前接入
+	var networkMode container.NetworkMode
+	var netConfig *network.NetworkingConfig
+	if len(spec.Networks) > 0 {
+		networkMode = container.NetworkMode(spec.Networks[0])
+		netConfig = &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{
+			spec.Networks[0]: {Aliases: aliases},
+		}}
+	}
+
+	resp, err := o.cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:        spec.Image,
+			Env:          spec.Env,
+			Labels:       spec.Labels,
+			ExposedPorts: exposed,
+		},
+		&container.HostConfig{
+			NetworkMode:   networkMode,
+			PortBindings:  bindings,
+			RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyOnFailure, MaximumRetryCount: 3},
+			Resources: container.Resources{
+				Memory:    spec.MemoryBytes,
+				NanoCPUs:  spec.NanoCPUs,
+				PidsLimit: &spec.PidsLimit,
+			},
+		},
+		netConfig, nil, spec.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range spec.Networks[min(1, len(spec.Networks)):] {
+		if err := o.cli.NetworkConnect(ctx, name, resp.ID, &network.EndpointSettings{Aliases: aliases}); err != nil {
+			_ = o.cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+			return nil, fmt.Errorf("connect network %s: %w", name, err)
+		}
+	}
+
+	for _, file := range spec.Files {
+		if err := o.copyFile(ctx, resp.ID, file); err != nil {
+			_ = o.cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+			return nil, fmt.Errorf("copy %s: %w", file.Path, err)
+		}
+	}
+
+	if err := o.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		_ = o.cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+		return nil, err
+	}
+	return o.Inspect(ctx, resp.ID)
+}
+
+// copyFile 在容器启动前以 tar 归档写入文件，目标目录需在镜像中存在
+func (o *dockerOrchestrator) copyFile(ctx context.Context, id string, file InstanceFile) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    path.Base(file.Path),
+		Mode:    0o444,
+		Size:    int64(len(file.Content)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(file.Content); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return o.cli.CopyToContainer(ctx, id, path.Dir(file.Path), &buf, container.CopyToContainerOptions{})
+}
+
+func (o *dockerOrchestrator) Exec(ctx context.Context, id string, cmd []string, env []string) (*ExecResult, error) {
+	return execInContainer(ctx, o.cli, id, cmd, env)
+}
+
+func (o *dockerOrchestrator) Destroy(ctx context.Context, id string) error {
+	err := o.cli.ContainerRemove(ctx, id, container.RemoveOptions{Force: true})
+	if cerrdefs.IsNotFound(err) {
+		return ErrInstanceNotFound
+	}
+	return err
+}
+
+func (o *dockerOrchestrator) Inspect(ctx context.Context, id string) (*Instance, error) {
+	info, err := o.cli.ContainerInspect(ctx, id)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, ErrInstanceNotFound
+		}
+		return nil, err
+	}
+
+	inst := &Instance{
+		ID:      info.ID,
+		Name:    strings.TrimPrefix(info.Name, "/"),
+		Image:   info.Config.Image,
+		Running: info.State != nil && info.State.Running,
+		Labels:  info.Config.Labels,
+	}
+	if created, err := time.Parse(time.RFC3339Nano, info.Created); err == nil {
+		inst.CreatedAt = created
+	}
+	if info.NetworkSettings != nil {
+		for port, bindings := range info.NetworkSettings.Ports {
+			for _, b := range bindings {
+				published, err := strconv.ParseUint(b.HostPort, 10, 32)
+				if err != nil {
+					continue
+				}
+				inst.Ports = append(inst.Ports, PortMapping{TargetPort: uint32(port.Int()), PublishedPort: uint32(published)})
+				break
+			}
+		}
+	}
+	return inst, nil
+}
+
+func (o *dockerOrchestrator) List(ctx context.Context) ([]Instance, error) {
+	containers, err := o.cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("name", "^/"+instanceNamePrefix)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Instance, 0, len(containers))
+	for _, c := range containers {
+		inst := Instance{
+			ID:        c.ID,
+			Image:     c.Image,
+			Running:   c.State == container.StateRunning,
+			Labels:    c.Labels,
+			CreatedAt: time.Unix(c.Created, 0),
+		}
+		if len(c.Names) > 0 {
+			inst.Name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		for _, p := range c.Ports {
+			if p.PublicPort != 0 {
+				inst.Ports = append(inst.Ports, PortMapping{TargetPort: uint32(p.PrivatePort), PublishedPort: uint32(p.PublicPort)})
+			}
+		}
+		list = append(list, inst)
+	}
+	return list, nil
+}
+
+func (o *dockerOrchestrator) EnsureNetwork(ctx context.Context, spec NetworkSpec) error {
+	return ensureNetwork(ctx, o.cli, "bridge", spec, o.attach)
+}
+
+func (o *dockerOrchestrator) RemoveNetwork(ctx context.Context, name string) error {
+	return removeNetwork(ctx, o.cli, name, o.attach)
+}
+
+func (o *dockerOrchestrator) ListNetworks(ctx context.Context) ([]string, error) {
+	return listNetworks(ctx, o.cli)
+}
+
+func (o *dockerOrchestrator) Watch(ctx context.Context, out chan<- InstanceEvent) error {
+	msgs, errs := o.cli.Events(ctx, events.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", string(events.ContainerEventType)),
+			filters.Arg("label", LabelManaged+"=true"),
+			filters.Arg("event", string(events.ActionStart)),
+			filters.Arg("event", string(events.ActionDie)),
+			filters.Arg("event", string(events.ActionOOM)),
+			filters.Arg("event", string(events.ActionDestroy)),
+		),
+	})
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case msg := <-msgs:
+			ev := InstanceEvent{
+				InstanceID: msg.Actor.ID,
+				Time:       time.Unix(0, msg.TimeNano),
+			}
+			switch msg.Action {
+			case events.ActionStart:
+				ev.Kind = InstanceStarted
+			case events.ActionDie:
+				ev.Kind = InstanceDied
+				if code, err := strconv.Atoi(msg.Actor.Attributes["exitCode"]); err == nil {
+					ev.ExitCode = &code
+				}
+			case events.ActionOOM:
+				ev.Kind = InstanceOOM
+			case events.ActionDestroy:
+				ev.Kind = InstanceRemoved
+			default:
+				continue
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
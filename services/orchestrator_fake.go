@@ -0,0 +1,193 @@
+// file: services/orchestrator_fake.go
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeOrchestrator 是纯内存实现，用于测试以及只有静态题目的比赛（无需 Docker）
+type FakeOrchestrator struct {
+	mu        sync.Mutex
+	seq       int
+	nextPort  uint32
+	instances map[string]*Instance
+	files     map[string]map[string][]byte // 实例 ID -> 路径 -> 内容
+	env       map[string][]string
+	watchers  map[chan<- InstanceEvent]struct{}
+	networks  map[string]NetworkSpec
+}
+
+func NewFakeOrchestrator() *FakeOrchestrator {
+	return &FakeOrchestrator{
+		nextPort:  30000,
+		instances: make(map[string]*Instance),
+		files:     make(map[string]map[string][]byte),
+		env:       make(map[string][]string),
+		watchers:  make(map[chan<- InstanceEvent]struct{}),
+		networks:  make(map[string]NetworkSpec),
+	}
+}
+
+func (f *FakeOrchestrator) Create(_ context.Context, spec InstanceSpec) (*Instance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	inst := &Instance{
+		ID:        fmt.Sprintf("fake-%d", f.seq),
+		Name:      spec.Name,
+		Image:     spec.Image,
+		Running:   true,
+		Labels:    copyLabels(spec.Labels),
+		CreatedAt: time.Now(),
+	}
+	for _, name := range spec.Networks {
+		if _, ok := f.networks[name]; !ok {
+			return nil, fmt.Errorf("network %s not found", name)
+		}
+	}
+	if !spec.PrivateOnly {
+		for _, port := range spec.Ports {
+			f.nextPort++
+			inst.Ports = append(inst.Ports, PortMapping{TargetPort: port, PublishedPort: f.nextPort})
+		}
+	}
+	f.instances[inst.ID] = inst
+	f.env[inst.ID] = append([]string(nil), spec.Env...)
+	f.files[inst.ID] = make(map[string][]byte, len(spec.Files))
+	for _, file := range spec.Files {
+		f.files[inst.ID][file.Path] = file.Content
+	}
+	f.emit(InstanceEvent{InstanceID: inst.ID, Kind: InstanceStarted, Time: inst.CreatedAt})
+
+	out := *inst
+	return &out, nil
+}
+
+func (f *FakeOrchestrator) Destroy(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.instances[id]; !ok {
+		return ErrInstanceNotFound
+	}
+	delete(f.instances, id)
+	delete(f.files, id)
+	delete(f.env, id)
+	f.emit(InstanceEvent{InstanceID: id, Kind: InstanceRemoved, Time: time.Now()})
+	return nil
+}
+
+func (f *FakeOrchestrator) Inspect(_ context.Context, id string) (*Instance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	inst, ok := f.instances[id]
+	if !ok {
+		return nil, ErrInstanceNotFound
+	}
+	out := *inst
+	return &out, nil
+}
+
+func (f *FakeOrchestrator) List(_ context.Context) ([]Instance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := make([]Instance, 0, len(f.instances))
+	for _, inst := range f.instances {
+		list = append(list, *inst)
+	}
+	return list, nil
+}
+
+// Exec 只模拟 printenv NAME 和 cat PATH 两种命令，其余命令直接视为成功
+func (f *FakeOrchestrator) Exec(_ context.Context, id string, cmd []string, _ []string) (*ExecResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.instances[id]; !ok {
+		return nil, ErrInstanceNotFound
+	}
+	if len(cmd) == 2 && cmd[0] == "printenv" {
+		for _, kv := range f.env[id] {
+			if k, v, _ := strings.Cut(kv, "="); k == cmd[1] {
+				return &ExecResult{Output: v + "\n"}, nil
+			}
+		}
+		return &ExecResult{ExitCode: 1}, nil
+	}
+	if len(cmd) == 2 && cmd[0] == "cat" {
+		content, ok := f.files[id][cmd[1]]
+		if !ok {
+			return &ExecResult{ExitCode: 1}, nil
+		}
+		return &ExecResult{Output: string(content)}, nil
+	}
+	return &ExecResult{}, nil
+}
+
+func (f *FakeOrchestrator) EnsureNetwork(_ context.Context, spec NetworkSpec) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.networks[spec.Name]; !ok {
+		spec.Labels = copyLabels(spec.Labels)
+		f.networks[spec.Name] = spec
+	}
+	return nil
+}
+
+func (f *FakeOrchestrator) RemoveNetwork(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.networks, name)
+	return nil
+}
+
+func (f *FakeOrchestrator) ListNetworks(_ context.Context) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := make([]string, 0, len(f.networks))
+	for name := range f.networks {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (f *FakeOrchestrator) Watch(ctx context.Context, out chan<- InstanceEvent) error {
+	f.mu.Lock()
+	f.watchers[out] = struct{}{}
+	f.mu.Unlock()
+
+	<-ctx.Done()
+
+	f.mu.Lock()
+	delete(f.watchers, out)
+	f.mu.Unlock()
+	return ctx.Err()
+}
+
+// emit 把事件发给所有订阅者，调用方需持有 f.mu；订阅者来不及消费时丢弃事件
+func (f *FakeOrchestrator) emit(ev InstanceEvent) {
+	for ch := range f.watchers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,386 @@
+// file: services/orchestrator_swarm.go
+package services
+
+import (
+	"ISCTF/config"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+)
+
+// swarmOrchestrator 将每个实例部署为一个 Docker Swarm 服务
+type swarmOrchestrator struct {
+	cli *client.Client
+	// hostLabel 是记录节点对外地址的节点标签名
+	hostLabel string
+	// attach 是需要接入实例网络的平台容器
+	attach string
+	// nodeID 是平台所连 Docker 守护进程所在的节点，Exec 只能进入该节点上的任务容器
+	nodeID string
+}
+
+func newSwarmOrchestrator(cfg config.DockerConfig) (*swarmOrchestrator, error) {
+	cli, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := cli.Info(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("get docker info: %w", err)
+	}
+	if info.Swarm.LocalNodeState != swarm.LocalNodeStateActive {
+		return nil, errors.New("docker is not running in Swarm mode, please run 'docker swarm init' or choose another backend")
+	}
+	return &swarmOrchestrator{cli: cli, hostLabel: cfg.PublicHostLabel, attach: cfg.AttachContainer, nodeID: info.Swarm.NodeID}, nil
+}
+
+func (o *swarmOrchestrator) Create(ctx context.Context, spec InstanceSpec) (*Instance, error) {
+	// 确保镜像可用 (在生产环境中，建议提前在所有 Swarm Node 上拉取镜像)
+	// var registryAuth string
+	// if err := ensureImage(ctx, o.cli, spec.Image, registryAuth); err != nil {
+	// 	return nil, fmt.Errorf("ensure image failed: %v", err)
+	// }
+
+	var portConfigs []swarm.PortConfig
+	if !spec.PrivateOnly {
+		for _, port := range spec.Ports {
+			portConfigs = append(portConfigs, swarm.PortConfig{
+				Protocol:    swarm.PortConfigProtocolTCP,
+				TargetPort:  port,
+				PublishMode: swarm.PortConfigPublishModeIngress, // 使用随机端口模式
+			})
+		}
+	}
+	// 实例在网络内以自己的名称作为别名，网关和代理按名称访问；多服务题目的服务之间按服务名访问
+	aliases := append([]string{spec.Name}, spec.Aliases...)
+	var networks []swarm.NetworkAttachmentConfig
+	for _, name := range spec.Networks {
+		networks = append(networks, swarm.NetworkAttachmentConfig{Target: name, Aliases: aliases})
+	}
+
+	// 文件以 secret 的形式挂载，secret 随服务一起删除
+	var secrets []*swarm.SecretReference
+	for i, file := range spec.Files {
+		created, err := o.cli.SecretCreate(ctx, swarm.SecretSpec{
+			Annotations: swarm.Annotations{Name: fmt.Sprintf("%s-file-%d", spec.Name, i), Labels: spec.Labels},
+			Data:        file.Content,
+		})
+		if err != nil {
+			o.removeSecrets(secrets)
+			return nil, fmt.Errorf("create secret for %s: %w", file.Path, err)
+		}
+		secrets = append(secrets, &swarm.SecretReference{
+			SecretID:   created.ID,
+			SecretName: fmt.Sprintf("%s-file-%d", spec.Name, i),
+			File:       &swarm.SecretReferenceFileTarget{Name: file.Path, UID: "0", GID: "0", Mode: 0o444},
+		})
+	}
+
+	serviceSpec := swarm.ServiceSpec{
+		Annotations: swarm.Annotations{
+			Name:   spec.Name,
+			Labels: spec.Labels,
+		},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{
+				Image:   spec.Image,
+				Env:     spec.Env,
+				Secrets: secrets,
+			},
+			Resources: &swarm.ResourceRequirements{
+				Limits: &swarm.Limit{
+					MemoryBytes: spec.MemoryBytes,
+					NanoCPUs:    spec.NanoCPUs,
+					Pids:        spec.PidsLimit,
+				},
+			},
+			Networks: networks,
+		},
+		EndpointSpec: &swarm.EndpointSpec{
+			Ports: portConfigs,
+		},
+	}
+
+	resp, err := o.cli.ServiceCreate(ctx, serviceSpec, swarm.ServiceCreateOptions{})
+	if err != nil {
+		o.removeSecrets(secrets)
+		return nil, err
+	}
+
+	// 发布端口由 Swarm 分配，需要重新查询服务才能拿到
+	inst, err := o.Inspect(ctx, resp.ID)
+	if err != nil {
+		return &Instance{ID: resp.ID, Name: spec.Name, Image: spec.Image, Labels: spec.Labels}, nil
+	}
+	return inst, nil
+}
+
+func (o *swarmOrchestrator) Destroy(ctx context.Context, id string) error {
+	var secrets []*swarm.SecretReference
+	if svc, _, err := o.cli.ServiceInspectWithRaw(ctx, id, swarm.ServiceInspectOptions{}); err == nil && svc.Spec.TaskTemplate.ContainerSpec != nil {
+		secrets = svc.Spec.TaskTemplate.ContainerSpec.Secrets
+	}
+	err := o.cli.ServiceRemove(ctx, id)
+	if cerrdefs.IsNotFound(err) {
+		return ErrInstanceNotFound
+	}
+	if err == nil {
+		o.removeSecrets(secrets)
+	}
+	return err
+}
+
+// removeSecrets 尽力删除实例专属的 secret
+func (o *swarmOrchestrator) removeSecrets(secrets []*swarm.SecretReference) {
+	for _, ref := range secrets {
+		_ = o.cli.SecretRemove(context.Background(), ref.SecretID)
+	}
+}
+
+// Exec 进入服务正在运行的任务容器执行命令，只支持调度到平台所在节点的任务
+func (o *swarmOrchestrator) Exec(ctx context.Context, id string, cmd []string, env []string) (*ExecResult, error) {
+	tasks, err := o.cli.TaskList(ctx, swarm.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("service", id), filters.Arg("desired-state", "running")),
+	})
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, ErrInstanceNotFound
+		}
+		return nil, err
+	}
+	for _, task := range tasks {
+		if task.Status.State != swarm.TaskStateRunning || task.Status.ContainerStatus == nil {
+			continue
+		}
+		if task.NodeID != o.nodeID {
+			return nil, fmt.Errorf("task %s runs on node %s, exec is only supported on the local node", task.ID, task.NodeID)
+		}
+		return execInContainer(ctx, o.cli, task.Status.ContainerStatus.ContainerID, cmd, env)
+	}
+	return nil, errors.New("no running task")
+}
+
+func (o *swarmOrchestrator) Inspect(ctx context.Context, id string) (*Instance, error) {
+	svc, _, err := o.cli.ServiceInspectWithRaw(ctx, id, swarm.ServiceInspectOptions{})
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, ErrInstanceNotFound
+		}
+		return nil, err
+	}
+
+	inst := serviceToInstance(svc)
+	tasks, err := o.cli.TaskList(ctx, swarm.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("service", svc.ID), filters.Arg("desired-state", "running")),
+	})
+	nodeID := ""
+	if err == nil {
+		for _, task := range tasks {
+			if task.Status.State == swarm.TaskStateRunning {
+				inst.Running = true
+				nodeID = task.NodeID
+				break
+			}
+			if nodeID == "" {
+				nodeID = task.NodeID
+			}
+		}
+	}
+	inst.Host = o.publicHost(ctx, nodeID)
+	return &inst, nil
+}
+
+// publicHost 读取节点标签中的对外地址：优先使用任务所在节点，
+// 任务尚未调度时使用任一设置了标签的可用节点（ingress 模式下任意节点都能转发）。
+// 没有节点设置标签时返回空字符串
+func (o *swarmOrchestrator) publicHost(ctx context.Context, nodeID string) string {
+	if o.hostLabel == "" {
+		return ""
+	}
+	if nodeID != "" {
+		if node, _, err := o.cli.NodeInspectWithRaw(ctx, nodeID); err == nil {
+			if host := node.Spec.Labels[o.hostLabel]; host != "" {
+				return host
+			}
+		}
+	}
+	nodes, err := o.cli.NodeList(ctx, swarm.NodeListOptions{
+		Filters: filters.NewArgs(filters.Arg("node.label", o.hostLabel)),
+	})
+	if err != nil {
+		return ""
+	}
+	for _, node := range nodes {
+		if node.Status.State == swarm.NodeStateReady && node.Spec.Labels[o.hostLabel] != "" {
+			return node.Spec.Labels[o.hostLabel]
+		}
+	}
+	return ""
+}
+
+func (o *swarmOrchestrator) List(ctx context.Context) ([]Instance, error) {
+	services, err := o.cli.ServiceList(ctx, swarm.ServiceListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", instanceNamePrefix)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Instance, 0, len(services))
+	for _, svc := range services {
+		list = append(list, serviceToInstance(svc))
+	}
+	return list, nil
+}
+
+func serviceToInstance(svc swarm.Service) Instance {
+	inst := Instance{
+		ID:        svc.ID,
+		Name:      svc.Spec.Name,
+		Labels:    svc.Spec.Labels,
+		CreatedAt: svc.CreatedAt,
+	}
+	if svc.Spec.TaskTemplate.ContainerSpec != nil {
+		inst.Image = svc.Spec.TaskTemplate.ContainerSpec.Image
+	}
+	for _, port := range svc.Endpoint.Ports {
+		inst.Ports = append(inst.Ports, PortMapping{TargetPort: port.TargetPort, PublishedPort: port.PublishedPort})
+	}
+	return inst
+}
+
+func (o *swarmOrchestrator) EnsureNetwork(ctx context.Context, spec NetworkSpec) error {
+	return ensureNetwork(ctx, o.cli, "overlay", spec, o.attach)
+}
+
+func (o *swarmOrchestrator) RemoveNetwork(ctx context.Context, name string) error {
+	return removeNetwork(ctx, o.cli, name, o.attach)
+}
+
+func (o *swarmOrchestrator) ListNetworks(ctx context.Context) ([]string, error) {
+	return listNetworks(ctx, o.cli)
+}
+
+// swarmTaskPollInterval 是轮询任务状态的间隔。
+// Swarm 管理节点的事件流只包含本机容器事件，其他节点上任务的失败和重启只能通过任务列表获知
+const swarmTaskPollInterval = 5 * time.Second
+
+func (o *swarmOrchestrator) Watch(ctx context.Context, out chan<- InstanceEvent) error {
+	msgs, errs := o.cli.Events(ctx, events.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", string(events.ServiceEventType)),
+			filters.Arg("event", string(events.ActionRemove)),
+		),
+	})
+	ticker := time.NewTicker(swarmTaskPollInterval)
+	defer ticker.Stop()
+
+	send := func(ev InstanceEvent) error {
+		select {
+		case out <- ev:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// seen 记录每个任务上次上报时的状态；首轮只记录不上报，启动前错过的变化由对账任务处理
+	seen := make(map[string]swarm.TaskState)
+	first := true
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case msg := <-msgs:
+			if err := send(InstanceEvent{
+				InstanceID: msg.Actor.ID,
+				Kind:       InstanceRemoved,
+				Time:       time.Unix(0, msg.TimeNano),
+			}); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			evs, err := o.pollTasks(ctx, seen, first)
+			if err != nil {
+				return err
+			}
+			first = false
+			for _, ev := range evs {
+				if err := send(ev); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// pollTasks 对比任务状态与上次记录，返回新出现的启动和失败事件
+func (o *swarmOrchestrator) pollTasks(ctx context.Context, seen map[string]swarm.TaskState, silent bool) ([]InstanceEvent, error) {
+	services, err := o.cli.ServiceList(ctx, swarm.ServiceListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", instanceNamePrefix)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(services) == 0 {
+		clear(seen)
+		return nil, nil
+	}
+
+	args := filters.NewArgs()
+	for _, svc := range services {
+		args.Add("service", svc.ID)
+	}
+	tasks, err := o.cli.TaskList(ctx, swarm.TaskListOptions{Filters: args})
+	if err != nil {
+		return nil, err
+	}
+
+	var evs []InstanceEvent
+	current := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		current[task.ID] = true
+		state := task.Status.State
+		if seen[task.ID] == state {
+			continue
+		}
+		seen[task.ID] = state
+		if silent {
+			continue
+		}
+
+		ev := InstanceEvent{
+			InstanceID: task.ServiceID,
+			Reason:     task.Status.Err,
+			Time:       task.Status.Timestamp,
+		}
+		switch state {
+		case swarm.TaskStateRunning:
+			ev.Kind = InstanceStarted
+		case swarm.TaskStateFailed, swarm.TaskStateRejected, swarm.TaskStateComplete:
+			ev.Kind = InstanceDied
+			if task.Status.ContainerStatus != nil {
+				code := task.Status.ContainerStatus.ExitCode
+				ev.ExitCode = &code
+			}
+		default:
+			continue
+		}
+		evs = append(evs, ev)
+	}
+	for id := range seen {
+		if !current[id] {
+			delete(seen, id)
+		}
+	}
+	return evs, nil
+}
@@ -0,0 +1,122 @@
+// file: services/reaper.go
+package services
+
+import (
+	"ISCTF/config"
+	"ISCTF/database"
+	"ISCTF/models"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const reaperLockKey = "lock:container_reaper"
+
+// ReleaseContainer 是销毁动态容器的统一入口：先在数据库中把 running/stopped 原子地改为 destroyed，
+// 抢到这一步的调用方再去销毁实例，因此多个副本或多个请求并发调用也只会销毁一次。
+// 返回 false 表示容器已被其他调用方释放。
+func ReleaseContainer(ctx context.Context, container *models.Container) (bool, error) {
+	result := database.DB.Model(&models.Container{}).
+		Where("id = ? AND state IN ?", container.ID, models.InstanceStates).
+		Update("state", models.ContainerStateDestroyed)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	container.State = models.ContainerStateDestroyed
+	ForgetGatewayToken(container.GatewayToken)
+	CloseProxyConnections(container.ID)
+
+	if err := DestroyContainerUnit(ctx, *container); err != nil {
+		// 数据库已标记销毁，残留的实例由对账任务清理
+		return true, err
+	}
+	return true, nil
+}
+
+// StartContainerReaper 启动后台任务，定期销毁到期容器并提醒即将到期的队伍
+func StartContainerReaper(ctx context.Context, cfg config.ContainerConfig) {
+	go func() {
+		ticker := time.NewTicker(cfg.ReaperInterval)
+		defer ticker.Stop()
+		for {
+			runReaper(ctx, cfg)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Printf("Container reaper started (interval %s, warning %s before expiry).", cfg.ReaperInterval, cfg.ExpiryWarning)
+}
+
+func runReaper(ctx context.Context, cfg config.ContainerConfig) {
+	// 锁的有效期与执行间隔相同，副本崩溃时锁会自动释放
+	lock, ok := tryLock(ctx, reaperLockKey, cfg.ReaperInterval)
+	if !ok {
+		return
+	}
+	defer lock.Release()
+
+	WarnExpiringContainers(cfg.ExpiryWarning)
+	ReapExpiredContainers(ctx)
+}
+
+// ReapExpiredContainers 销毁所有超过 EndTime 仍未释放的容器
+func ReapExpiredContainers(ctx context.Context) {
+	var expired []models.Container
+	if err := database.DB.
+		Where("state IN ? AND end_time <= ?", models.InstanceStates, time.Now()).
+		Find(&expired).Error; err != nil {
+		log.Printf("Reaper: failed to query expired containers: %v", err)
+		return
+	}
+
+	for i := range expired {
+		released, err := ReleaseContainer(ctx, &expired[i])
+		if err != nil {
+			log.Printf("Reaper: container %d: %v", expired[i].ID, err)
+		}
+		if released {
+			log.Printf("Reaper: container %d (team %d, challenge %d) expired and destroyed.", expired[i].ID, expired[i].TeamID, expired[i].ChallengeID)
+			_ = PushTeamNotice(expired[i].TeamID, TeamNotice{
+				Kind:        "container_expired",
+				Message:     "Container has expired and was destroyed",
+				ContainerID: expired[i].ID,
+			})
+		}
+	}
+}
+
+// WarnExpiringContainers 提醒将在 before 时间内到期的容器，每个容器（每次续期后）只提醒一次
+func WarnExpiringContainers(before time.Duration) {
+	now := time.Now()
+	var expiring []models.Container
+	if err := database.DB.
+		Where("state IN ? AND expiry_warned_at IS NULL AND end_time > ? AND end_time <= ?",
+			models.InstanceStates, now, now.Add(before)).
+		Find(&expiring).Error; err != nil {
+		log.Printf("Reaper: failed to query expiring containers: %v", err)
+		return
+	}
+
+	for _, container := range expiring {
+		// 条件更新保证多个副本不会重复提醒
+		result := database.DB.Model(&models.Container{}).
+			Where("id = ? AND expiry_warned_at IS NULL", container.ID).
+			Update("expiry_warned_at", now)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+		remaining := container.EndTime.Sub(now).Round(time.Second)
+		_ = PushTeamNotice(container.TeamID, TeamNotice{
+			Kind:        "container_expiring",
+			Message:     fmt.Sprintf("Container will expire in %s, renew it if you still need it", remaining),
+			ContainerID: container.ID,
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"ISCTF/database"
+	"ISCTF/models"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReapExpiredContainers(t *testing.T) {
+	fake := setupContainerTest(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		state         models.ContainerState
+		endTime       time.Time
+		wantState     models.ContainerState
+		wantDestroyed bool // 实例被销毁并通知队伍
+	}{
+		{"expired running", models.ContainerStateRunning, now.Add(-time.Minute), models.ContainerStateDestroyed, true},
+		{"expired stopped", models.ContainerStateStopped, now.Add(-time.Minute), models.ContainerStateDestroyed, true},
+		{"not expired", models.ContainerStateRunning, now.Add(time.Hour), models.ContainerStateRunning, false},
+		{"expired pending is left to the reconciler", models.ContainerStatePending, now.Add(-time.Minute), models.ContainerStatePending, false},
+	}
+
+	type created struct {
+		container models.Container
+		instance  *Instance
+	}
+	rows := make([]created, len(tests))
+	for i, tt := range tests {
+		teamID := uint32(i + 1)
+		c := insertTestContainer(t, models.Container{TeamID: teamID, ChallengeID: 1, State: tt.state, EndTime: tt.endTime})
+		inst := startTestInstance(t, fake, c.ID, teamID)
+		database.DB.Model(&c).Update("docker_id", inst.ID)
+		rows[i] = created{c, inst}
+	}
+
+	ReapExpiredContainers(ctx)
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := rows[i]
+			if got := containerState(t, row.container.ID); got != tt.wantState {
+				t.Errorf("state = %s, want %s", got, tt.wantState)
+			}
+			if alive := hasInstance(fake, row.instance.ID); alive == tt.wantDestroyed {
+				t.Errorf("instance alive = %v, want %v", alive, !tt.wantDestroyed)
+			}
+			notices, err := PopTeamNotices(row.container.TeamID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantDestroyed != (len(notices) == 1 && notices[0].Kind == "container_expired") {
+				t.Errorf("notices = %+v", notices)
+			}
+		})
+	}
+}
+
+func TestReleaseContainerOnlyOnce(t *testing.T) {
+	fake := setupContainerTest(t)
+	ctx := context.Background()
+
+	c := insertTestContainer(t, models.Container{TeamID: 1, ChallengeID: 1, State: models.ContainerStateRunning, EndTime: time.Now().Add(time.Hour)})
+	inst := startTestInstance(t, fake, c.ID, 1)
+	c.DockerID = inst.ID
+	database.DB.Save(&c)
+
+	first, second := c, c
+	if released, err := ReleaseContainer(ctx, &first); !released || err != nil {
+		t.Fatalf("first ReleaseContainer = %v, %v; want true, nil", released, err)
+	}
+	if released, err := ReleaseContainer(ctx, &second); released || err != nil {
+		t.Fatalf("second ReleaseContainer = %v, %v; want false, nil", released, err)
+	}
+	if hasInstance(fake, inst.ID) {
+		t.Error("instance still exists after release")
+	}
+	if got := containerState(t, c.ID); got != models.ContainerStateDestroyed {
+		t.Errorf("state = %s, want destroyed", got)
+	}
+}
+
+func TestWarnExpiringContainers(t *testing.T) {
+	setupContainerTest(t)
+	now := time.Now()
+
+	soon := insertTestContainer(t, models.Container{TeamID: 1, ChallengeID: 1, State: models.ContainerStateRunning, EndTime: now.Add(2 * time.Minute)})
+	later := insertTestContainer(t, models.Container{TeamID: 2, ChallengeID: 1, State: models.ContainerStateRunning, EndTime: now.Add(time.Hour)})
+	destroyed := insertTestContainer(t, models.Container{TeamID: 3, ChallengeID: 1, State: models.ContainerStateDestroyed, EndTime: now.Add(2 * time.Minute)})
+
+	// 第二次执行不会重复提醒
+	WarnExpiringContainers(5 * time.Minute)
+	WarnExpiringContainers(5 * time.Minute)
+
+	tests := []struct {
+		name      string
+		container models.Container
+		want      int
+	}{
+		{"expiring soon", soon, 1},
+		{"outside warning window", later, 0},
+		{"already destroyed", destroyed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notices, err := PopTeamNotices(tt.container.TeamID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(notices) != tt.want {
+				t.Fatalf("got %d notices, want %d: %+v", len(notices), tt.want, notices)
+			}
+			if tt.want > 0 && (notices[0].Kind != "container_expiring" || notices[0].ContainerID != tt.container.ID) {
+				t.Errorf("notice = %+v", notices[0])
+			}
+		})
+	}
+
+	// 续期清空 expiry_warned_at 后会再次提醒
+	database.DB.Model(&soon).Update("expiry_warned_at", nil)
+	WarnExpiringContainers(5 * time.Minute)
+	if notices, _ := PopTeamNotices(soon.TeamID); len(notices) != 1 {
+		t.Errorf("after renewal got %d notices, want 1", len(notices))
+	}
+}
@@ -0,0 +1,245 @@
+// file: services/reconciler.go
+package services
+
+import (
+	"ISCTF/config"
+	"ISCTF/database"
+	"ISCTF/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	reconcilerLockKey = "lock:container_reconciler"
+	driftReportKey    = "container_drift:last"
+)
+
+// DriftEntry 描述一处数据库与编排后端不一致的地方以及采取的处理
+type DriftEntry struct {
+	ContainerID  uint32 `json:"container_id,omitempty"`
+	InstanceID   string `json:"instance_id,omitempty"`
+	InstanceName string `json:"instance_name,omitempty"`
+	TeamID       uint32 `json:"team_id,omitempty"`
+	ChallengeID  uint32 `json:"challenge_id,omitempty"`
+	Action       string `json:"action"`
+}
+
+// DriftReport 是一次对账的结果
+type DriftReport struct {
+	CheckedAt time.Time `json:"checked_at"`
+	// GhostContainers 数据库记录为运行中，但实例已不存在，已标记为 destroyed
+	GhostContainers []DriftEntry `json:"ghost_containers"`
+	// OrphanInstances 编排后端中存在，但没有对应的运行中记录，已删除
+	OrphanInstances []DriftEntry `json:"orphan_instances"`
+	// StalePending 长时间停留在 pending 的记录（创建过程中崩溃），已标记为 destroyed
+	StalePending []DriftEntry `json:"stale_pending"`
+	// RemovedNetworks 已没有活跃容器使用的网络，已删除
+	RemovedNetworks []string `json:"removed_networks"`
+	Errors          []string `json:"errors"`
+}
+
+// StartContainerReconciler 在启动时立即对账一次，之后按配置的间隔定期对账
+func StartContainerReconciler(ctx context.Context, cfg config.ContainerConfig) {
+	go func() {
+		ticker := time.NewTicker(cfg.ReconcileInterval)
+		defer ticker.Stop()
+		for {
+			if lock, ok := tryLock(ctx, reconcilerLockKey, cfg.ReconcileInterval); ok {
+				if _, err := ReconcileContainers(ctx, cfg.PendingGrace); err != nil {
+					log.Printf("Reconciler: %v", err)
+				}
+				lock.Release()
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Printf("Container reconciler started (interval %s).", cfg.ReconcileInterval)
+}
+
+// ReconcileContainers 对比 dalictf_container 与编排后端中的实例并修复差异，
+// 结果同时写入 Redis，供任意副本上的管理员接口查询
+func ReconcileContainers(ctx context.Context, pendingGrace time.Duration) (*DriftReport, error) {
+	now := time.Now()
+	report := &DriftReport{
+		CheckedAt:       now,
+		GhostContainers: []DriftEntry{},
+		OrphanInstances: []DriftEntry{},
+		StalePending:    []DriftEntry{},
+		RemovedNetworks: []string{},
+		Errors:          []string{},
+	}
+
+	// 编排后端查询失败时直接放弃，避免把所有记录误判为幽灵容器
+	instances, err := Orch.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list instances: %w", err)
+	}
+
+	var active []models.Container
+	if err := database.DB.
+		Where("state IN ?", models.ActiveStates).
+		Find(&active).Error; err != nil {
+		return nil, fmt.Errorf("query containers: %w", err)
+	}
+
+	byID := make(map[uint32]*models.Container, len(active))
+	byDockerID := make(map[string]*models.Container, len(active))
+	activeIDs := make([]uint32, 0, len(active))
+	for i := range active {
+		byID[active[i].ID] = &active[i]
+		activeIDs = append(activeIDs, active[i].ID)
+		if active[i].DockerID != "" {
+			byDockerID[active[i].DockerID] = &active[i]
+		}
+	}
+
+	// 多服务题目的各服务实例同样归属于容器记录
+	var unitInstances []models.ContainerInstance
+	if len(activeIDs) > 0 {
+		if err := database.DB.Where("container_id IN ?", activeIDs).Find(&unitInstances).Error; err != nil {
+			return nil, fmt.Errorf("query container instances: %w", err)
+		}
+	}
+	for _, row := range unitInstances {
+		if owner := byID[row.ContainerID]; owner != nil {
+			byDockerID[row.InstanceID] = owner
+		}
+	}
+
+	// 1. 没有对应记录的实例视为孤儿并删除
+	alive := make(map[string]bool, len(instances))
+	for _, inst := range instances {
+		alive[inst.ID] = true
+
+		owner := byDockerID[inst.ID]
+		if owner == nil {
+			owner = byID[parseLabelID(inst.Labels[LabelContainerID])]
+		}
+		if owner != nil {
+			continue
+		}
+		// 刚创建的实例可能还没来得及写回数据库
+		if !inst.CreatedAt.IsZero() && now.Sub(inst.CreatedAt) < pendingGrace {
+			continue
+		}
+
+		entry := DriftEntry{InstanceID: inst.ID, InstanceName: inst.Name, Action: "instance removed"}
+		entry.ContainerID = parseLabelID(inst.Labels[LabelContainerID])
+		entry.TeamID = parseLabelID(inst.Labels[LabelTeamID])
+		entry.ChallengeID = parseLabelID(inst.Labels[LabelChallengeID])
+		if err := DestroyInstance(ctx, inst.ID); err != nil {
+			entry.Action = "remove failed"
+			report.Errors = append(report.Errors, fmt.Sprintf("remove orphan %s: %v", inst.ID, err))
+		}
+		report.OrphanInstances = append(report.OrphanInstances, entry)
+	}
+
+	// 2. 实例（多服务题目中任一服务实例）已消失的运行中/已退出记录、以及超时的 pending 记录标记为 destroyed，
+	// 其余仍存活的服务实例在下一轮作为孤儿删除
+	missing := make(map[uint32]bool)
+	for _, row := range unitInstances {
+		if !alive[row.InstanceID] {
+			missing[row.ContainerID] = true
+		}
+	}
+	for _, container := range active {
+		entry := DriftEntry{
+			ContainerID: container.ID,
+			InstanceID:  container.DockerID,
+			TeamID:      container.TeamID,
+			ChallengeID: container.ChallengeID,
+			Action:      "marked destroyed",
+		}
+		switch container.State {
+		case models.ContainerStateRunning, models.ContainerStateStopped:
+			if alive[container.DockerID] && !missing[container.ID] {
+				continue
+			}
+			if markDestroyed(container.ID, container.State) {
+				report.GhostContainers = append(report.GhostContainers, entry)
+			}
+		case models.ContainerStatePending:
+			if now.Sub(container.StartTime) < pendingGrace {
+				continue
+			}
+			if markDestroyed(container.ID, models.ContainerStatePending) {
+				report.StalePending = append(report.StalePending, entry)
+			}
+		}
+	}
+
+	// 3. 删除没有活跃容器使用的网络；本轮刚被标记销毁的记录的网络留到下一轮再删
+	pruneNetworks(ctx, active, byID, report)
+
+	if data, err := json.Marshal(report); err == nil {
+		database.RDB.Set(database.Ctx, driftReportKey, data, 0)
+	}
+	if n := len(report.GhostContainers) + len(report.OrphanInstances) + len(report.StalePending); n > 0 {
+		log.Printf("Reconciler: fixed %d drift(s): %d ghost, %d orphan, %d stale pending.",
+			n, len(report.GhostContainers), len(report.OrphanInstances), len(report.StalePending))
+	}
+	return report, nil
+}
+
+// pruneNetworks 删除不再被任何活跃容器使用的平台网络：队伍网络按队伍判断，多服务专属网络按容器记录判断
+func pruneNetworks(ctx context.Context, active []models.Container, byID map[uint32]*models.Container, report *DriftReport) {
+	networks, err := Orch.ListNetworks(ctx)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("list networks: %v", err))
+		return
+	}
+	inUse := make(map[string]bool, len(active)*2)
+	for _, container := range active {
+		inUse[TeamNetworkName(container.TeamID, false)] = true
+		inUse[TeamNetworkName(container.TeamID, true)] = true
+	}
+	for _, name := range networks {
+		if inUse[name] {
+			continue
+		}
+		if id, ok := parseUnitNetwork(name); ok && byID[id] != nil {
+			continue
+		}
+		if err := Orch.RemoveNetwork(ctx, name); err != nil {
+			// 网络上仍有正在退出的实例时删除会失败，下一轮再试
+			log.Printf("Reconciler: remove network %s: %v", name, err)
+			continue
+		}
+		log.Printf("Reconciler: removed unused network %s.", name)
+		report.RemovedNetworks = append(report.RemovedNetworks, name)
+	}
+}
+
+// LastDriftReport 返回最近一次对账结果，尚未对账时返回 nil
+func LastDriftReport() (*DriftReport, error) {
+	val, err := database.RDB.Get(database.Ctx, driftReportKey).Result()
+	if err != nil {
+		return nil, nil
+	}
+	var report DriftReport
+	if err := json.Unmarshal([]byte(val), &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// markDestroyed 仅当记录仍处于 from 状态时标记为 destroyed，避免覆盖并发的状态变化
+func markDestroyed(containerID uint32, from models.ContainerState) bool {
+	result := database.DB.Model(&models.Container{}).
+		Where("id = ? AND state = ?", containerID, from).
+		Update("state", models.ContainerStateDestroyed)
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+func parseLabelID(v string) uint32 {
+	id, _ := strconv.ParseUint(v, 10, 32)
+	return uint32(id)
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"ISCTF/database"
+	"ISCTF/models"
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReconcileContainers(t *testing.T) {
+	fake := setupContainerTest(t)
+	ctx := context.Background()
+	now := time.Now()
+	grace := time.Minute
+
+	// 正常运行：记录与实例一致
+	healthy := insertTestContainer(t, models.Container{TeamID: 1, ChallengeID: 1, State: models.ContainerStateRunning, EndTime: now.Add(time.Hour)})
+	healthyInst := startTestInstance(t, fake, healthy.ID, 1)
+	database.DB.Model(&healthy).Update("docker_id", healthyInst.ID)
+
+	// 幽灵容器：记录为运行中，实例已不存在
+	ghost := insertTestContainer(t, models.Container{TeamID: 2, ChallengeID: 1, DockerID: "fake-gone", State: models.ContainerStateRunning, EndTime: now.Add(time.Hour)})
+
+	// 多服务题目缺了一个服务实例
+	unit := insertTestContainer(t, models.Container{TeamID: 3, ChallengeID: 2, State: models.ContainerStateRunning, EndTime: now.Add(time.Hour)})
+	unitWeb := startTestInstance(t, fake, unit.ID, 3)
+	database.DB.Model(&unit).Update("docker_id", unitWeb.ID)
+	database.DB.Create(&[]models.ContainerInstance{
+		{ContainerID: unit.ID, Service: "web", InstanceID: unitWeb.ID},
+		{ContainerID: unit.ID, Service: "db", InstanceID: "fake-db-gone"},
+	})
+
+	// 创建中的记录：实例已带标签启动，但 DockerID 还没写回
+	fresh := insertTestContainer(t, models.Container{TeamID: 4, ChallengeID: 1, State: models.ContainerStatePending, EndTime: now.Add(time.Hour)})
+	freshInst := startTestInstance(t, fake, fresh.ID, 4)
+
+	// 创建过程中崩溃，长时间停留在 pending
+	stale := insertTestContainer(t, models.Container{TeamID: 5, ChallengeID: 1, State: models.ContainerStatePending, StartTime: now.Add(-time.Hour), EndTime: now.Add(time.Hour)})
+
+	// 刚创建、没有任何记录的实例，宽限期内保留
+	orphan := startTestInstance(t, fake, 9999, 6)
+
+	// 网络：有活跃容器的队伍网络和多服务网络保留，其余删除
+	for _, name := range []string{
+		TeamNetworkName(1, false),
+		TeamNetworkName(7, false),
+		unitNetworkPrefix(healthy.ID) + "back",
+		unitNetworkPrefix(9999) + "back",
+	} {
+		fake.EnsureNetwork(ctx, NetworkSpec{Name: name})
+	}
+
+	report, err := ReconcileContainers(ctx, grace)
+	if err != nil {
+		t.Fatalf("ReconcileContainers: %v", err)
+	}
+
+	states := []struct {
+		name      string
+		container models.Container
+		want      models.ContainerState
+	}{
+		{"healthy", healthy, models.ContainerStateRunning},
+		{"ghost", ghost, models.ContainerStateDestroyed},
+		{"unit missing a service", unit, models.ContainerStateDestroyed},
+		{"fresh pending", fresh, models.ContainerStatePending},
+		{"stale pending", stale, models.ContainerStateDestroyed},
+	}
+	for _, tt := range states {
+		if got := containerState(t, tt.container.ID); got != tt.want {
+			t.Errorf("%s: state = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	ids := func(entries []DriftEntry) []uint32 {
+		var out []uint32
+		for _, e := range entries {
+			out = append(out, e.ContainerID)
+		}
+		slices.Sort(out)
+		return out
+	}
+	if got := ids(report.GhostContainers); !slices.Equal(got, []uint32{ghost.ID, unit.ID}) {
+		t.Errorf("ghost containers = %v, want [%d %d]", got, ghost.ID, unit.ID)
+	}
+	if got := ids(report.StalePending); !slices.Equal(got, []uint32{stale.ID}) {
+		t.Errorf("stale pending = %v, want [%d]", got, stale.ID)
+	}
+	if len(report.OrphanInstances) != 0 {
+		t.Errorf("orphans within grace period were removed: %+v", report.OrphanInstances)
+	}
+	for _, inst := range []*Instance{healthyInst, unitWeb, freshInst, orphan} {
+		if !hasInstance(fake, inst.ID) {
+			t.Errorf("instance %s was removed", inst.ID)
+		}
+	}
+	slices.Sort(report.RemovedNetworks)
+	if want := []string{TeamNetworkName(7, false), unitNetworkPrefix(9999) + "back"}; !slices.Equal(report.RemovedNetworks, want) {
+		t.Errorf("removed networks = %v, want %v", report.RemovedNetworks, want)
+	}
+
+	// 结果写入 Redis，供其他副本查询
+	last, err := LastDriftReport()
+	if err != nil || last == nil || len(last.GhostContainers) != 2 || len(last.StalePending) != 1 {
+		t.Errorf("LastDriftReport = %+v, %v", last, err)
+	}
+
+	// 宽限期过后，无主实例和已销毁记录残留的服务实例作为孤儿删除
+	report, err = ReconcileContainers(ctx, 0)
+	if err != nil {
+		t.Fatalf("second ReconcileContainers: %v", err)
+	}
+	var orphans []string
+	for _, e := range report.OrphanInstances {
+		orphans = append(orphans, e.InstanceID)
+	}
+	slices.Sort(orphans)
+	want := []string{orphan.ID, unitWeb.ID}
+	slices.Sort(want)
+	if !slices.Equal(orphans, want) {
+		t.Errorf("orphan instances = %v, want %v", orphans, want)
+	}
+	if hasInstance(fake, orphan.ID) || hasInstance(fake, unitWeb.ID) {
+		t.Error("orphan instances still exist")
+	}
+	if !hasInstance(fake, healthyInst.ID) || !hasInstance(fake, freshInst.ID) {
+		t.Error("owned instances were removed")
+	}
+}
+
+func TestReconcileContainersKeepsRecordsWhenListFails(t *testing.T) {
+	setupContainerTest(t)
+	Orch = failingOrchestrator{Orch}
+
+	c := insertTestContainer(t, models.Container{TeamID: 1, ChallengeID: 1, DockerID: "fake-1", State: models.ContainerStateRunning, EndTime: time.Now().Add(time.Hour)})
+	if _, err := ReconcileContainers(context.Background(), 0); err == nil {
+		t.Fatal("ReconcileContainers succeeded with a failing backend")
+	}
+	if got := containerState(t, c.ID); got != models.ContainerStateRunning {
+		t.Errorf("state = %s, want running", got)
+	}
+}
+
+// failingOrchestrator 模拟编排后端不可用
+type failingOrchestrator struct{ Orchestrator }
+
+func (failingOrchestrator) List(context.Context) ([]Instance, error) {
+	return nil, context.DeadlineExceeded
+}
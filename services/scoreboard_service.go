@@ -5,14 +5,71 @@ import (
 	"ISCTF/database"
 	"ISCTF/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log"
+	"sort"
 	"time"
 )
 
-// UpdateScoreboardCache 是核心函数，用于重新计算并更新整个排行榜
-func UpdateScoreboardCache() {
-	log.Println("Starting to update scoreboard cache...")
+// UpdateScoreboardCache 是核心函数，用于重新计算并更新一场比赛的排行榜。
+// 比赛设置了封榜时间时，另外写入一份只统计封榜前解题记录的封榜排行榜
+func UpdateScoreboardCache(contestID uint) {
+	log.Printf("Starting to update scoreboard cache of contest %d...", contestID)
 
+	entries, err := rankTeams(contestID, nil)
+	if err != nil {
+		log.Printf("Failed to rank teams: %v", err)
+		return
+	}
+	var contest models.Contest
+	if err := database.DB.First(&contest, contestID).Error; err == nil && contest.FreezeTime != nil {
+		frozen, err := rankTeams(contestID, contest.FreezeTime)
+		if err != nil {
+			log.Printf("Failed to rank teams at freeze time: %v", err)
+			return
+		}
+		entries = append(entries, frozen...)
+	}
+
+	// 在事务中更新缓存表，保证数据一致性
+	database.DB.Transaction(func(tx *gorm.DB) error {
+		// 先清空该比赛旧的排行榜数据
+		if err := tx.Where("contest_id = ?", contestID).Delete(&models.Scoreboard{}).Error; err != nil {
+			return err
+		}
+		for i := range entries {
+			if err := tx.Create(&entries[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	// 更新数据库后，清空所有与排行榜相关的 Redis 缓存，确保下次查询获取最新数据
+	ClearScoreboardCache()
+
+	log.Println("Scoreboard cache updated successfully.")
+}
+
+// ClearScoreboardCache 清空 Redis 中的排行榜缓存
+func ClearScoreboardCache() {
+	keys, err := database.RDB.Keys(database.Ctx, "scoreboard:*").Result()
+	if err == nil && len(keys) > 0 {
+		database.RDB.Del(database.Ctx, keys...)
+		log.Printf("Cleared %d scoreboard cache keys from Redis.", len(keys))
+	}
+}
+
+// 已删除部分的解题记录保留，但不计入总分、排名和回放
+const (
+	livePartJoin = "LEFT JOIN dalictf_challenge_part p ON p.id = r.part_id"
+	livePartCond = "(r.part_id = 0 OR p.id IS NOT NULL)"
+)
+
+// rankTeams 汇总一场比赛的解题记录并计算分赛道和总榜排名。
+// until 不为空时只统计该时间之前的解题记录，生成的行标记为封榜数据；retroactive 题目记录中的得分
+// 会随封榜后的解题继续衰减，封榜数据改按当时的解题数计算，封榜期间保持不变
+func rankTeams(contestID uint, until *time.Time) ([]models.Scoreboard, error) {
 	// 辅助结构体，用于从原始解题记录中聚合数据
 	type TeamScore struct {
 		TeamID        uint32
@@ -21,73 +78,254 @@ func UpdateScoreboardCache() {
 		Track         models.UserTrack
 		TeamName      string
 		SchoolName    *string
+		Bloods        []models.TeamBlood
 	}
 
-	var teamScores []TeamScore
-	// 通过 JOIN 查询和 GROUP BY 聚合，一次性计算出所有队伍的总分和最后解题时间
-	database.DB.Table("dalictf_problem_solving_record r").
-		Select("r.team_id, SUM(r.score) as total_score, MAX(r.solving_time) as last_solve_time, t.track, t.team_name, s.school_name").
+	// 辅助结构体，对应每一条解题记录及其队伍信息
+	type SolveRow struct {
+		TeamID      uint32
+		ChallengeID uint32
+		PartID      uint32
+		Score       uint
+		BonusScore  uint
+		Blood       uint8
+		SolvingTime time.Time
+		Track       models.UserTrack
+		TeamName    string
+		SchoolName  *string
+	}
+
+	var solveRows []SolveRow
+	// 通过 JOIN 一次性取出所有解题记录。聚合放在 Go 中完成：
+	// SQLite 对 MAX(datetime) 返回字符串，无法直接扫描进 time.Time
+	query := database.DB.Table("dalictf_problem_solving_record r").
+		Select("r.team_id, r.challenge_id, r.part_id, r.score, r.bonus_score, r.blood, r.solving_time, t.track, t.team_name, s.school_name").
 		Joins("JOIN dalictf_team t ON r.team_id = t.id").
 		Joins("LEFT JOIN dalictf_school s ON t.school_id = s.id").
-		Group("r.team_id, t.track, t.team_name, s.school_name").
-		Order("total_score desc, last_solve_time asc").
-		Scan(&teamScores)
+		Joins(livePartJoin).
+		Where("r.contest_id = ?", contestID).
+		Where(livePartCond)
+	if until != nil {
+		query = query.Where("r.solving_time < ?", *until)
+	}
+	if err := query.Scan(&solveRows).Error; err != nil {
+		return nil, err
+	}
+	var retro map[scoreKey]ScoreParams
+	var counts map[scoreKey]uint
+	if until != nil {
+		var err error
+		if retro, err = retroactiveParams(contestID); err != nil {
+			return nil, err
+		}
+		if counts, err = solveCountsBefore(contestID, *until); err != nil {
+			return nil, err
+		}
+	}
 
-	// 在事务中更新缓存表，保证数据一致性
-	database.DB.Transaction(func(tx *gorm.DB) error {
-		// 先清空旧的排行榜数据
-		if err := tx.Exec("DELETE FROM dalictf_scoreboard").Error; err != nil {
-			return err
+	scoreIndex := make(map[uint32]int)
+	var teamScores []TeamScore
+	for _, row := range solveRows {
+		idx, ok := scoreIndex[row.TeamID]
+		if !ok {
+			idx = len(teamScores)
+			scoreIndex[row.TeamID] = idx
+			teamScores = append(teamScores, TeamScore{
+				TeamID:     row.TeamID,
+				Track:      row.Track,
+				TeamName:   row.TeamName,
+				SchoolName: row.SchoolName,
+			})
+		}
+		score := row.Score
+		if params, ok := retro[scoreKey{row.ChallengeID, row.PartID}]; ok {
+			score = ScoreAt(params, counts[scoreKey{row.ChallengeID, row.PartID}])
+		}
+		teamScores[idx].TotalScore += score + row.BonusScore
+		if row.Blood > 0 {
+			teamScores[idx].Bloods = append(teamScores[idx].Bloods, models.TeamBlood{ChallengeID: row.ChallengeID, Blood: row.Blood})
+		}
+		if row.SolvingTime.After(teamScores[idx].LastSolveTime) {
+			teamScores[idx].LastSolveTime = row.SolvingTime
 		}
+	}
+	// 总分降序，同分时最后解题时间早者优先
+	sort.SliceStable(teamScores, func(i, j int) bool {
+		if teamScores[i].TotalScore != teamScores[j].TotalScore {
+			return teamScores[i].TotalScore > teamScores[j].TotalScore
+		}
+		return teamScores[i].LastSolveTime.Before(teamScores[j].LastSolveTime)
+	})
 
-		// 按赛道分别计算排名
-		rankCounters := make(map[models.ScoreboardTrack]uint)
-		var overallRank uint = 0
-
-		for _, ts := range teamScores {
-			overallRank++
-			track := models.ScoreboardTrack(ts.Track)
-			rankCounters[track]++
-
-			// 写入分赛道排名
-			entry := models.Scoreboard{
-				TeamID:        ts.TeamID,
-				TeamName:      ts.TeamName,
-				SchoolName:    ts.SchoolName,
-				Track:         track,
-				Score:         ts.TotalScore,
-				LastSolveTime: &ts.LastSolveTime,
-				Rank:          rankCounters[track],
-			}
-			if err := tx.Create(&entry).Error; err != nil {
-				return err
-			}
+	progress, err := ChallengePartProgress(contestID, until)
+	if err != nil {
+		log.Printf("Failed to load multi-part challenge progress: %v", err)
+	}
 
-			// 写入总榜排名
-			overallEntry := models.Scoreboard{
-				TeamID:        ts.TeamID,
-				TeamName:      ts.TeamName,
-				SchoolName:    ts.SchoolName,
-				Track:         models.TrackOverall,
-				Score:         ts.TotalScore,
-				LastSolveTime: &ts.LastSolveTime,
-				Rank:          overallRank,
-			}
-			if err := tx.Create(&overallEntry).Error; err != nil {
-				return err
-			}
+	// 按赛道分别计算排名
+	rankCounters := make(map[models.ScoreboardTrack]uint)
+	var overallRank uint = 0
+	entries := make([]models.Scoreboard, 0, 2*len(teamScores))
+	for _, ts := range teamScores {
+		overallRank++
+		track := models.ScoreboardTrack(ts.Track)
+		rankCounters[track]++
+
+		// 写入分赛道排名
+		entries = append(entries, models.Scoreboard{
+			TeamID:        ts.TeamID,
+			TeamName:      ts.TeamName,
+			SchoolName:    ts.SchoolName,
+			Track:         track,
+			Score:         ts.TotalScore,
+			LastSolveTime: &ts.LastSolveTime,
+			Rank:          rankCounters[track],
+			Progress:      progress[ts.TeamID],
+			Frozen:        until != nil,
+			ContestID:     contestID,
+			Bloods:        ts.Bloods,
+		})
+
+		// 写入总榜排名
+		entries = append(entries, models.Scoreboard{
+			TeamID:        ts.TeamID,
+			TeamName:      ts.TeamName,
+			SchoolName:    ts.SchoolName,
+			Track:         models.TrackOverall,
+			Score:         ts.TotalScore,
+			LastSolveTime: &ts.LastSolveTime,
+			Rank:          overallRank,
+			Progress:      progress[ts.TeamID],
+			Frozen:        until != nil,
+			ContestID:     contestID,
+			Bloods:        ts.Bloods,
+		})
+	}
+	return entries, nil
+}
+
+// scoreKey 标识一道单 Flag 题目（PartID 为 0）或多阶段题目的一个部分
+type scoreKey struct {
+	ChallengeID uint32
+	PartID      uint32
+}
+
+// solveCountsBefore 统计一场比赛各题目（部分）在 until 之前的解题数，已删除部分的记录不计
+func solveCountsBefore(contestID uint, until time.Time) (map[scoreKey]uint, error) {
+	type countRow struct {
+		ChallengeID uint32
+		PartID      uint32
+		Solves      uint
+	}
+	var rows []countRow
+	if err := database.DB.Table("dalictf_problem_solving_record r").
+		Select("r.challenge_id, r.part_id, COUNT(*) AS solves").
+		Joins(livePartJoin).
+		Where("r.contest_id = ? AND r.solving_time < ?", contestID, until).
+		Where(livePartCond).
+		Group("r.challenge_id, r.part_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[scoreKey]uint, len(rows))
+	for _, row := range rows {
+		counts[scoreKey{row.ChallengeID, row.PartID}] = row.Solves
+	}
+	return counts, nil
+}
+
+// retroactiveParams 返回一场比赛中 retroactive 题目（多阶段题目按部分）的计分参数
+func retroactiveParams(contestID uint) (map[scoreKey]ScoreParams, error) {
+	var challenges []models.Challenge
+	if err := database.DB.Where("contest_id = ? AND retroactive = ?", contestID, true).Find(&challenges).Error; err != nil {
+		return nil, err
+	}
+	params := make(map[scoreKey]ScoreParams)
+	for _, ch := range challenges {
+		var parts []models.ChallengePart
+		if err := database.DB.Where("challenge_id = ?", ch.ID).Find(&parts).Error; err != nil {
+			return nil, err
 		}
-		return nil
-	})
+		if len(parts) == 0 {
+			params[scoreKey{ch.ID, 0}] = ChallengeScoreParams(ch)
+		}
+		for _, p := range parts {
+			params[scoreKey{ch.ID, p.ID}] = PartScoreParams(ch, p)
+		}
+	}
+	return params, nil
+}
 
-	// 更新数据库后，清空所有与排行榜相关的 Redis 缓存，确保下次查询获取最新数据
-	keys, err := database.RDB.Keys(database.Ctx, "scoreboard:*").Result()
-	if err == nil && len(keys) > 0 {
-		database.RDB.Del(database.Ctx, keys...)
-		log.Printf("Cleared %d scoreboard cache keys from Redis.", len(keys))
+// ChallengeStats 是题目在某一时刻的分值和解题数，Parts 按部分 ID 记录多阶段题目各部分的统计
+type ChallengeStats struct {
+	CurrentScore uint
+	SolvedCount  uint
+	Parts        map[uint32]ChallengeStats
+}
+
+// ChallengeStatsAt 按 until 之前的解题记录计算一场比赛各题目当时的分值和解题数，键为题目 ID。
+// 封榜期间代替题目上的实时数据向公众展示，避免泄露封榜后的解题情况
+func ChallengeStatsAt(contestID uint, until time.Time) (map[uint32]ChallengeStats, error) {
+	var challenges []models.Challenge
+	if err := database.DB.Where("contest_id = ?", contestID).Find(&challenges).Error; err != nil {
+		return nil, err
+	}
+	var parts []models.ChallengePart
+	if err := database.DB.Joins("JOIN dalictf_challenge c ON c.id = dalictf_challenge_part.challenge_id").
+		Where("c.contest_id = ?", contestID).
+		Find(&parts).Error; err != nil {
+		return nil, err
+	}
+	counts, err := solveCountsBefore(contestID, until)
+	if err != nil {
+		return nil, err
 	}
 
-	log.Println("Scoreboard cache updated successfully.")
+	// 多阶段题目的解题数为当时已解出全部部分的队伍数
+	type teamParts struct {
+		ChallengeID uint32
+		TeamID      uint32
+		Solved      int
+	}
+	var solved []teamParts
+	if err := database.DB.Table("dalictf_problem_solving_record r").
+		Select("r.challenge_id, r.team_id, COUNT(*) AS solved").
+		Joins("JOIN dalictf_challenge_part p ON p.id = r.part_id").
+		Where("r.contest_id = ? AND r.solving_time < ?", contestID, until).
+		Group("r.challenge_id, r.team_id").
+		Scan(&solved).Error; err != nil {
+		return nil, err
+	}
+
+	partsByChallenge := make(map[uint32][]models.ChallengePart)
+	for _, p := range parts {
+		partsByChallenge[p.ChallengeID] = append(partsByChallenge[p.ChallengeID], p)
+	}
+	fullSolvers := make(map[uint32]uint)
+	for _, s := range solved {
+		if s.Solved == len(partsByChallenge[s.ChallengeID]) {
+			fullSolvers[s.ChallengeID]++
+		}
+	}
+
+	stats := make(map[uint32]ChallengeStats, len(challenges))
+	for _, ch := range challenges {
+		chParts := partsByChallenge[ch.ID]
+		if len(chParts) == 0 {
+			n := counts[scoreKey{ch.ID, 0}]
+			stats[ch.ID] = ChallengeStats{CurrentScore: ScoreAt(ChallengeScoreParams(ch), n), SolvedCount: n}
+			continue
+		}
+		stat := ChallengeStats{SolvedCount: fullSolvers[ch.ID], Parts: make(map[uint32]ChallengeStats, len(chParts))}
+		for _, p := range chParts {
+			n := counts[scoreKey{ch.ID, p.ID}]
+			score := ScoreAt(PartScoreParams(ch, p), n)
+			stat.Parts[p.ID] = ChallengeStats{CurrentScore: score, SolvedCount: n}
+			stat.CurrentScore += score
+		}
+		stats[ch.ID] = stat
+	}
+	return stats, nil
 }
 
 // AddSolveToFeed 将一条新的解题记录添加到动态缓存中
@@ -105,14 +343,170 @@ func AddSolveToFeed(solve models.Submission, challenge models.Challenge, team mo
 		SchoolName:    schoolName,
 		Score:         solve.Score,
 		SolvingTime:   solve.SolvingTime,
+		ContestID:     solve.ContestID,
+		Blood:         solve.Blood,
+		BonusScore:    solve.BonusScore,
+	}
+	// 多阶段题目记录解出的部分和该队伍当前的进度
+	if solve.PartID != 0 {
+		var part models.ChallengePart
+		if err := database.DB.First(&part, solve.PartID).Error; err == nil {
+			var total, solved int64
+			database.DB.Model(&models.ChallengePart{}).Where("challenge_id = ?", solve.ChallengeID).Count(&total)
+			database.DB.Table("dalictf_problem_solving_record r").
+				Joins("JOIN dalictf_challenge_part p ON p.id = r.part_id").
+				Where("r.challenge_id = ? AND r.team_id = ?", solve.ChallengeID, solve.TeamID).
+				Count(&solved)
+			feedEntry.PartID = part.ID
+			feedEntry.PartName = part.Name
+			feedEntry.PartPosition = part.Position
+			feedEntry.PartCount = uint(total)
+			feedEntry.PartsSolved = uint(solved)
+		}
 	}
 
 	database.DB.Create(&feedEntry)
 
-	// (可选) 清理旧的记录，保持表的大小
+	// (可选) 清理旧的记录，保持表的大小；按比赛分别清理，不影响其他比赛的动态
 	var count int64
-	database.DB.Model(&models.SolveFeed{}).Count(&count)
-	if count > 5000 { // 保留最新的 5000 条
-		database.DB.Exec("DELETE FROM dalictf_solve_feed ORDER BY solving_time asc LIMIT ?", count-5000)
+	database.DB.Model(&models.SolveFeed{}).Where("contest_id = ?", solve.ContestID).Count(&count)
+	if count > 5000 { // 每场比赛保留最新的 5000 条
+		// DELETE ... ORDER BY ... LIMIT 只有 MySQL 支持，这里先查出最旧记录的 ID 再按 ID 删除
+		var staleIDs []uint64
+		database.DB.Model(&models.SolveFeed{}).
+			Where("contest_id = ?", solve.ContestID).
+			Order("solving_time asc, id asc").
+			Limit(int(count-5000)).
+			Pluck("id", &staleIDs)
+		if len(staleIDs) > 0 {
+			database.DB.Delete(&models.SolveFeed{}, staleIDs)
+		}
+	}
+}
+
+// ReplayEvent 是封榜后的一次解题，Score 含血奖励，TotalScore 为该队伍本次解题后的总分。
+// retroactive 题目的新解题会降低此前所有解出队伍的得分，这些队伍变化后的总分记在 Adjustments 中
+type ReplayEvent struct {
+	TeamID        uint32        `json:"team_id"`
+	TeamName      string        `json:"team_name"`
+	ChallengeID   uint32        `json:"challenge_id"`
+	ChallengeName string        `json:"challenge_name"`
+	PartID        uint32        `json:"part_id,omitempty"`
+	Score         uint          `json:"score"`
+	Blood         uint8         `json:"blood,omitempty"`
+	TotalScore    uint          `json:"total_score"`
+	SolvingTime   time.Time     `json:"solving_time"`
+	Adjustments   []ReplayScore `json:"adjustments,omitempty"`
+}
+
+// ReplayScore 是回放中一支队伍变化后的总分
+type ReplayScore struct {
+	TeamID     uint32 `json:"team_id"`
+	TotalScore uint   `json:"total_score"`
+}
+
+// ScoreboardReplay 按时间顺序返回比赛封榜后的解题记录，供揭晓时以封榜排行榜为起点回放，
+// 回放结束时各队总分与实时排行榜一致。track 为 overall 时包含全部队伍，否则只包含该赛道的队伍
+func ScoreboardReplay(contestID uint, freezeTime time.Time, track string) ([]models.Scoreboard, []ReplayEvent, error) {
+	var initial []models.Scoreboard
+	if err := database.DB.Where("contest_id = ? AND track = ? AND frozen = ?", contestID, track, true).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "rank"}}).
+		Find(&initial).Error; err != nil {
+		return nil, nil, err
+	}
+
+	// 取出全部赛道的解题记录：其他赛道的解题同样会使 retroactive 题目衰减
+	type solveRow struct {
+		TeamID        uint32
+		TeamName      string
+		Track         string
+		ChallengeID   uint32
+		ChallengeName string
+		PartID        uint32
+		Score         uint
+		BonusScore    uint
+		Blood         uint8
+		SolvingTime   time.Time
+	}
+	var rows []solveRow
+	if err := database.DB.Table("dalictf_problem_solving_record r").
+		Select("r.team_id, t.team_name, t.track, r.challenge_id, c.challenge_name, r.part_id, r.score, r.bonus_score, r.blood, r.solving_time").
+		Joins("JOIN dalictf_team t ON r.team_id = t.id").
+		Joins("JOIN dalictf_challenge c ON r.challenge_id = c.id").
+		Joins(livePartJoin).
+		Where("r.contest_id = ?", contestID).
+		Where(livePartCond).
+		Order("r.solving_time asc, r.id asc").
+		Scan(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	retro, err := retroactiveParams(contestID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inTrack := func(row solveRow) bool {
+		return track == string(models.TrackOverall) || row.Track == track
+	}
+	totals := make(map[uint32]uint, len(initial))
+	for _, entry := range initial {
+		totals[entry.TeamID] = entry.Score
+	}
+	// retroactive 题目（部分）的解出队伍，封榜前的解题只用于确定起始解题数和受影响的队伍
+	solvers := make(map[scoreKey][]uint32)
+	var events []ReplayEvent
+	for _, row := range rows {
+		key := scoreKey{row.ChallengeID, row.PartID}
+		params, isRetro := retro[key]
+		if row.SolvingTime.Before(freezeTime) {
+			if isRetro && inTrack(row) {
+				solvers[key] = append(solvers[key], row.TeamID)
+			} else if isRetro {
+				solvers[key] = append(solvers[key], 0)
+			}
+			continue
+		}
+
+		score := row.Score
+		var adjustments []ReplayScore
+		if isRetro {
+			n := uint(len(solvers[key]))
+			score = ScoreAt(params, n+1)
+			drop := ScoreAt(params, n) - score
+			for _, teamID := range solvers[key] {
+				if teamID == 0 || drop == 0 {
+					continue
+				}
+				totals[teamID] -= drop
+				adjustments = append(adjustments, ReplayScore{TeamID: teamID, TotalScore: totals[teamID]})
+			}
+			solverID := row.TeamID
+			if !inTrack(row) {
+				solverID = 0
+			}
+			solvers[key] = append(solvers[key], solverID)
+		}
+		if !inTrack(row) {
+			// 其他赛道的解题不出现在回放中，但使本赛道队伍的得分衰减
+			if len(adjustments) > 0 {
+				events = append(events, ReplayEvent{ChallengeID: row.ChallengeID, ChallengeName: row.ChallengeName, PartID: row.PartID, SolvingTime: row.SolvingTime, Adjustments: adjustments})
+			}
+			continue
+		}
+
+		totals[row.TeamID] += score + row.BonusScore
+		events = append(events, ReplayEvent{
+			TeamID:        row.TeamID,
+			TeamName:      row.TeamName,
+			ChallengeID:   row.ChallengeID,
+			ChallengeName: row.ChallengeName,
+			PartID:        row.PartID,
+			Score:         score + row.BonusScore,
+			Blood:         row.Blood,
+			TotalScore:    totals[row.TeamID],
+			SolvingTime:   row.SolvingTime,
+			Adjustments:   adjustments,
+		})
 	}
+	return initial, events, nil
 }
@@ -0,0 +1,171 @@
+// file: services/scoring.go
+package services
+
+import (
+	"ISCTF/models"
+	"fmt"
+	"math"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ScoreParams 是计算题目（或多阶段题目的一个部分）分值所需的参数
+type ScoreParams struct {
+	Formula    models.ScoreFormula
+	Initial    uint
+	Min        uint
+	DecayRatio float32 // linear：每次解题衰减初始分的比例
+	Decay      uint    // logarithmic / parabolic：分值降到最低分所需的解题数
+}
+
+// ChallengeScoreParams 返回单 Flag 题目的计分参数
+func ChallengeScoreParams(ch models.Challenge) ScoreParams {
+	return ScoreParams{Formula: ch.ScoreFormula, Initial: ch.InitialScore, Min: ch.MinScore, DecayRatio: ch.DecayRatio, Decay: ch.ScoreDecay}
+}
+
+// PartScoreParams 返回多阶段题目一个部分的计分参数，公式取自所属题目
+func PartScoreParams(ch models.Challenge, part models.ChallengePart) ScoreParams {
+	return ScoreParams{Formula: ch.ScoreFormula, Initial: part.InitialScore, Min: part.MinScore, DecayRatio: part.DecayRatio, Decay: ch.ScoreDecay}
+}
+
+// ValidateScoring 检查计分公式及其参数
+func ValidateScoring(formula models.ScoreFormula, decay uint) error {
+	switch formula {
+	case models.ScoreFormulaLinear, models.ScoreFormulaStatic:
+		return nil
+	case models.ScoreFormulaLogarithmic, models.ScoreFormulaParabolic:
+		if decay == 0 {
+			return fmt.Errorf("score_decay must be positive for %s scoring", formula)
+		}
+		return nil
+	default:
+		return fmt.Errorf("score_formula %q is invalid (linear/logarithmic/parabolic/static)", formula)
+	}
+}
+
+// ScoreAt 返回已有 solves 支队伍解出后的分值，也就是下一个解出的队伍获得的分数。
+//   - linear：每次解题衰减 Initial*DecayRatio，至少衰减 1 分
+//   - parabolic：与 CTFd 的动态计分相同，Initial + (Min-Initial)/Decay² * solves²
+//   - logarithmic：Initial - (Initial-Min) * ln(1+solves)/ln(1+Decay)，前几次解题衰减最快
+//   - static：始终为 Initial
+//
+// 结果不低于 Min
+func ScoreAt(p ScoreParams, solves uint) uint {
+	if p.Min >= p.Initial || solves == 0 {
+		return p.Initial
+	}
+	initial, minScore, n := float64(p.Initial), float64(p.Min), float64(solves)
+	var value float64
+	switch p.Formula {
+	case models.ScoreFormulaStatic:
+		return p.Initial
+	case models.ScoreFormulaParabolic:
+		if p.Decay == 0 {
+			return p.Initial
+		}
+		decay := float64(p.Decay)
+		value = math.Ceil(initial + (minScore-initial)/(decay*decay)*n*n)
+	case models.ScoreFormulaLogarithmic:
+		if p.Decay == 0 {
+			return p.Initial
+		}
+		value = math.Ceil(initial - (initial-minScore)*math.Log1p(n)/math.Log1p(float64(p.Decay)))
+	default:
+		step := math.Round(initial * float64(p.DecayRatio))
+		if step == 0 && p.DecayRatio > 0 {
+			step = 1
+		}
+		value = initial - step*n
+	}
+	return uint(max(value, minScore))
+}
+
+// RescoreChallenge 按题目当前的计分方式重新计算分值、解题数和全部解题记录的得分：
+// retroactive 题目的所有解题队伍得到当前分值，否则第 k 个解出的队伍得到 ScoreAt(k-1)。
+// 多阶段题目按部分分别计算后汇总。一二三血按现有部分重新排定，奖励分按题目当前的奖励设置重算。tx 应为事务，调用方负责随后刷新排行榜
+func RescoreChallenge(tx *gorm.DB, challengeID uint32) error {
+	var ch models.Challenge
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ch, challengeID).Error; err != nil {
+		return err
+	}
+	var parts []models.ChallengePart
+	if err := tx.Where("challenge_id = ?", challengeID).Find(&parts).Error; err != nil {
+		return err
+	}
+
+	if len(parts) == 0 {
+		current, solved, err := rescoreSolves(tx, challengeID, 0, ChallengeScoreParams(ch), ch.Retroactive)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&ch).UpdateColumns(map[string]interface{}{
+			"current_score": current,
+			"solved_count":  solved,
+		}).Error; err != nil {
+			return err
+		}
+		return rescoreBloods(tx, ch, nil)
+	}
+
+	for _, part := range parts {
+		current, solved, err := rescoreSolves(tx, challengeID, part.ID, PartScoreParams(ch, part), ch.Retroactive)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&part).UpdateColumns(map[string]interface{}{
+			"current_score": current,
+			"solved_count":  solved,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	if err := SyncPartScores(tx, challengeID); err != nil {
+		return err
+	}
+	// 汇总后的初始分是 percent 奖励的基数
+	if err := tx.First(&ch, challengeID).Error; err != nil {
+		return err
+	}
+	return rescoreBloods(tx, ch, parts)
+}
+
+// rescoreSolves 按解题顺序重算一道题目（或一个部分）的解题得分，返回当前分值和解题数
+func rescoreSolves(tx *gorm.DB, challengeID, partID uint32, params ScoreParams, retroactive bool) (uint, uint, error) {
+	var solves []models.Submission
+	if err := tx.Where("challenge_id = ? AND part_id = ?", challengeID, partID).
+		Order("solving_time ASC, id ASC").
+		Find(&solves).Error; err != nil {
+		return 0, 0, err
+	}
+	current := ScoreAt(params, uint(len(solves)))
+	for i, solve := range solves {
+		score := ScoreAt(params, uint(i))
+		if retroactive {
+			score = current
+		}
+		if solve.Score == score {
+			continue
+		}
+		if err := tx.Model(&solve).UpdateColumn("score", score).Error; err != nil {
+			return 0, 0, err
+		}
+	}
+	return current, uint(len(solves)), nil
+}
+
+// SolveScore 返回已有 solves 支队伍解出时下一个解出的队伍获得的分数：
+// retroactive 题目按解出后的分值计分，否则按解出前的分值计分
+func SolveScore(p ScoreParams, solves uint, retroactive bool) uint {
+	if retroactive {
+		return ScoreAt(p, solves+1)
+	}
+	return ScoreAt(p, solves)
+}
+
+// ApplyRetroactiveScore 把一道题目（或一个部分）已有的全部解题得分改为 score，用于 retroactive 题目新增解题后
+func ApplyRetroactiveScore(tx *gorm.DB, challengeID, partID uint32, score uint) error {
+	return tx.Model(&models.Submission{}).
+		Where("challenge_id = ? AND part_id = ? AND score <> ?", challengeID, partID, score).
+		UpdateColumn("score", score).Error
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"ISCTF/models"
+	"testing"
+)
+
+func TestScoreAt(t *testing.T) {
+	linear := ScoreParams{Formula: models.ScoreFormulaLinear, Initial: 500, Min: 100, DecayRatio: 0.1}
+	logarithmic := ScoreParams{Formula: models.ScoreFormulaLogarithmic, Initial: 500, Min: 100, Decay: 10}
+	parabolic := ScoreParams{Formula: models.ScoreFormulaParabolic, Initial: 500, Min: 100, Decay: 10}
+
+	tests := []struct {
+		name   string
+		params ScoreParams
+		solves uint
+		want   uint
+	}{
+		{"linear no solves", linear, 0, 500},
+		{"linear one solve", linear, 1, 450},
+		{"linear reaches min", linear, 8, 100},
+		{"linear clamped to min", linear, 20, 100},
+		{"linear empty formula", ScoreParams{Initial: 500, Min: 100, DecayRatio: 0.1}, 2, 400},
+		{"linear decays at least one point", ScoreParams{Formula: models.ScoreFormulaLinear, Initial: 10, Min: 1, DecayRatio: 0.01}, 3, 7},
+		{"linear zero ratio", ScoreParams{Formula: models.ScoreFormulaLinear, Initial: 500, Min: 100}, 5, 500},
+		{"logarithmic one solve", logarithmic, 1, 385},
+		{"logarithmic two solves", logarithmic, 2, 317},
+		{"logarithmic reaches min at decay", logarithmic, 10, 100},
+		{"logarithmic clamped to min", logarithmic, 11, 100},
+		{"logarithmic zero decay", ScoreParams{Formula: models.ScoreFormulaLogarithmic, Initial: 500, Min: 100}, 3, 500},
+		{"parabolic one solve", parabolic, 1, 496},
+		{"parabolic half way", parabolic, 5, 400},
+		{"parabolic reaches min at decay", parabolic, 10, 100},
+		{"parabolic clamped to min", parabolic, 30, 100},
+		{"parabolic zero decay", ScoreParams{Formula: models.ScoreFormulaParabolic, Initial: 500, Min: 100}, 3, 500},
+		{"static", ScoreParams{Formula: models.ScoreFormulaStatic, Initial: 500, Min: 100, DecayRatio: 0.1}, 9, 500},
+		{"min not below initial", ScoreParams{Formula: models.ScoreFormulaLinear, Initial: 100, Min: 100, DecayRatio: 0.5}, 3, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ScoreAt(tt.params, tt.solves); got != tt.want {
+				t.Errorf("ScoreAt(%+v, %d) = %d, want %d", tt.params, tt.solves, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSolveScore(t *testing.T) {
+	params := ScoreParams{Formula: models.ScoreFormulaLinear, Initial: 500, Min: 100, DecayRatio: 0.1}
+	tests := []struct {
+		name        string
+		solves      uint
+		retroactive bool
+		want        uint
+	}{
+		{"first solve keeps initial score", 0, false, 500},
+		{"later solve scores before decay", 2, false, 400},
+		{"retroactive first solve scores after decay", 0, true, 450},
+		{"retroactive later solve scores after decay", 2, true, 350},
+		{"retroactive clamped to min", 10, true, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SolveScore(params, tt.solves, tt.retroactive); got != tt.want {
+				t.Errorf("SolveScore(%d, %v) = %d, want %d", tt.solves, tt.retroactive, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateScoring(t *testing.T) {
+	tests := []struct {
+		formula models.ScoreFormula
+		decay   uint
+		wantErr bool
+	}{
+		{models.ScoreFormulaLinear, 0, false},
+		{models.ScoreFormulaStatic, 0, false},
+		{models.ScoreFormulaLogarithmic, 10, false},
+		{models.ScoreFormulaLogarithmic, 0, true},
+		{models.ScoreFormulaParabolic, 0, true},
+		{"exponential", 10, true},
+	}
+	for _, tt := range tests {
+		if err := ValidateScoring(tt.formula, tt.decay); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateScoring(%q, %d) error = %v, wantErr %v", tt.formula, tt.decay, err, tt.wantErr)
+		}
+	}
+}
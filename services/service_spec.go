@@ -0,0 +1,179 @@
+// file: services/service_spec.go
+package services
+
+import (
+	"ISCTF/models"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultUnitNetwork 是服务未声明 networks 时接入的网络
+const defaultUnitNetwork = "default"
+
+var serviceNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,29}$`)
+
+// ServiceSpec 是多服务动态题目的定义，格式参照 docker compose 的子集：
+//
+//	services:
+//	  web:
+//	    image: registry/web
+//	    ports: ["80/http"]
+//	    environment: {DB_HOST: db}
+//	    networks: [front, back]
+//	  db:
+//	    image: mysql:8
+//	    networks: [back]
+//	    flag: true
+//	networks:
+//	  back: {internal: true}
+//
+// 服务按书写顺序部署，第一个服务为主服务；Flag 按题目的注入设置只写入标注 flag 的服务（默认主服务）；同一队伍的所有服务作为一个整体创建、续期和销毁
+type ServiceSpec struct {
+	Services ServiceList           `yaml:"services" json:"services"`
+	Networks map[string]NetworkDef `yaml:"networks" json:"networks"`
+}
+
+// ServiceDef 是题目中的一个服务
+type ServiceDef struct {
+	Name        string            `yaml:"-" json:"name"`
+	Image       string            `yaml:"image" json:"image"`
+	Environment map[string]string `yaml:"environment" json:"environment,omitempty"`
+	Ports       []string          `yaml:"ports" json:"ports,omitempty"` // 形如 "80/http"，与 docker_ports 的写法相同
+	Networks    []string          `yaml:"networks" json:"networks,omitempty"`
+	Flag        bool              `yaml:"flag" json:"flag,omitempty"` // 接收 Flag 的服务，都未标注时为第一个服务
+}
+
+// NetworkDef 是服务之间使用的网络
+type NetworkDef struct {
+	Internal bool `yaml:"internal" json:"internal"` // 内部网络没有出网路由
+}
+
+// ServiceList 按书写顺序保存服务，YAML 映射解码到 map 会丢失顺序
+type ServiceList []ServiceDef
+
+func (l *ServiceList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return errors.New("services must be a mapping of service name to definition")
+	}
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		var svc ServiceDef
+		if err := value.Content[i+1].Decode(&svc); err != nil {
+			return fmt.Errorf("service %s: %w", value.Content[i].Value, err)
+		}
+		svc.Name = value.Content[i].Value
+		*l = append(*l, svc)
+	}
+	return nil
+}
+
+// PortSpecs 解析服务暴露的端口
+func (s ServiceDef) PortSpecs() []PortSpec {
+	return ParsePortSpecs(strings.Join(s.Ports, ","))
+}
+
+// ParseServiceSpec 解析并校验多服务定义（YAML 或 JSON）
+func ParseServiceSpec(text string) (*ServiceSpec, error) {
+	var spec ServiceSpec
+	if err := yaml.Unmarshal([]byte(text), &spec); err != nil {
+		return nil, fmt.Errorf("invalid service spec: %w", err)
+	}
+	if len(spec.Services) == 0 {
+		return nil, errors.New("service spec must define at least one service")
+	}
+	for name := range spec.Networks {
+		if !serviceNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid network name %q", name)
+		}
+	}
+
+	seenServices := make(map[string]bool, len(spec.Services))
+	seenPorts := make(map[uint32]string)
+	flagService := ""
+	for _, svc := range spec.Services {
+		if svc.Flag {
+			if flagService != "" {
+				return nil, fmt.Errorf("only one service can receive the flag (%s, %s)", flagService, svc.Name)
+			}
+			flagService = svc.Name
+		}
+		if !serviceNamePattern.MatchString(svc.Name) {
+			return nil, fmt.Errorf("invalid service name %q (lowercase letters, digits and '-')", svc.Name)
+		}
+		if seenServices[svc.Name] {
+			return nil, fmt.Errorf("duplicate service %q", svc.Name)
+		}
+		seenServices[svc.Name] = true
+		if strings.TrimSpace(svc.Image) == "" {
+			return nil, fmt.Errorf("service %s: image is required", svc.Name)
+		}
+		ports := svc.PortSpecs()
+		if len(ports) != len(svc.Ports) {
+			return nil, fmt.Errorf("service %s: invalid ports %v", svc.Name, svc.Ports)
+		}
+		// 网关子域名和代理票据按容器端口区分，同一题目内端口不能重复
+		for _, p := range ports {
+			if other, ok := seenPorts[p.Port]; ok {
+				return nil, fmt.Errorf("port %d is exposed by both %s and %s", p.Port, other, svc.Name)
+			}
+			seenPorts[p.Port] = svc.Name
+		}
+		for _, network := range svc.Networks {
+			if _, ok := spec.Networks[network]; !ok && network != defaultUnitNetwork {
+				return nil, fmt.Errorf("service %s: undefined network %q", svc.Name, network)
+			}
+		}
+	}
+	return &spec, nil
+}
+
+// ChallengeServices 返回题目要部署的服务列表：未配置多服务定义的题目视为只有一个匿名服务
+func ChallengeServices(challenge models.Challenge) (*ServiceSpec, error) {
+	if strings.TrimSpace(challenge.ServiceSpec) != "" {
+		return ParseServiceSpec(challenge.ServiceSpec)
+	}
+	var ports []string
+	if challenge.DockerPorts != "" {
+		ports = strings.Split(challenge.DockerPorts, ",")
+	}
+	return &ServiceSpec{Services: ServiceList{{Image: challenge.DockerImage, Ports: ports}}}, nil
+}
+
+// MultiService 表示题目由多服务定义部署，而不是单镜像题目
+func (s *ServiceSpec) MultiService() bool {
+	return len(s.Services) > 0 && s.Services[0].Name != ""
+}
+
+// ExposedPorts 把所有服务暴露的端口合并为 docker_ports 的写法，用于容器记录展示
+func (s *ServiceSpec) ExposedPorts() string {
+	var items []string
+	for _, svc := range s.Services {
+		for _, p := range svc.PortSpecs() {
+			items = append(items, strconv.Itoa(int(p.Port))+"/"+p.Protocol)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// unitNetworkPrefix 是多服务实例专用网络的名称前缀，对账时据此找出无主的网络
+func unitNetworkPrefix(containerID uint32) string {
+	return fmt.Sprintf("%sunit-%d-", instanceNamePrefix, containerID)
+}
+
+// parseUnitNetwork 从网络名称中解析出所属的容器记录 ID，不是多服务网络时返回 false
+func parseUnitNetwork(name string) (uint32, bool) {
+	rest, ok := strings.CutPrefix(name, instanceNamePrefix+"unit-")
+	if !ok {
+		return 0, false
+	}
+	idStr, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	return uint32(id), err == nil
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"ISCTF/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseServiceSpec(t *testing.T) {
+	spec, err := ParseServiceSpec(`
+services:
+  web:
+    image: registry/web
+    ports: ["80/http", "8080"]
+    environment: {DB_HOST: db}
+    networks: [front, back]
+  db:
+    image: mysql:8
+    networks: [back, default]
+    flag: true
+networks:
+  front: {}
+  back: {internal: true}
+`)
+	if err != nil {
+		t.Fatalf("ParseServiceSpec: %v", err)
+	}
+	var names []string
+	for _, svc := range spec.Services {
+		names = append(names, svc.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"web", "db"}) {
+		t.Errorf("services = %v, want definition order [web db]", names)
+	}
+	if !spec.MultiService() {
+		t.Error("MultiService() = false")
+	}
+	if got := spec.ExposedPorts(); got != "80/http,8080/tcp" {
+		t.Errorf("ExposedPorts() = %q", got)
+	}
+	if !spec.Services[1].Flag || spec.Services[0].Environment["DB_HOST"] != "db" {
+		t.Errorf("service fields not decoded: %+v", spec.Services)
+	}
+	if !spec.Networks["back"].Internal || spec.Networks["front"].Internal {
+		t.Errorf("networks = %+v", spec.Networks)
+	}
+}
+
+func TestParseServiceSpecErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want string
+	}{
+		{"invalid yaml", "services: [", "invalid service spec"},
+		{"no services", "networks: {}", "at least one service"},
+		{"services not a mapping", "services: [web]", "mapping"},
+		{"missing image", "services:\n  web: {ports: [80]}", "image is required"},
+		{"invalid service name", "services:\n  Web: {image: x}", "invalid service name"},
+		{"duplicate service", "services:\n  web: {image: x}\n  web: {image: y}", "duplicate service"},
+		{"invalid port", "services:\n  web: {image: x, ports: [80/udp]}", "invalid ports"},
+		{"port exposed twice", "services:\n  web: {image: x, ports: [80]}\n  api: {image: y, ports: [80/http]}", "exposed by both"},
+		{"undefined network", "services:\n  web: {image: x, networks: [back]}", "undefined network"},
+		{"invalid network name", "services:\n  web: {image: x}\nnetworks:\n  Back: {}", "invalid network name"},
+		{"two flag services", "services:\n  web: {image: x, flag: true}\n  db: {image: y, flag: true}", "only one service"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseServiceSpec(tt.spec)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseServiceSpec error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestChallengeServicesSingleImage(t *testing.T) {
+	spec, err := ChallengeServices(models.Challenge{DockerImage: "nginx", DockerPorts: "80/http,22"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.MultiService() || len(spec.Services) != 1 || spec.Services[0].Image != "nginx" {
+		t.Fatalf("spec = %+v, want one anonymous nginx service", spec)
+	}
+	if got := spec.ExposedPorts(); got != "80/http,22/tcp" {
+		t.Errorf("ExposedPorts() = %q", got)
+	}
+}
+
+func TestParseUnitNetwork(t *testing.T) {
+	tests := []struct {
+		name   string
+		wantID uint32
+		wantOK bool
+	}{
+		{unitNetworkPrefix(42) + "back", 42, true},
+		{instanceNamePrefix + "team-7", 0, false},
+		{instanceNamePrefix + "unit-x-back", 0, false},
+		{"bridge", 0, false},
+	}
+	for _, tt := range tests {
+		id, ok := parseUnitNetwork(tt.name)
+		if id != tt.wantID || ok != tt.wantOK {
+			t.Errorf("parseUnitNetwork(%q) = %d, %v; want %d, %v", tt.name, id, ok, tt.wantID, tt.wantOK)
+		}
+	}
+}
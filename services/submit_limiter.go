@@ -0,0 +1,127 @@
+// file: services/submit_limiter.go
+package services
+
+import (
+	"ISCTF/config"
+	"ISCTF/database"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// SubmitScope 是触发限流的维度
+type SubmitScope string
+
+const (
+	SubmitScopeUser          SubmitScope = "user"
+	SubmitScopeTeam          SubmitScope = "team"
+	SubmitScopeTeamChallenge SubmitScope = "team_challenge"
+)
+
+// submitScopes 与 submitLimitScript 中 KEYS 的分组顺序一致
+var submitScopes = []SubmitScope{SubmitScopeUser, SubmitScopeTeam, SubmitScopeTeamChallenge}
+
+// SubmitThrottle 描述一次被拒绝的提交
+type SubmitThrottle struct {
+	Scope SubmitScope
+	// Cooling 为 true 表示此前已在冷却中，false 表示本次提交刚超出限制
+	Cooling    bool
+	RetryAfter time.Duration
+}
+
+// submitLimitScript 原子地检查全部维度：每个维度占 3 个 KEY（滑动窗口 ZSET、冷却标记、超限次数）。
+// 先检查冷却，再检查窗口计数，都未超限时才把本次提交计入所有窗口。
+// 返回 {维度序号, 是否已在冷却, 剩余毫秒}，序号 0 表示放行
+var submitLimitScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local base = tonumber(ARGV[3])
+local maxCooldown = tonumber(ARGV[4])
+local strikeTTL = tonumber(ARGV[5])
+local member = ARGV[6]
+local n = #KEYS / 3
+
+for i = 1, n do
+	local ttl = redis.call("PTTL", KEYS[i*3-1])
+	if ttl > 0 then
+		return {i, 1, ttl}
+	end
+end
+
+for i = 1, n do
+	local limit = tonumber(ARGV[6+i])
+	if limit > 0 then
+		local key = KEYS[i*3-2]
+		redis.call("ZREMRANGEBYSCORE", key, "-inf", now - window)
+		if redis.call("ZCARD", key) >= limit then
+			local strikes = redis.call("INCR", KEYS[i*3])
+			redis.call("PEXPIRE", KEYS[i*3], strikeTTL)
+			local cooldown = base
+			for _ = 2, strikes do
+				cooldown = cooldown * 2
+				if cooldown >= maxCooldown then
+					break
+				end
+			end
+			if cooldown > maxCooldown then
+				cooldown = maxCooldown
+			end
+			redis.call("SET", KEYS[i*3-1], strikes, "PX", cooldown)
+			return {i, 0, cooldown}
+		end
+	end
+end
+
+for i = 1, n do
+	if tonumber(ARGV[6+i]) > 0 then
+		redis.call("ZADD", KEYS[i*3-2], now, member)
+		redis.call("PEXPIRE", KEYS[i*3-2], window)
+	end
+end
+return {0, 0, 0}`)
+
+// CheckSubmitLimit 记录一次 Flag 提交并检查各维度的频率限制，返回 nil 表示放行。
+// Redis 不可用时放行并返回错误，由调用方记录日志，避免限流故障阻断比赛
+func CheckSubmitLimit(ctx context.Context, userID, teamID, challengeID uint32) (*SubmitThrottle, error) {
+	cfg := config.C.Submit
+	if !cfg.RateLimit {
+		return nil, nil
+	}
+
+	subjects := []string{
+		fmt.Sprintf("user:%d", userID),
+		fmt.Sprintf("team:%d", teamID),
+		fmt.Sprintf("team:%d:challenge:%d", teamID, challengeID),
+	}
+	keys := make([]string, 0, len(subjects)*3)
+	for _, s := range subjects {
+		keys = append(keys, "submit:window:"+s, "submit:cooldown:"+s, "submit:strikes:"+s)
+	}
+	args := []interface{}{
+		time.Now().UnixMilli(),
+		cfg.Window.Milliseconds(),
+		cfg.Cooldown.Milliseconds(),
+		cfg.MaxCooldown.Milliseconds(),
+		cfg.StrikeReset.Milliseconds(),
+		uuid.NewString(),
+		cfg.PerUser,
+		cfg.PerTeam,
+		cfg.PerTeamChallenge,
+	}
+
+	res, err := submitLimitScript.Run(ctx, database.RDB, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("submit rate limit: %w", err)
+	}
+	if len(res) != 3 || res[0] == 0 || int(res[0]) > len(submitScopes) {
+		return nil, nil
+	}
+	return &SubmitThrottle{
+		Scope:      submitScopes[res[0]-1],
+		Cooling:    res[1] == 1,
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
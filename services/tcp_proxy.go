@@ -0,0 +1,268 @@
+// file: services/tcp_proxy.go
+package services
+
+import (
+	"ISCTF/config"
+	"ISCTF/database"
+	"ISCTF/models"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrProxyTicketNotFound 表示票据无效或对应的容器不在运行
+var ErrProxyTicketNotFound = errors.New("proxy ticket not found")
+
+const (
+	tcpProxyPrompt      = "ticket: "
+	tcpProxyDialTimeout = 5 * time.Second
+	maxTicketLineLength = 64
+)
+
+// ProxyTicketFor 返回容器某个 TCP 端口的票据：第一个 TCP 端口为票据本身，其余为 <ticket>:<port>
+func ProxyTicketFor(ticket string, port uint32, primary bool) string {
+	if primary {
+		return ticket
+	}
+	return ticket + ":" + strconv.Itoa(int(port))
+}
+
+// proxyConns 记录本进程中每个容器正在转发的连接（客户端和实例两端），容器释放时由 CloseProxyConnections 关闭
+var proxyConns = struct {
+	sync.Mutex
+	m map[uint32]map[net.Conn]struct{}
+}{m: make(map[uint32]map[net.Conn]struct{})}
+
+// tcpProxy 是面向 pwn / nc 类题目的 TCP 前置代理。
+// 选手连上后先发送一行票据，代理校验票据对应的容器仍在运行后再与实例双向转发
+type tcpProxy struct {
+	cfg config.TCPProxyConfig
+
+	mu        sync.Mutex
+	teamConns map[uint32]int // 本代理上每支队伍的活跃连接数（多副本部署时各自计数）
+}
+
+// StartTCPProxy 启动 TCP 代理，ctx 取消时停止监听
+func StartTCPProxy(ctx context.Context, cfg config.TCPProxyConfig) error {
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("listen tcp proxy on %s: %w", cfg.Addr, err)
+	}
+	p := &tcpProxy{cfg: cfg, teamConns: make(map[uint32]int)}
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("TCP proxy: accept: %v", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			go p.handle(conn)
+		}
+	}()
+	log.Printf("TCP proxy listening on %s (public address %s).", cfg.Addr, cfg.PublicAddr)
+	return nil
+}
+
+func (p *tcpProxy) handle(client net.Conn) {
+	defer client.Close()
+
+	// 1. 读取票据
+	_ = client.SetDeadline(time.Now().Add(p.cfg.HandshakeTimeout))
+	if _, err := io.WriteString(client, tcpProxyPrompt); err != nil {
+		return
+	}
+	reader := bufio.NewReaderSize(client, 4096)
+	line, err := readTicketLine(reader)
+	if err != nil {
+		return
+	}
+
+	container, endpoint, err := lookupProxyTarget(line)
+	if err != nil {
+		if errors.Is(err, ErrProxyTicketNotFound) {
+			io.WriteString(client, "invalid ticket or instance not running\n")
+		} else {
+			log.Printf("TCP proxy: lookup ticket: %v", err)
+			io.WriteString(client, "internal error\n")
+		}
+		return
+	}
+
+	// 2. 队伍连接数限制
+	if !p.acquire(container.TeamID) {
+		io.WriteString(client, fmt.Sprintf("too many connections for your team (limit %d)\n", p.cfg.MaxConnsPerTeam))
+		return
+	}
+	defer p.release(container.TeamID)
+
+	// 3. 连接实例
+	upstream, err := net.DialTimeout("tcp", EndpointUpstream(*endpoint, p.cfg.UpstreamHost), tcpProxyDialTimeout)
+	if err != nil {
+		log.Printf("TCP proxy: container %d: dial upstream: %v", container.ID, err)
+		io.WriteString(client, "instance unreachable, try again later\n")
+		return
+	}
+	defer upstream.Close()
+	_ = client.SetDeadline(time.Time{})
+	trackProxyConns(container.ID, client, upstream)
+	defer untrackProxyConns(container.ID, client, upstream)
+
+	record := models.ContainerConnection{
+		ContainerID: container.ID,
+		TeamID:      container.TeamID,
+		RemoteAddr:  client.RemoteAddr().String(),
+		TargetPort:  endpoint.TargetPort,
+		StartedAt:   time.Now(),
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		log.Printf("TCP proxy: container %d: save connection log: %v", container.ID, err)
+	}
+
+	// 4. 双向转发，任一方向结束即关闭两端；票据行之后已读入缓冲区的数据一并转发
+	var bytesIn, bytesOut atomic.Int64
+	done := make(chan struct{}, 2)
+	go func() {
+		n, _ := io.Copy(upstream, reader)
+		bytesIn.Add(n)
+		done <- struct{}{}
+	}()
+	go func() {
+		n, _ := io.Copy(client, upstream)
+		bytesOut.Add(n)
+		done <- struct{}{}
+	}()
+	<-done
+	client.Close()
+	upstream.Close()
+	<-done
+
+	if record.ID != 0 {
+		database.DB.Model(&record).Updates(map[string]interface{}{
+			"ended_at":  time.Now(),
+			"bytes_in":  bytesIn.Load(),
+			"bytes_out": bytesOut.Load(),
+		})
+	}
+}
+
+// readTicketLine 读取一行票据，超长的行视为无效输入
+func readTicketLine(r *bufio.Reader) (string, error) {
+	var sb strings.Builder
+	for sb.Len() <= maxTicketLineLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == '\n' {
+			return strings.TrimSpace(sb.String()), nil
+		}
+		sb.WriteByte(b)
+	}
+	return "", errors.New("ticket line too long")
+}
+
+// lookupProxyTarget 根据票据找到运行中的容器及要转发的 TCP 端点
+func lookupProxyTarget(line string) (*models.Container, *models.ContainerEndpoint, error) {
+	ticket, portStr, hasPort := strings.Cut(line, ":")
+	if ticket == "" {
+		return nil, nil, ErrProxyTicketNotFound
+	}
+
+	var container models.Container
+	err := database.DB.
+		Where("proxy_ticket = ? AND state = ?", ticket, models.ContainerStateRunning).
+		First(&container).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrProxyTicketNotFound
+		}
+		return nil, nil, err
+	}
+
+	for i, ep := range container.Endpoints {
+		if ep.Protocol != "tcp" {
+			continue
+		}
+		if !hasPort || strconv.Itoa(int(ep.TargetPort)) == portStr {
+			return &container, &container.Endpoints[i], nil
+		}
+	}
+	return nil, nil, ErrProxyTicketNotFound
+}
+
+func trackProxyConns(containerID uint32, conns ...net.Conn) {
+	proxyConns.Lock()
+	defer proxyConns.Unlock()
+	set := proxyConns.m[containerID]
+	if set == nil {
+		set = make(map[net.Conn]struct{})
+		proxyConns.m[containerID] = set
+	}
+	for _, conn := range conns {
+		set[conn] = struct{}{}
+	}
+}
+
+func untrackProxyConns(containerID uint32, conns ...net.Conn) {
+	proxyConns.Lock()
+	defer proxyConns.Unlock()
+	set := proxyConns.m[containerID]
+	for _, conn := range conns {
+		delete(set, conn)
+	}
+	if len(set) == 0 {
+		delete(proxyConns.m, containerID)
+	}
+}
+
+// CloseProxyConnections 立即断开本进程中转发到该容器的全部连接，销毁后不再等待实例关闭连接。
+// 连接断开后 handle 返回，队伍连接数随之释放
+func CloseProxyConnections(containerID uint32) {
+	proxyConns.Lock()
+	set := proxyConns.m[containerID]
+	delete(proxyConns.m, containerID)
+	proxyConns.Unlock()
+	for conn := range set {
+		conn.Close()
+	}
+}
+
+func (p *tcpProxy) acquire(teamID uint32) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.teamConns[teamID] >= p.cfg.MaxConnsPerTeam {
+		return false
+	}
+	p.teamConns[teamID]++
+	return true
+}
+
+func (p *tcpProxy) release(teamID uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.teamConns[teamID] <= 1 {
+		delete(p.teamConns, teamID)
+		return
+	}
+	p.teamConns[teamID]--
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"ISCTF/config"
+	"ISCTF/database"
+	"ISCTF/models"
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReleaseContainerClosesProxyConnections(t *testing.T) {
+	fake := setupContainerTest(t)
+	ctx := context.Background()
+
+	// 实例侧用回显服务代替
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	c := insertTestContainer(t, models.Container{
+		TeamID:      1,
+		ChallengeID: 1,
+		State:       models.ContainerStateRunning,
+		EndTime:     time.Now().Add(time.Hour),
+		ProxyTicket: "ticket",
+		Endpoints: []models.ContainerEndpoint{{
+			Host:       "127.0.0.1",
+			TargetPort: uint32(upstream.Addr().(*net.TCPAddr).Port),
+			Protocol:   "tcp",
+			Internal:   true,
+		}},
+	})
+	inst := startTestInstance(t, fake, c.ID, 1)
+	c.DockerID = inst.ID
+	database.DB.Save(&c)
+
+	p := &tcpProxy{
+		cfg:       config.TCPProxyConfig{MaxConnsPerTeam: 1, HandshakeTimeout: 5 * time.Second},
+		teamConns: make(map[uint32]int),
+	}
+	client, server := net.Pipe()
+	defer client.Close()
+	handled := make(chan struct{})
+	go func() {
+		p.handle(server)
+		close(handled)
+	}()
+
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(client)
+	prompt := make([]byte, len(tcpProxyPrompt))
+	if _, err := io.ReadFull(reader, prompt); err != nil {
+		t.Fatalf("read prompt: %v", err)
+	}
+	if _, err := io.WriteString(client, "ticket\nping"); err != nil {
+		t.Fatalf("write ticket: %v", err)
+	}
+	echo := make([]byte, 4)
+	if _, err := io.ReadFull(reader, echo); err != nil || string(echo) != "ping" {
+		t.Fatalf("echo = %q, %v; want ping", echo, err)
+	}
+
+	if released, err := ReleaseContainer(ctx, &c); !released || err != nil {
+		t.Fatalf("ReleaseContainer = %v, %v; want true, nil", released, err)
+	}
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxied connection still open after release")
+	}
+	if _, err := reader.ReadByte(); err == nil {
+		t.Error("client can still read after release")
+	}
+	if n := p.teamConns[1]; n != 0 {
+		t.Errorf("team connections = %d after release, want 0", n)
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"ISCTF/config"
+	"ISCTF/database"
+	"ISCTF/models"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// setupContainerTest 为依赖数据库、Redis 和编排后端的测试准备独立的环境：
+// 按迁移建好的内存 SQLite、miniredis 和 FakeOrchestrator
+func setupContainerTest(t *testing.T) *FakeOrchestrator {
+	t.Helper()
+	database.Connect(config.DatabaseConfig{
+		Driver:          "sqlite",
+		DSN:             "file:" + strings.ReplaceAll(t.Name(), "/", "_") + "?mode=memory&cache=shared",
+		MaxIdleConns:    1,
+		MaxOpenConns:    1,
+		ConnMaxLifetime: time.Hour,
+	})
+	if err := database.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	mr := miniredis.RunT(t)
+	database.InitRedis(config.RedisConfig{Addr: mr.Addr(), PoolSize: 2})
+
+	fake := NewFakeOrchestrator()
+	Orch = fake
+	t.Cleanup(func() {
+		Orch = nil
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return fake
+}
+
+// startTestInstance 在 fake 后端中启动一个带平台标签的实例
+func startTestInstance(t *testing.T, fake *FakeOrchestrator, containerID, teamID uint32) *Instance {
+	t.Helper()
+	inst, err := fake.Create(context.Background(), InstanceSpec{
+		Name:  "ctf-test-" + strconv.Itoa(int(containerID)),
+		Image: "nginx",
+		Labels: map[string]string{
+			LabelContainerID: strconv.FormatUint(uint64(containerID), 10),
+			LabelTeamID:      strconv.FormatUint(uint64(teamID), 10),
+		},
+	})
+	if err != nil {
+		t.Fatalf("create instance: %v", err)
+	}
+	return inst
+}
+
+// insertTestContainer 写入一条容器记录
+func insertTestContainer(t *testing.T, c models.Container) models.Container {
+	t.Helper()
+	if c.ContainerName == "" {
+		c.ContainerName = "test"
+	}
+	if c.DockerImage == "" {
+		c.DockerImage = "nginx"
+	}
+	if c.StartTime.IsZero() {
+		c.StartTime = time.Now()
+	}
+	if err := database.DB.Create(&c).Error; err != nil {
+		t.Fatalf("insert container: %v", err)
+	}
+	return c
+}
+
+// containerState 重新读取容器记录的状态
+func containerState(t *testing.T, id uint32) models.ContainerState {
+	t.Helper()
+	var c models.Container
+	if err := database.DB.First(&c, id).Error; err != nil {
+		t.Fatalf("load container %d: %v", id, err)
+	}
+	return c.State
+}
+
+// hasInstance 表示 fake 后端中仍存在该实例
+func hasInstance(fake *FakeOrchestrator, id string) bool {
+	_, err := fake.Inspect(context.Background(), id)
+	return err == nil
+}
@@ -2,8 +2,8 @@
 package utils
 
 import (
-	"fmt"
-	"github.com/google/uuid"
+	crand "crypto/rand"
+	"encoding/hex"
 	"math/rand"
 	"strings"
 	"time"
@@ -23,10 +23,16 @@ func GenerateInvitationCode(length int) string {
 	return sb.String()
 }
 
-// GenerateDynamicFlag 生成动态 Flag
-func GenerateDynamicFlag() string {
-	part1 := strings.Replace(uuid.New().String(), "-", "", -1)[:12]
-	part2 := strings.Replace(uuid.New().String(), "-", "", -1)[:12]
-	part3 := strings.Replace(uuid.New().String(), "-", "", -1)[:12]
-	return fmt.Sprintf("ISCTF{%s-%s-%s}", part1, part2, part3)
+// GenerateGatewayToken 生成 HTTP 网关子域名使用的随机标识（32 位小写十六进制，可直接作为 DNS 标签）
+func GenerateGatewayToken() string {
+	b := make([]byte, 16)
+	_, _ = crand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// GenerateProxyTicket 生成连接 TCP 代理时使用的票据（16 位小写十六进制，便于手动输入）
+func GenerateProxyTicket() string {
+	b := make([]byte, 8)
+	_, _ = crand.Read(b)
+	return hex.EncodeToString(b)
 }
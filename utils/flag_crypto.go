@@ -0,0 +1,105 @@
+// file: utils/flag_crypto.go
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedFlagPrefix 标记加密存储的值，格式为 enc:<密钥 ID>:<base64(nonce || 密文)>
+const encryptedFlagPrefix = "enc:"
+
+var (
+	flagKeyID string
+	flagKeys  = map[string]cipher.AEAD{}
+)
+
+// InitFlagKeys 注入加密存储 Flag 的密钥，必须在读写静态 Flag 或 Flag 规则之前调用。
+// key 必须显式配置，不从其他密钥派生，以免轮换 JWT 密钥后已加密的 Flag 无法解密；
+// retired 中的旧密钥只用于解密
+func InitFlagKeys(keyID, key string, retired map[string]string) error {
+	if key == "" {
+		return errors.New("flag encryption key is not configured")
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("decode flag encryption key: %w", err)
+	}
+	keys := map[string]cipher.AEAD{}
+	aead, err := newFlagAEAD(raw)
+	if err != nil {
+		return err
+	}
+	keys[keyID] = aead
+	for id, k := range retired {
+		decoded, err := base64.StdEncoding.DecodeString(k)
+		if err != nil {
+			return fmt.Errorf("decode retired flag key %s: %w", id, err)
+		}
+		if keys[id], err = newFlagAEAD(decoded); err != nil {
+			return err
+		}
+	}
+	flagKeyID, flagKeys = keyID, keys
+	return nil
+}
+
+func newFlagAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("flag encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptFlag 用当前密钥加密 Flag 或 Flag 规则，空字符串原样返回
+func EncryptFlag(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	aead, ok := flagKeys[flagKeyID]
+	if !ok {
+		return "", errors.New("flag encryption key is not initialized")
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedFlagPrefix + flagKeyID + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptFlag 解密 EncryptFlag 的结果；没有 enc: 前缀的值视为加密前写入的明文，原样返回
+func DecryptFlag(stored string) (string, error) {
+	rest, ok := strings.CutPrefix(stored, encryptedFlagPrefix)
+	if !ok {
+		return stored, nil
+	}
+	keyID, data, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", errors.New("malformed encrypted flag")
+	}
+	aead, ok := flagKeys[keyID]
+	if !ok {
+		return "", fmt.Errorf("unknown flag encryption key %q", keyID)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted flag")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt flag: %w", err)
+	}
+	return string(plain), nil
+}
+
+// IsEncryptedFlag 表示值已加密存储
+func IsEncryptedFlag(stored string) bool {
+	return strings.HasPrefix(stored, encryptedFlagPrefix)
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+var (
+	testFlagKeyA = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	testFlagKeyB = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+func mustInitFlagKeys(t *testing.T, keyID, key string, retired map[string]string) {
+	t.Helper()
+	if err := InitFlagKeys(keyID, key, retired); err != nil {
+		t.Fatalf("InitFlagKeys: %v", err)
+	}
+}
+
+func TestEncryptDecryptFlag(t *testing.T) {
+	mustInitFlagKeys(t, "k1", testFlagKeyA, nil)
+
+	tests := []string{"flag{hello}", "flag{中文}", strings.Repeat("x", 255)}
+	for _, plain := range tests {
+		stored, err := EncryptFlag(plain)
+		if err != nil {
+			t.Fatalf("EncryptFlag(%q): %v", plain, err)
+		}
+		if !IsEncryptedFlag(stored) || !strings.HasPrefix(stored, "enc:k1:") {
+			t.Fatalf("EncryptFlag(%q) = %q, want enc:k1: prefix", plain, stored)
+		}
+		if len(stored) > 512 {
+			t.Fatalf("EncryptFlag(%q) is %d bytes, column holds 512", plain, len(stored))
+		}
+		got, err := DecryptFlag(stored)
+		if err != nil || got != plain {
+			t.Fatalf("DecryptFlag(%q) = %q, %v; want %q", stored, got, err, plain)
+		}
+	}
+
+	// 同一明文每次加密的结果不同
+	a, _ := EncryptFlag("flag{same}")
+	b, _ := EncryptFlag("flag{same}")
+	if a == b {
+		t.Fatal("EncryptFlag reused a nonce")
+	}
+}
+
+func TestDecryptFlagPassThrough(t *testing.T) {
+	mustInitFlagKeys(t, "k1", testFlagKeyA, nil)
+
+	for _, stored := range []string{"", "flag{legacy plaintext}"} {
+		got, err := DecryptFlag(stored)
+		if err != nil || got != stored {
+			t.Errorf("DecryptFlag(%q) = %q, %v; want unchanged", stored, got, err)
+		}
+	}
+	if stored, err := EncryptFlag(""); err != nil || stored != "" {
+		t.Errorf("EncryptFlag(\"\") = %q, %v; want empty", stored, err)
+	}
+}
+
+func TestFlagKeyRotation(t *testing.T) {
+	mustInitFlagKeys(t, "k1", testFlagKeyA, nil)
+	old, err := EncryptFlag("flag{rotate}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 轮换后新值使用新密钥，旧密钥仍可解密
+	mustInitFlagKeys(t, "k2", testFlagKeyB, map[string]string{"k1": testFlagKeyA})
+	if got, err := DecryptFlag(old); err != nil || got != "flag{rotate}" {
+		t.Fatalf("DecryptFlag(old) after rotation = %q, %v", got, err)
+	}
+	fresh, err := EncryptFlag("flag{rotate}")
+	if err != nil || !strings.HasPrefix(fresh, "enc:k2:") {
+		t.Fatalf("EncryptFlag after rotation = %q, %v; want enc:k2: prefix", fresh, err)
+	}
+
+	// 移除旧密钥后旧值无法解密
+	mustInitFlagKeys(t, "k2", testFlagKeyB, nil)
+	if _, err := DecryptFlag(old); err == nil {
+		t.Fatal("DecryptFlag(old) succeeded without the retired key")
+	}
+	if got, err := DecryptFlag(fresh); err != nil || got != "flag{rotate}" {
+		t.Fatalf("DecryptFlag(fresh) = %q, %v", got, err)
+	}
+}
+
+func TestDecryptFlagRejectsTampering(t *testing.T) {
+	mustInitFlagKeys(t, "k1", testFlagKeyA, nil)
+	stored, err := EncryptFlag("flag{tamper}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := strings.TrimPrefix(stored, "enc:k1:")
+	flipped := []byte(body)
+	if flipped[len(flipped)-1] == 'A' {
+		flipped[len(flipped)-1] = 'B'
+	} else {
+		flipped[len(flipped)-1] = 'A'
+	}
+
+	// 用同一密钥的另一个 ID 标记，确认密钥 ID 决定解密所用的密钥
+	mustInitFlagKeys(t, "k1", testFlagKeyA, map[string]string{"k9": testFlagKeyB})
+	tests := []string{
+		"enc:k1:" + string(flipped),
+		"enc:k1",
+		"enc:k1:!!!",
+		"enc:k1:AAAA",
+		"enc:k9:" + body,
+		"enc:missing:" + body,
+	}
+	for _, bad := range tests {
+		if got, err := DecryptFlag(bad); err == nil {
+			t.Errorf("DecryptFlag(%q) = %q, want error", bad, got)
+		}
+	}
+}
+
+func TestInitFlagKeysValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		retired map[string]string
+	}{
+		{"missing key", "", nil},
+		{"not base64", "not base64!", nil},
+		{"wrong length", base64.StdEncoding.EncodeToString([]byte("short")), nil},
+		{"bad retired key", testFlagKeyA, map[string]string{"old": "%%%"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := InitFlagKeys("k1", tt.key, tt.retired); err == nil {
+				t.Error("InitFlagKeys succeeded, want error")
+			}
+		})
+	}
+}
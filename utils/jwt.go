@@ -3,11 +3,22 @@ package utils
 
 import (
 	"ISCTF/models"
+	"crypto/sha256"
+	"errors"
 	"github.com/golang-jwt/jwt/v5"
 	"time"
 )
 
-var jwtSecret = []byte("a-very-secure-secret-that-should-be-in-config-file")
+var (
+	jwtSecret []byte
+	jwtExpire = 7 * 24 * time.Hour
+)
+
+// InitJWT 注入签名密钥和 Token 有效期，必须在签发或解析 Token 之前调用
+func InitJWT(secret string, expire time.Duration) {
+	jwtSecret = []byte(secret)
+	jwtExpire = expire
+}
 
 type Claims struct {
 	UserID   uint32          `json:"user_id"`
@@ -22,7 +33,7 @@ func GenerateToken(user models.User) (string, error) {
 		Username: user.Username,
 		Role:     user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(jwtExpire)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -42,3 +53,43 @@ func ParseToken(tokenString string) (*Claims, error) {
 	}
 	return nil, err
 }
+
+// GatewayClaims 是 HTTP 网关访问凭证，绑定到某队伍的某个容器
+type GatewayClaims struct {
+	ContainerID uint32 `json:"container_id"`
+	TeamID      uint32 `json:"team_id"`
+	jwt.RegisteredClaims
+}
+
+// gatewayKey 由登录密钥派生，使网关凭证无法被当作登录 Token 使用
+func gatewayKey() []byte {
+	sum := sha256.Sum256(append([]byte("dalictf-gateway:"), jwtSecret...))
+	return sum[:]
+}
+
+// GenerateGatewayTicket 签发 ttl 内有效的网关访问凭证
+func GenerateGatewayTicket(containerID, teamID uint32, ttl time.Duration) (string, error) {
+	claims := GatewayClaims{
+		ContainerID: containerID,
+		TeamID:      teamID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(gatewayKey())
+}
+
+func ParseGatewayTicket(tokenString string) (*GatewayClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &GatewayClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return gatewayKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if claims, ok := token.Claims.(*GatewayClaims); ok && token.Valid {
+		return claims, nil
+	}
+	return nil, errors.New("invalid gateway ticket")
+}